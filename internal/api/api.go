@@ -3,6 +3,27 @@ package api
 const (
 	DONE                                   = "Done"
 	ERROR_MISSED_ID                        = "Missed id"
+	ERROR_INVALID_ID                       = "Invalid id"
+	ERROR_NOT_FOUND                        = "Not Found"
+	ERROR_INVALID_LIMIT                    = "Invalid limit: expected number from 1 to 1000"
+	ERROR_INVALID_SORT                     = "Invalid sort: expected one of id, -id, data, -data"
+	ERROR_TEXT_SEARCH_DISABLED             = "Full-text search is disabled"
+	ERROR_INVALID_CURSOR                   = "Invalid cursor: use the next value of the previous page with the same sort"
+	ERROR_PRECONDITION_FAILED              = "Precondition Failed: the record has been changed, get the current version and retry"
+	ERROR_BULK_EMPTY                       = "Bulk has no operations"
+	ERROR_BULK_TOO_LARGE                   = "Bulk has too many operations: split it into smaller ones"
+	ERROR_TRANSACTIONS_UNSUPPORTED         = "Atomic batches are not supported by the database deployment: it is neither a replica set nor a sharded cluster"
+	ERROR_TRANSACTION_CONFLICT             = "Transaction conflicts with concurrent writes: retry the batch"
+	ERROR_INVALID_HISTORY_BEFORE           = "Invalid before: expected positive version number"
+	ERROR_VERSION_NOT_IN_HISTORY           = "Version is not in the record history"
+	ERROR_VERSION_WITHOUT_DATA             = "Version is a delete: there is no data to revert to"
+	ERROR_MISSED_CREDENTIALS               = "Unauthorized: send the API key in the X-API-Key header or the token in the Authorization: Bearer header"
+	ERROR_INVALID_CREDENTIALS              = "Unauthorized: the credentials are invalid or expired"
+	ERROR_FORBIDDEN                        = "Forbidden: the operation requires the %v role"
+	ERROR_TENANT_FORBIDDEN                 = "Forbidden: the tenant of the credentials does not match the X-Tenant-ID header"
+	ERROR_ID_TAKEN                         = "Id is taken by another record"
+	ERROR_INVALID_REQUEST_TIMEOUT          = "Invalid X-Request-Timeout: expected positive number of milliseconds"
+	ERROR_REQUEST_TIMEOUT                  = "Gateway Timeout: the request has not been done before its deadline"
 	ERROR_NOT_IMPLEMENTED                  = "Not Implemented"
 	ERROR_BAD_REQUEST                      = "Bad Request"
 	ERROR_INTERNAL_SERVER_ERROR            = "Internal Server Error"
@@ -0,0 +1,23 @@
+package audit
+
+import (
+	"github.com/ArtemVoronov/artforintrovert-test/internal/logging"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/records"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// ACTOR_KEY is the key of the authenticated actor in the gin context
+	ACTOR_KEY         = "actor"
+	ANONYMOUS_ACTOR   = "anonymous"
+	REQUEST_ID_HEADER = logging.REQUEST_ID_HEADER
+)
+
+// Of tells who makes the request for the history of records
+func Of(c *gin.Context) records.Audit {
+	actor := c.GetString(ACTOR_KEY)
+	if actor == "" {
+		actor = ANONYMOUS_ACTOR
+	}
+	return records.Audit{Actor: actor, RequestId: logging.RequestIdOf(c)}
+}
@@ -0,0 +1,66 @@
+package deadline
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ArtemVoronov/artforintrovert-test/internal/api"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/logging"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// TIMEOUT_HEADER is the timeout of the request in milliseconds chosen by the client
+	TIMEOUT_HEADER = "X-Request-Timeout"
+	// STATUS_CLIENT_CLOSED_REQUEST is the status of the requests whose clients have gone before the response, as nginx logs them
+	STATUS_CLIENT_CLOSED_REQUEST = 499
+)
+
+// Middleware sets the deadline of the request context, so the queries of the request are cancelled by it.
+// The timeout of the header is capped by max, the requests without the header get max. Zero max leaves them
+// without a deadline
+func Middleware(max time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		timeout := max
+		if value := c.GetHeader(TIMEOUT_HEADER); value != "" {
+			millis, err := strconv.Atoi(value)
+			if err != nil || millis < 1 {
+				c.AbortWithStatusJSON(http.StatusBadRequest, api.ERROR_INVALID_REQUEST_TIMEOUT)
+				return
+			}
+			requested := time.Duration(millis) * time.Millisecond
+			if max == 0 || requested < max {
+				timeout = requested
+			}
+		}
+		if timeout == 0 {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// SendFailure sends 504 if the deadline of the request has been exceeded, 499 if the client has gone meanwhile,
+// and 500 otherwise. Only the last one is logged as an error
+func SendFailure(c *gin.Context, err error, message string) {
+	cause := c.Request.Context().Err()
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(cause, context.DeadlineExceeded):
+		c.JSON(http.StatusGatewayTimeout, api.ERROR_REQUEST_TIMEOUT)
+		logging.Of(c).WithError(err).Warn(message)
+	case errors.Is(cause, context.Canceled):
+		c.Status(STATUS_CLIENT_CLOSED_REQUEST)
+		logging.Of(c).WithError(err).Warn(message)
+	default:
+		c.JSON(http.StatusInternalServerError, api.ERROR_INTERNAL_SERVER_ERROR)
+		logging.Of(c).WithError(err).Error(message)
+	}
+}
@@ -0,0 +1,76 @@
+package precondition
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/db"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/records"
+	"github.com/gin-gonic/gin"
+)
+
+// IfMatch is the parsed If-Match header of a write request
+type IfMatch struct {
+	// Present is true if the header is set, the write must not create the record then
+	Present bool
+	// Versions are the record versions the write is allowed for, nil for "*" or the absent header
+	Versions []int64
+}
+
+// ETag formats the record version as a strong entity tag
+func ETag(version int64) string {
+	return "\"" + strconv.FormatInt(version, 10) + "\""
+}
+
+// SetETag sends the version of the record
+func SetETag(c *gin.Context, record *records.Record) {
+	c.Header("ETag", ETag(record.Version))
+}
+
+// ParseIfMatch reads the If-Match header. Weak and foreign tags never match: If-Match uses the strong comparison
+func ParseIfMatch(c *gin.Context) IfMatch {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" {
+		return IfMatch{}
+	}
+	if header == "*" {
+		return IfMatch{Present: true}
+	}
+
+	versions := make([]int64, 0)
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if len(tag) < 2 || !strings.HasPrefix(tag, "\"") || !strings.HasSuffix(tag, "\"") {
+			continue
+		}
+		version, err := strconv.ParseInt(tag[1:len(tag)-1], 10, 64)
+		if err != nil {
+			continue
+		}
+		versions = append(versions, version)
+	}
+	return IfMatch{Present: true, Versions: versions}
+}
+
+// Matches checks the precondition against the current record
+func (m IfMatch) Matches(record *records.Record) bool {
+	if m.Versions == nil {
+		return true
+	}
+	for _, version := range m.Versions {
+		if version == record.Version {
+			return true
+		}
+	}
+	return false
+}
+
+// Failed reports whether the write error means that the precondition is not met.
+// The missing record does not match the precondition either
+func (m IfMatch) Failed(err error) bool {
+	if errors.Is(err, records.ErrVersionMismatch) {
+		return true
+	}
+	return m.Present && errors.Is(err, db.ErrNotFound)
+}
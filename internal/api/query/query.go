@@ -0,0 +1,64 @@
+package query
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/ArtemVoronov/artforintrovert-test/internal/api"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/records"
+	"github.com/gin-gonic/gin"
+)
+
+var recordsQueryParams = []string{"limit", "after", "sort", "data", "prefix", "search", "text"}
+
+// IsRecordsQuery reports whether the request has any of records query parameters
+func IsRecordsQuery(c *gin.Context) bool {
+	for _, param := range recordsQueryParams {
+		if _, ok := c.GetQuery(param); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseRecordsQuery reads pagination and filter parameters. The returned error message is ready to be sent to a client
+func ParseRecordsQuery(c *gin.Context) (records.Query, error) {
+	q := records.Query{
+		Limit:  records.DEFAULT_PAGE_LIMIT,
+		SortBy: records.SORT_BY_ID,
+	}
+
+	if value, ok := c.GetQuery("limit"); ok {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > records.MAX_PAGE_LIMIT {
+			return q, errors.New(api.ERROR_INVALID_LIMIT)
+		}
+		q.Limit = limit
+	}
+
+	if value, ok := c.GetQuery("sort"); ok {
+		q.Desc = strings.HasPrefix(value, "-")
+		q.SortBy = strings.TrimPrefix(value, "-")
+		if q.SortBy != records.SORT_BY_ID && q.SortBy != records.SORT_BY_DATA {
+			return q, errors.New(api.ERROR_INVALID_SORT)
+		}
+	}
+
+	if value, ok := c.GetQuery("after"); ok {
+		cursor, err := records.DecodeCursor(value)
+		if err != nil || cursor.SortBy != q.SortBy || cursor.Desc != q.Desc {
+			return q, errors.New(api.ERROR_INVALID_CURSOR)
+		}
+		q.After = cursor
+	}
+
+	if value, ok := c.GetQuery("data"); ok {
+		q.Data = &value
+	}
+	q.Prefix = c.Query("prefix")
+	q.Search = c.Query("search")
+	q.Text = c.Query("text")
+
+	return q, nil
+}
@@ -0,0 +1,40 @@
+package health
+
+import (
+	"net/http"
+
+	"github.com/ArtemVoronov/artforintrovert-test/internal/logging"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/health"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type StatusDTO struct {
+	Status string `json:"status"`
+}
+
+type Handler struct {
+	health *health.Service
+}
+
+func CreateHandler(healthService *health.Service) *Handler {
+	return &Handler{
+		health: healthService,
+	}
+}
+
+// Live tells that the process serves requests, it checks no dependencies: a restart does not fix them
+func (h *Handler) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, StatusDTO{Status: health.STATUS_UP})
+}
+
+// Ready checks the dependencies, 503 with the same report if any of them is down
+func (h *Handler) Ready(c *gin.Context) {
+	report := h.health.Check(c.Request.Context())
+	if report.Status != health.STATUS_UP {
+		logging.Of(c).WithFields(logrus.Fields{"mongo": report.Dependencies.Mongo.Status, "cache": report.Dependencies.Cache.Status}).Warn("instance is not ready")
+		c.JSON(http.StatusServiceUnavailable, report)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
@@ -1,12 +1,18 @@
 package records
 
 import (
-	"log"
+	"errors"
 	"net/http"
 
 	"github.com/ArtemVoronov/artforintrovert-test/internal/api"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/api/audit"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/api/deadline"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/api/precondition"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/api/query"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/api/tenant"
 	"github.com/ArtemVoronov/artforintrovert-test/internal/api/validation"
 	"github.com/ArtemVoronov/artforintrovert-test/internal/services/cache"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/db"
 	"github.com/ArtemVoronov/artforintrovert-test/internal/services/records"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -25,48 +31,128 @@ type RawData struct {
 	Data string `json:"data" binding:"required"`
 }
 
-func GetRecords(c *gin.Context) {
-	cache.Instance().RecordsCacheToJSON(c, http.StatusOK)
+type Handler struct {
+	records records.RecordsService
+	cache   cache.CacheService
 }
 
-func UpdateRecord(c *gin.Context) {
+func CreateHandler(recordsService records.RecordsService, cacheService cache.CacheService) *Handler {
+	return &Handler{
+		records: recordsService,
+		cache:   cacheService,
+	}
+}
+
+// service returns the records service of the tenant of the request writing on behalf of its actor
+func (h *Handler) service(c *gin.Context) records.RecordsService {
+	return h.records.WithTenant(tenant.Of(c)).WithAudit(audit.Of(c))
+}
+
+// GetRecords sends all records as a plain array, or one page of records when any of pagination parameters is set
+func (h *Handler) GetRecords(c *gin.Context) {
+	if !query.IsRecordsQuery(c) {
+		h.cache.RecordsCacheToJSON(c, tenant.Of(c), http.StatusOK)
+		return
+	}
+
+	q, err := query.ParseRecordsQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	page, err := h.cache.Find(c.Request.Context(), tenant.Of(c), q)
+	if errors.Is(err, records.ErrTextSearchDisabled) {
+		c.JSON(http.StatusBadRequest, api.ERROR_TEXT_SEARCH_DISABLED)
+		return
+	}
+	if err != nil {
+		deadline.SendFailure(c, err, "unable to get records")
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+func (h *Handler) GetRecord(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, api.ERROR_INVALID_ID)
+		return
+	}
+
+	record, err := h.cache.GetRecord(c.Request.Context(), tenant.Of(c), id)
+	if errors.Is(err, db.ErrNotFound) {
+		c.JSON(http.StatusNotFound, api.ERROR_NOT_FOUND)
+		return
+	}
+	if err != nil {
+		deadline.SendFailure(c, err, "unable to get record")
+		return
+	}
+
+	precondition.SetETag(c, record)
+	c.JSON(http.StatusOK, record)
+}
+
+func (h *Handler) UpdateRecord(c *gin.Context) {
 	var record UpdateRecordDTO
 
-	if err := c.BindJSON(&record); err != nil {
+	if err := validation.BindJSON(c, &record); err != nil {
 		validation.SendError(c, err)
 		return
 	}
 
 	if record.Id == primitive.NilObjectID {
-		id, err := records.Instance().Insert(RawData{record.Data})
+		result, err := h.service(c).Insert(c.Request.Context(), RawData{record.Data})
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, api.ERROR_INTERNAL_SERVER_ERROR)
-			log.Printf("unable to create record: %v", err)
+			deadline.SendFailure(c, err, "unable to create record")
 			return
 		}
-		c.JSON(http.StatusCreated, id)
+		h.cache.Put(c.Request.Context(), *result)
+		precondition.SetETag(c, result)
+		c.JSON(http.StatusCreated, result.Id)
 		return
 	}
 
-	id, err := records.Instance().Upsert(record.Id, RawData{record.Data})
+	// the conditional write updates the existing record only
+	ifMatch := precondition.ParseIfMatch(c)
+	var result *records.Record
+	var created bool
+	var err error
+	if ifMatch.Present {
+		result, err = h.service(c).Update(c.Request.Context(), record.Id, RawData{record.Data}, ifMatch.Versions)
+	} else {
+		result, created, err = h.service(c).Upsert(c.Request.Context(), record.Id, RawData{record.Data})
+	}
+	if ifMatch.Failed(err) {
+		c.JSON(http.StatusPreconditionFailed, api.ERROR_PRECONDITION_FAILED)
+		return
+	}
+	if errors.Is(err, db.ErrDuplicateKey) {
+		// the id is taken by a record of another tenant
+		c.JSON(http.StatusConflict, api.ERROR_ID_TAKEN)
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, api.ERROR_INTERNAL_SERVER_ERROR)
-		log.Printf("unable to update record: %v", err)
+		deadline.SendFailure(c, err, "unable to update record")
 		return
 	}
+	h.cache.Put(c.Request.Context(), *result)
+	precondition.SetETag(c, result)
 
-	if id != nil {
-		c.JSON(http.StatusCreated, id)
+	if created {
+		c.JSON(http.StatusCreated, result.Id)
 		return
 	}
 
 	c.JSON(http.StatusOK, api.DONE)
 }
 
-func DeleteRecord(c *gin.Context) {
+func (h *Handler) DeleteRecord(c *gin.Context) {
 	var record DeleteRecordDTO
 
-	if err := c.BindJSON(&record); err != nil {
+	if err := validation.BindJSON(c, &record); err != nil {
 		validation.SendError(c, err)
 		return
 	}
@@ -76,12 +162,21 @@ func DeleteRecord(c *gin.Context) {
 		return
 	}
 
-	err := records.Instance().Delete(record.Id)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, api.ERROR_INTERNAL_SERVER_ERROR)
-		log.Printf("unable to update record: %v", err)
+	ifMatch := precondition.ParseIfMatch(c)
+	deleted, err := h.service(c).Delete(c.Request.Context(), record.Id, ifMatch.Versions)
+	if ifMatch.Failed(err) {
+		c.JSON(http.StatusPreconditionFailed, api.ERROR_PRECONDITION_FAILED)
 		return
 	}
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
+		deadline.SendFailure(c, err, "unable to update record")
+		return
+	}
+	var version int64
+	if deleted != nil {
+		version = deleted.Version
+	}
+	h.cache.Remove(c.Request.Context(), tenant.Of(c), record.Id, version)
 
 	c.JSON(http.StatusOK, api.DONE)
 }
@@ -0,0 +1,443 @@
+package records
+
+import (
+	"errors"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/ArtemVoronov/artforintrovert-test/internal/api"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/api/audit"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/api/deadline"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/api/precondition"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/api/query"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/api/tenant"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/api/validation"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/cache"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/db"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/records"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type RecordDTO struct {
+	Data string `json:"data" bson:"data" binding:"required"`
+}
+
+type PatchRecordDTO struct {
+	Data *string `json:"data,omitempty" bson:"data,omitempty"`
+}
+
+type BulkOperationDTO struct {
+	Op   string             `json:"op" binding:"required"`
+	Id   primitive.ObjectID `json:"id,omitempty"`
+	Data *string            `json:"data,omitempty"`
+}
+
+type BulkDTO struct {
+	// Ordered is true by default
+	Ordered    *bool              `json:"ordered,omitempty"`
+	Operations []BulkOperationDTO `json:"operations" binding:"required,dive"`
+}
+
+type BulkResultDTO struct {
+	Results []records.BulkOperationResult `json:"results"`
+}
+
+type RevertDTO struct {
+	Version int64 `json:"version" binding:"required,min=1"`
+}
+
+type BatchOperationDTO struct {
+	Op      string             `json:"op" binding:"required"`
+	Id      primitive.ObjectID `json:"id,omitempty"`
+	Data    *string            `json:"data,omitempty"`
+	Version *int64             `json:"version,omitempty"`
+}
+
+type BatchDTO struct {
+	Atomic     bool                `json:"atomic"`
+	Operations []BatchOperationDTO `json:"operations" binding:"required,dive"`
+}
+
+type BatchResultDTO struct {
+	RolledBack bool                          `json:"rolledBack"`
+	Results    []records.BulkOperationResult `json:"results"`
+}
+
+type Handler struct {
+	records records.RecordsService
+	cache   cache.CacheService
+}
+
+func CreateHandler(recordsService records.RecordsService, cacheService cache.CacheService) *Handler {
+	return &Handler{
+		records: recordsService,
+		cache:   cacheService,
+	}
+}
+
+// service returns the records service of the tenant of the request writing on behalf of its actor
+func (h *Handler) service(c *gin.Context) records.RecordsService {
+	return h.records.WithTenant(tenant.Of(c)).WithAudit(audit.Of(c))
+}
+
+func (h *Handler) GetRecords(c *gin.Context) {
+	q, err := query.ParseRecordsQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	page, err := h.cache.Find(c.Request.Context(), tenant.Of(c), q)
+	if errors.Is(err, records.ErrTextSearchDisabled) {
+		c.JSON(http.StatusBadRequest, api.ERROR_TEXT_SEARCH_DISABLED)
+		return
+	}
+	if err != nil {
+		deadline.SendFailure(c, err, "unable to get records")
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// GetTrash returns a page of the deleted records, the same query parameters as for GetRecords
+func (h *Handler) GetTrash(c *gin.Context) {
+	q, err := query.ParseRecordsQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	page, err := h.service(c).FindTrash(c.Request.Context(), q)
+	if errors.Is(err, records.ErrTextSearchDisabled) {
+		c.JSON(http.StatusBadRequest, api.ERROR_TEXT_SEARCH_DISABLED)
+		return
+	}
+	if err != nil {
+		deadline.SendFailure(c, err, "unable to get trash")
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// RestoreRecord takes the record out of the trash, 404 if there is no such record in the trash
+func (h *Handler) RestoreRecord(c *gin.Context) {
+	id, ok := parseId(c)
+	if !ok {
+		return
+	}
+
+	record, err := h.service(c).Restore(c.Request.Context(), id)
+	if err == nil {
+		h.cache.Put(c.Request.Context(), *record)
+	}
+	sendRecord(c, record, err)
+}
+
+// GetHistory returns the history of the record from the latest version, limit and before page through it
+func (h *Handler) GetHistory(c *gin.Context) {
+	id, ok := parseId(c)
+	if !ok {
+		return
+	}
+
+	limit := records.DEFAULT_HISTORY_LIMIT
+	if value, ok := c.GetQuery("limit"); ok {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > records.MAX_HISTORY_LIMIT {
+			c.JSON(http.StatusBadRequest, api.ERROR_INVALID_LIMIT)
+			return
+		}
+		limit = parsed
+	}
+	var before int64
+	if value, ok := c.GetQuery("before"); ok {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 1 {
+			c.JSON(http.StatusBadRequest, api.ERROR_INVALID_HISTORY_BEFORE)
+			return
+		}
+		before = parsed
+	}
+
+	history, err := h.service(c).GetHistory(c.Request.Context(), id, before, limit)
+	if err != nil {
+		deadline.SendFailure(c, err, "unable to get history")
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
+
+// RevertRecord sets the data of the record to the one of the version from its history
+func (h *Handler) RevertRecord(c *gin.Context) {
+	id, ok := parseId(c)
+	if !ok {
+		return
+	}
+
+	var revert RevertDTO
+
+	if err := validation.BindJSON(c, &revert); err != nil {
+		validation.SendError(c, err)
+		return
+	}
+
+	ifMatch := precondition.ParseIfMatch(c)
+	record, err := h.service(c).Revert(c.Request.Context(), id, revert.Version, ifMatch.Versions)
+	if errors.Is(err, records.ErrVersionNotInHistory) {
+		c.JSON(http.StatusNotFound, api.ERROR_VERSION_NOT_IN_HISTORY)
+		return
+	}
+	if errors.Is(err, records.ErrVersionWithoutData) {
+		c.JSON(http.StatusBadRequest, api.ERROR_VERSION_WITHOUT_DATA)
+		return
+	}
+	if ifMatch.Failed(err) {
+		c.JSON(http.StatusPreconditionFailed, api.ERROR_PRECONDITION_FAILED)
+		return
+	}
+	if err == nil {
+		h.cache.Put(c.Request.Context(), *record)
+	}
+	sendRecord(c, record, err)
+}
+
+func (h *Handler) GetRecord(c *gin.Context) {
+	id, ok := parseId(c)
+	if !ok {
+		return
+	}
+
+	record, err := h.cache.GetRecord(c.Request.Context(), tenant.Of(c), id)
+	sendRecord(c, record, err)
+}
+
+func (h *Handler) CreateRecord(c *gin.Context) {
+	var record RecordDTO
+
+	if err := validation.BindJSON(c, &record); err != nil {
+		validation.SendError(c, err)
+		return
+	}
+
+	result, err := h.service(c).Insert(c.Request.Context(), record)
+	if err != nil {
+		deadline.SendFailure(c, err, "unable to create record")
+		return
+	}
+	h.cache.Put(c.Request.Context(), *result)
+
+	c.Header("Location", path.Join(c.Request.URL.Path, result.Id.Hex()))
+	precondition.SetETag(c, result)
+	c.JSON(http.StatusCreated, result)
+}
+
+func (h *Handler) ReplaceRecord(c *gin.Context) {
+	id, ok := parseId(c)
+	if !ok {
+		return
+	}
+
+	var record RecordDTO
+
+	if err := validation.BindJSON(c, &record); err != nil {
+		validation.SendError(c, err)
+		return
+	}
+
+	ifMatch := precondition.ParseIfMatch(c)
+	result, err := h.service(c).Replace(c.Request.Context(), id, record, ifMatch.Versions)
+	if ifMatch.Failed(err) {
+		c.JSON(http.StatusPreconditionFailed, api.ERROR_PRECONDITION_FAILED)
+		return
+	}
+	if errors.Is(err, db.ErrNotFound) {
+		c.JSON(http.StatusNotFound, api.ERROR_NOT_FOUND)
+		return
+	}
+	if err != nil {
+		deadline.SendFailure(c, err, "unable to replace record")
+		return
+	}
+	h.cache.Put(c.Request.Context(), *result)
+
+	sendRecord(c, result, nil)
+}
+
+func (h *Handler) PatchRecord(c *gin.Context) {
+	id, ok := parseId(c)
+	if !ok {
+		return
+	}
+
+	var patch PatchRecordDTO
+
+	if err := validation.BindJSON(c, &patch); err != nil {
+		validation.SendError(c, err)
+		return
+	}
+
+	ifMatch := precondition.ParseIfMatch(c)
+	if patch.Data == nil {
+		// nothing to write, the precondition is checked against the current record
+		record, err := h.service(c).GetById(c.Request.Context(), id)
+		if err == nil && !ifMatch.Matches(record) {
+			err = records.ErrVersionMismatch
+		}
+		if ifMatch.Failed(err) {
+			c.JSON(http.StatusPreconditionFailed, api.ERROR_PRECONDITION_FAILED)
+			return
+		}
+		sendRecord(c, record, err)
+		return
+	}
+
+	record, err := h.service(c).Update(c.Request.Context(), id, patch, ifMatch.Versions)
+	if ifMatch.Failed(err) {
+		c.JSON(http.StatusPreconditionFailed, api.ERROR_PRECONDITION_FAILED)
+		return
+	}
+	if err == nil {
+		h.cache.Put(c.Request.Context(), *record)
+	}
+	sendRecord(c, record, err)
+}
+
+func (h *Handler) DeleteRecord(c *gin.Context) {
+	id, ok := parseId(c)
+	if !ok {
+		return
+	}
+
+	ifMatch := precondition.ParseIfMatch(c)
+	deleted, err := h.service(c).Delete(c.Request.Context(), id, ifMatch.Versions)
+	if ifMatch.Failed(err) {
+		c.JSON(http.StatusPreconditionFailed, api.ERROR_PRECONDITION_FAILED)
+		return
+	}
+	if errors.Is(err, db.ErrNotFound) {
+		c.JSON(http.StatusNotFound, api.ERROR_NOT_FOUND)
+		return
+	}
+	if err != nil {
+		deadline.SendFailure(c, err, "unable to delete record")
+		return
+	}
+	h.cache.Remove(c.Request.Context(), tenant.Of(c), id, deleted.Version)
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) BulkRecords(c *gin.Context) {
+	var bulk BulkDTO
+
+	if err := validation.BindJSON(c, &bulk); err != nil {
+		validation.SendError(c, err)
+		return
+	}
+
+	operations := make([]records.BulkOperation, len(bulk.Operations))
+	for i, operation := range bulk.Operations {
+		operations[i] = records.BulkOperation{Type: operation.Op, Id: operation.Id, Data: operation.Data}
+	}
+	ordered := bulk.Ordered == nil || *bulk.Ordered
+
+	result, err := h.service(c).Bulk(c.Request.Context(), operations, ordered)
+	if errors.Is(err, records.ErrBulkEmpty) {
+		c.JSON(http.StatusBadRequest, api.ERROR_BULK_EMPTY)
+		return
+	}
+	if errors.Is(err, records.ErrBulkTooLarge) {
+		c.JSON(http.StatusBadRequest, api.ERROR_BULK_TOO_LARGE)
+		return
+	}
+	if err != nil {
+		deadline.SendFailure(c, err, "unable to execute bulk")
+		return
+	}
+	for _, record := range result.Written {
+		h.cache.Put(c.Request.Context(), record)
+	}
+	for _, record := range result.Deleted {
+		h.cache.Remove(c.Request.Context(), tenant.Of(c), record.Id, record.Version)
+	}
+
+	c.JSON(http.StatusOK, BulkResultDTO{Results: result.Results})
+}
+
+// BatchRecords replaces and deletes records, an atomic batch is all-or-nothing. A rolled back batch is reported
+// by 409 with the results of operations
+func (h *Handler) BatchRecords(c *gin.Context) {
+	var batch BatchDTO
+
+	if err := validation.BindJSON(c, &batch); err != nil {
+		validation.SendError(c, err)
+		return
+	}
+
+	operations := make([]records.BatchOperation, len(batch.Operations))
+	for i, operation := range batch.Operations {
+		operations[i] = records.BatchOperation{Type: operation.Op, Id: operation.Id, Data: operation.Data, Version: operation.Version}
+	}
+
+	result, err := h.service(c).Batch(c.Request.Context(), operations, batch.Atomic)
+	if errors.Is(err, records.ErrBulkEmpty) {
+		c.JSON(http.StatusBadRequest, api.ERROR_BULK_EMPTY)
+		return
+	}
+	if errors.Is(err, records.ErrBulkTooLarge) {
+		c.JSON(http.StatusBadRequest, api.ERROR_BULK_TOO_LARGE)
+		return
+	}
+	if errors.Is(err, db.ErrTransactionsUnsupported) {
+		c.JSON(http.StatusServiceUnavailable, api.ERROR_TRANSACTIONS_UNSUPPORTED)
+		return
+	}
+	if errors.Is(err, db.ErrTransactionConflict) {
+		c.JSON(http.StatusConflict, api.ERROR_TRANSACTION_CONFLICT)
+		return
+	}
+	if err != nil {
+		deadline.SendFailure(c, err, "unable to execute batch")
+		return
+	}
+	for _, record := range result.Written {
+		h.cache.Put(c.Request.Context(), record)
+	}
+	for _, record := range result.Deleted {
+		h.cache.Remove(c.Request.Context(), tenant.Of(c), record.Id, record.Version)
+	}
+
+	status := http.StatusOK
+	if result.RolledBack {
+		status = http.StatusConflict
+	}
+	c.JSON(status, BatchResultDTO{RolledBack: result.RolledBack, Results: result.Results})
+}
+
+func sendRecord(c *gin.Context, record *records.Record, err error) {
+	if errors.Is(err, db.ErrNotFound) {
+		c.JSON(http.StatusNotFound, api.ERROR_NOT_FOUND)
+		return
+	}
+	if err != nil {
+		deadline.SendFailure(c, err, "unable to get record")
+		return
+	}
+
+	precondition.SetETag(c, record)
+	c.JSON(http.StatusOK, record)
+}
+
+func parseId(c *gin.Context) (primitive.ObjectID, bool) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, api.ERROR_INVALID_ID)
+		return id, false
+	}
+	return id, true
+}
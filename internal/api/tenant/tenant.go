@@ -0,0 +1,32 @@
+package tenant
+
+import (
+	"strings"
+
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/records"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// TENANT_KEY is the key of the tenant of the request in the gin context, set by the authentication
+	TENANT_KEY    = "tenant"
+	TENANT_HEADER = "X-Tenant-ID"
+)
+
+// Of returns the tenant whose records the request reads and writes. The tenant chosen by the authentication
+// wins over the header, the requests of neither go to the default tenant
+func Of(c *gin.Context) string {
+	tenant, found := c.Get(TENANT_KEY)
+	if !found {
+		tenant = Requested(c)
+	}
+	if name, _ := tenant.(string); name != "" {
+		return name
+	}
+	return records.DEFAULT_TENANT
+}
+
+// Requested returns the tenant of the header, empty if there is no header
+func Requested(c *gin.Context) string {
+	return strings.TrimSpace(c.GetHeader(TENANT_HEADER))
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/ArtemVoronov/artforintrovert-test/internal/api"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/tracing"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 )
@@ -14,6 +15,13 @@ type ApiError struct {
 	Msg   string
 }
 
+// BindJSON parses the body of the request into obj within the span, so the decoding of large bodies shows up in the trace
+func BindJSON(c *gin.Context, obj interface{}) error {
+	_, span := tracing.Start(c.Request.Context(), "gin.BindJSON")
+	defer span.End()
+	return c.BindJSON(obj)
+}
+
 func SendError(c *gin.Context, err error) {
 	var ve validator.ValidationErrors
 	if errors.As(err, &ve) {
@@ -28,6 +36,11 @@ func SendError(c *gin.Context, err error) {
 	c.JSON(http.StatusBadRequest, api.ERROR_MESSAGE_PARSING_BODY_JSON)
 }
 
+// SendForbidden aborts the request with 403 in the same format as the validation errors
+func SendForbidden(c *gin.Context, field string, msg string) {
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"errors": []ApiError{{field, msg}}})
+}
+
 func message(tag string) string {
 	switch tag {
 	case "required":
@@ -10,64 +10,160 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/ArtemVoronov/artforintrovert-test/internal/api/deadline"
+	healthApi "github.com/ArtemVoronov/artforintrovert-test/internal/api/rest/health"
 	recordsApi "github.com/ArtemVoronov/artforintrovert-test/internal/api/rest/v1/records"
+	recordsApiV2 "github.com/ArtemVoronov/artforintrovert-test/internal/api/rest/v2/records"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/logging"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/auth"
 	"github.com/ArtemVoronov/artforintrovert-test/internal/services/cache"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/compression"
 	"github.com/ArtemVoronov/artforintrovert-test/internal/services/db"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/health"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/metrics"
 	"github.com/ArtemVoronov/artforintrovert-test/internal/services/records"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/tracing"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/trash"
 	"github.com/ArtemVoronov/artforintrovert-test/internal/utils"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"github.com/sirupsen/logrus"
 )
 
+// App is the application container: it owns every service instance and wires their dependencies explicitly
+type App struct {
+	db          db.MongoService
+	records     *records.Service
+	cache       *cache.Service
+	compression *compression.Service
+	trash       *trash.Service
+	auth        *auth.Service
+	metrics     *metrics.Service
+	health      *health.Service
+	tracing     *tracing.Service
+	log         *logrus.Logger
+}
+
 func Start() {
-	setup()
-	defer Shutdown()
+	loadEnv()
+	app, err := Create()
+	if err != nil {
+		log.Fatalf("Unable to setup app: %v\n", err)
+	}
+	if !app.auth.Enabled() {
+		app.log.Warn("authentication is disabled, the API is open to anyone")
+	}
+	defer app.Shutdown()
+	defer redirectStdLog(app.log)()
+	app.cache.Start()
+	app.trash.Start()
+
 	srv := &http.Server{
 		Addr:    host(),
-		Handler: router(),
+		Handler: router(app.log, app.compression, app.auth, app.metrics, app.tracing, healthApi.CreateHandler(app.health), recordsApi.CreateHandler(app.records, app.cache), recordsApiV2.CreateHandler(app.records, app.cache)),
 	}
 
 	go func() {
-		log.Printf("App starting at localhost%s ...\n", srv.Addr)
+		app.log.Infof("App starting at localhost%s ...", srv.Addr)
 		err := srv.ListenAndServe()
 		if err != nil && errors.Is(err, http.ErrServerClosed) {
-			log.Println("Server was closed")
+			app.log.Info("Server was closed")
 		} else if err != nil {
-			log.Fatalf("Unable to start app: %v\n", err)
+			app.log.Fatalf("Unable to start app: %v", err)
 		}
 	}()
 
-	quit := make(chan os.Signal)
+	quit := make(chan os.Signal, 1)
 	// kill (no param) default send syscall.SIGTERM
 	// kill -2 is syscall.SIGINT
 	// kill -9 is syscall.SIGKILL but can't be caught, so don't need to add it
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
-	log.Println("Shutting down server ...")
+	app.log.Info("Shutting down server ...")
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	err := srv.Shutdown(ctx)
+	err = srv.Shutdown(ctx)
 	if err != nil {
-		log.Fatal("Server forced to shutdown:", err)
+		app.log.Fatalf("Server forced to shutdown: %v", err)
 	}
 
-	log.Println("Server has been shutdown")
+	app.log.Info("Server has been shutdown")
 }
 
-func setup() {
-	loadEnv()
-	db.Instance()
-	cache.Instance()
-	records.Instance()
+func Create() (*App, error) {
+	logger, err := logging.Create(logging.LoadConfig())
+	if err != nil {
+		return nil, err
+	}
+	// the tracing goes first, it installs the tracer provider used by the db and records services
+	tracingService, err := tracing.CreateService(logging.Component(logger, "tracing"), tracing.LoadConfig())
+	if err != nil {
+		return nil, err
+	}
+	metricsService := metrics.CreateService(metrics.LoadConfig())
+	var dbService db.MongoService
+	dbService, err = db.CreateService(logging.Component(logger, "db"), db.LoadConfig())
+	if err != nil {
+		return nil, err
+	}
+	if metricsService.Enabled() {
+		dbService = db.Observe(dbService, metricsService)
+	}
+	recordsService := records.CreateService(dbService, logging.Component(logger, "records"), records.LoadConfig())
+	err = recordsService.Setup(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	compressionService, err := compression.CreateService(compression.LoadConfig())
+	if err != nil {
+		return nil, err
+	}
+	cacheService := cache.CreateService(recordsService, compressionService, logging.Component(logger, "cache"), cache.LoadConfig())
+	metricsService.RegisterCache(cacheService.Stats)
+	healthService := health.CreateService(dbService, cacheService.Stats, health.LoadConfig())
+	trashService := trash.CreateService(recordsService, logging.Component(logger, "trash"), trash.LoadConfig())
+	authService, err := auth.CreateService(auth.LoadConfig())
+	if err != nil {
+		return nil, err
+	}
 
+	return &App{
+		db:          dbService,
+		records:     recordsService,
+		cache:       cacheService,
+		compression: compressionService,
+		trash:       trashService,
+		auth:        authService,
+		metrics:     metricsService,
+		health:      healthService,
+		tracing:     tracingService,
+		log:         logger,
+	}, nil
 }
-func Shutdown() {
-	db.Instance().ShutDown()
-	cache.Instance().ShutDown()
-	records.Instance().ShutDown()
+
+func (a *App) Shutdown() {
+	a.trash.ShutDown()
+	a.cache.ShutDown()
+	a.records.ShutDown()
+	a.db.ShutDown()
+	a.tracing.ShutDown()
+}
+
+// redirectStdLog sends the lines of the standard log, like the ones of the libraries, to the logger with the info level.
+// Returns the function restoring the standard log
+func redirectStdLog(logger *logrus.Logger) func() {
+	writer := logger.WriterLevel(logrus.InfoLevel)
+	flags, output := log.Flags(), log.Writer()
+	log.SetFlags(0)
+	log.SetOutput(writer)
+	return func() {
+		log.SetFlags(flags)
+		log.SetOutput(output)
+		writer.Close()
+	}
 }
 
 func loadEnv() {
@@ -87,16 +183,56 @@ func mode() string {
 	return utils.EnvVarDefault("APP_MODE", "debug")
 }
 
-func router() *gin.Engine {
-	router := gin.Default()
+// requestTimeout is the maximum timeout of the requests, the clients may ask for a shorter one
+func requestTimeout() time.Duration {
+	value := utils.EnvVarIntDefault("REQUEST_TIMEOUT_MAX_IN_SECONDS", "30")
+	return time.Duration(value) * time.Second
+}
+
+func router(logger *logrus.Logger, compressionService *compression.Service, authService *auth.Service, metricsService *metrics.Service, tracingService *tracing.Service, healthHandler *healthApi.Handler, recordsHandler *recordsApi.Handler, recordsHandlerV2 *recordsApiV2.Handler) *gin.Engine {
+	router := gin.New()
 	gin.SetMode(mode())
+	router.Use(gin.Recovery())
+	router.Use(logging.Middleware(logger))
 	router.Use(cors())
-	router.Use(gin.Logger())
-
-	v1 := router.Group("/api/v1")
-	v1.GET("/records/", recordsApi.GetRecords)
-	v1.PUT("/records/", recordsApi.UpdateRecord)
-	v1.DELETE("/records/", recordsApi.DeleteRecord)
+	// the probes are registered before the metrics and the compression, they are neither counted nor compressed
+	router.GET("/healthz", healthHandler.Live)
+	router.GET("/readyz", healthHandler.Ready)
+	if metricsService.Enabled() {
+		router.Use(metricsService.Middleware())
+		// outside of the authenticated groups, the scrapers have no credentials
+		router.GET(metricsService.Path(), metricsService.Handler())
+	}
+	// the probes and the scrapes are not traced
+	if tracingService.Enabled() {
+		router.Use(tracingService.Middleware())
+	}
+	router.Use(deadline.Middleware(requestTimeout()))
+	router.Use(compressionService.Middleware())
+
+	reader := authService.Require(auth.ROLE_READER)
+	writer := authService.Require(auth.ROLE_WRITER)
+	admin := authService.Require(auth.ROLE_ADMIN)
+
+	v1 := router.Group("/api/v1", authService.Middleware())
+	v1.GET("/records/", reader, recordsHandler.GetRecords)
+	v1.GET("/records/:id", reader, recordsHandler.GetRecord)
+	v1.PUT("/records/", writer, recordsHandler.UpdateRecord)
+	v1.DELETE("/records/", writer, recordsHandler.DeleteRecord)
+
+	v2 := router.Group("/api/v2", authService.Middleware())
+	v2.GET("/records/", reader, recordsHandlerV2.GetRecords)
+	v2.POST("/records/", writer, recordsHandlerV2.CreateRecord)
+	v2.POST("/records/bulk", writer, recordsHandlerV2.BulkRecords)
+	v2.POST("/records/batch", writer, recordsHandlerV2.BatchRecords)
+	v2.GET("/records/trash", admin, recordsHandlerV2.GetTrash)
+	v2.POST("/records/trash/:id/restore", admin, recordsHandlerV2.RestoreRecord)
+	v2.GET("/records/:id/history", reader, recordsHandlerV2.GetHistory)
+	v2.POST("/records/:id/revert", writer, recordsHandlerV2.RevertRecord)
+	v2.GET("/records/:id", reader, recordsHandlerV2.GetRecord)
+	v2.PUT("/records/:id", writer, recordsHandlerV2.ReplaceRecord)
+	v2.PATCH("/records/:id", writer, recordsHandlerV2.PatchRecord)
+	v2.DELETE("/records/:id", writer, recordsHandlerV2.DeleteRecord)
 
 	return router
 }
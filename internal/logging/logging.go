@@ -0,0 +1,74 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// LOGGER_KEY is the key of the logger of the request in the gin context
+	LOGGER_KEY = "logger"
+
+	COMPONENT_FIELD  = "component"
+	REQUEST_ID_FIELD = "request_id"
+)
+
+// Create returns the root logger writing to stderr
+func Create(config Config) (*logrus.Logger, error) {
+	level, err := logrus.ParseLevel(config.Level)
+	if err != nil || level < logrus.ErrorLevel || level > logrus.DebugLevel {
+		return nil, fmt.Errorf("unsupported log level: '%v'", config.Level)
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(os.Stderr)
+	logger.SetLevel(level)
+	switch config.Format {
+	case FORMAT_JSON:
+		logger.SetFormatter(&logrus.JSONFormatter{})
+	case FORMAT_LOGFMT:
+		logger.SetFormatter(&logrus.TextFormatter{DisableColors: true, FullTimestamp: true})
+	default:
+		return nil, fmt.Errorf("unsupported log format: '%v'", config.Format)
+	}
+	return logger, nil
+}
+
+type requestIdKey struct{}
+
+// WithRequestId returns the context carrying the request id, see With
+func WithRequestId(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIdKey{}, id)
+}
+
+// With returns the logger with the request id of the context, the logger itself if the context has none
+func With(ctx context.Context, logger *logrus.Entry) *logrus.Entry {
+	if id, ok := ctx.Value(requestIdKey{}).(string); ok && id != "" {
+		return logger.WithField(REQUEST_ID_FIELD, id)
+	}
+	return logger
+}
+
+// Component returns the logger of the lines of the component, like db or cache
+func Component(logger *logrus.Logger, component string) *logrus.Entry {
+	return logger.WithField(COMPONENT_FIELD, component)
+}
+
+// Default returns the logger of the component writing with the default settings, for the services created
+// without the app, like in tests
+func Default(component string) *logrus.Entry {
+	return Component(logrus.StandardLogger(), component)
+}
+
+// Of returns the logger of the request, its lines have the request id. Without Middleware it is the default logger
+func Of(c *gin.Context) *logrus.Entry {
+	value, found := c.Get(LOGGER_KEY)
+	if entry, ok := value.(*logrus.Entry); found && ok {
+		return entry
+	}
+	return Default("api").WithField(REQUEST_ID_FIELD, RequestIdOf(c))
+}
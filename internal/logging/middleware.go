@@ -0,0 +1,92 @@
+package logging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	REQUEST_ID_HEADER = "X-Request-ID"
+	// REQUEST_ID_KEY is the key of the request id in the gin context
+	REQUEST_ID_KEY = "requestId"
+	// MAX_REQUEST_ID_LENGTH limits the ids of the clients, the longer ones and the ones with unprintable characters are replaced
+	MAX_REQUEST_ID_LENGTH = 128
+)
+
+// Middleware takes the request id of the X-Request-ID header or generates one, sends it back in the same header
+// and puts the logger with the id in the gin context, see Of, and the id in the context of the request, see With. When the request is done, it writes the access line:
+// the error level for 5xx responses, the warn level for 4xx and the info one otherwise
+func Middleware(logger *logrus.Logger) gin.HandlerFunc {
+	access := Component(logger, "api")
+	return func(c *gin.Context) {
+		start := time.Now()
+		id := c.GetHeader(REQUEST_ID_HEADER)
+		if !validRequestId(id) {
+			id = generateRequestId()
+		}
+		entry := access.WithField(REQUEST_ID_FIELD, id)
+		c.Set(REQUEST_ID_KEY, id)
+		c.Set(LOGGER_KEY, entry)
+		c.Header(REQUEST_ID_HEADER, id)
+		c.Request = c.Request.WithContext(WithRequestId(c.Request.Context(), id))
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = c.Request.URL.Path
+		}
+		status := c.Writer.Status()
+		fields := entry.WithFields(logrus.Fields{
+			"method":     c.Request.Method,
+			"route":      route,
+			"status":     status,
+			"latency_ms": float64(time.Since(start).Microseconds()) / 1000,
+			"bytes":      c.Writer.Size(),
+			"client_ip":  c.ClientIP(),
+		})
+		switch {
+		case status >= 500:
+			fields.Error("request")
+		case status >= 400:
+			fields.Warn("request")
+		default:
+			fields.Info("request")
+		}
+	}
+}
+
+// RequestIdOf returns the id of the request, the one of the header without Middleware
+func RequestIdOf(c *gin.Context) string {
+	if id := c.GetString(REQUEST_ID_KEY); id != "" {
+		return id
+	}
+	return c.GetHeader(REQUEST_ID_HEADER)
+}
+
+func validRequestId(id string) bool {
+	if id == "" || len(id) > MAX_REQUEST_ID_LENGTH {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func generateRequestId() string {
+	id := make([]byte, 16)
+	_, err := rand.Read(id)
+	if err != nil {
+		// the system randomness is never expected to fail, the time is unique enough for the correlation
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(id)
+}
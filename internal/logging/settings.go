@@ -0,0 +1,26 @@
+package logging
+
+import (
+	"strings"
+
+	"github.com/ArtemVoronov/artforintrovert-test/internal/utils"
+)
+
+const (
+	FORMAT_LOGFMT = "logfmt"
+	FORMAT_JSON   = "json"
+)
+
+type Config struct {
+	// Level is one of debug, info, warn and error, the lines of lower levels are dropped
+	Level string
+	// Format is FORMAT_LOGFMT or FORMAT_JSON
+	Format string
+}
+
+func LoadConfig() Config {
+	return Config{
+		Level:  strings.ToLower(utils.EnvVarDefault("LOG_LEVEL", "info")),
+		Format: strings.ToLower(utils.EnvVarDefault("LOG_FORMAT", FORMAT_LOGFMT)),
+	}
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// apiKeyAuthenticator knows only the SHA-256 of the keys, so the config does not leak them. The keys are random
+// secrets rather than passwords, a fast hash is enough for them
+type apiKeyAuthenticator struct {
+	names   map[[sha256.Size]byte]string
+	roles   map[string][]string
+	tenants map[string]string
+}
+
+func createApiKeyAuthenticator(entries []string, roleEntries []string, tenantEntries []string) (*apiKeyAuthenticator, error) {
+	roles, err := roleMapping(roleEntries)
+	if err != nil {
+		return nil, err
+	}
+	tenants := make(map[string]string, len(tenantEntries))
+	for _, entry := range tenantEntries {
+		separator := strings.LastIndex(entry, ":")
+		if separator < 1 || separator == len(entry)-1 {
+			return nil, fmt.Errorf("invalid tenant entry '%v': expected 'name:tenant'", entry)
+		}
+		tenants[entry[:separator]] = entry[separator+1:]
+	}
+	a := &apiKeyAuthenticator{names: make(map[[sha256.Size]byte]string, len(entries)), roles: roles, tenants: tenants}
+	for _, entry := range entries {
+		separator := strings.LastIndex(entry, ":")
+		if separator < 1 {
+			return nil, fmt.Errorf("invalid API key entry: expected 'name:sha256'")
+		}
+		name := entry[:separator]
+		decoded, err := hex.DecodeString(entry[separator+1:])
+		if err != nil || len(decoded) != sha256.Size {
+			return nil, fmt.Errorf("invalid hash of API key '%v': expected %v bytes in hex", name, sha256.Size)
+		}
+		var hash [sha256.Size]byte
+		copy(hash[:], decoded)
+		a.names[hash] = name
+	}
+	if len(a.names) == 0 {
+		return nil, fmt.Errorf("API key authentication requires at least one key")
+	}
+	return a, nil
+}
+
+func (a *apiKeyAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	key := r.Header.Get(API_KEY_HEADER)
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+	name, ok := a.names[sha256.Sum256([]byte(key))]
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	return &Principal{Id: name, Method: METHOD_API_KEY, Roles: a.roles[name], Tenant: a.tenants[name]}, nil
+}
@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+const (
+	METHOD_API_KEY = "apikey"
+	METHOD_JWT     = "jwt"
+
+	API_KEY_HEADER = "X-API-Key"
+	// PRINCIPAL_KEY is the key of the authenticated *Principal in the gin context
+	PRINCIPAL_KEY = "principal"
+)
+
+// ErrNoCredentials means that the request has no credentials of the method, the next method is tried
+var ErrNoCredentials = errors.New("no credentials")
+
+// ErrInvalidCredentials means that the request has credentials of the method, but they are wrong or expired
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Principal is who makes the request
+type Principal struct {
+	Id     string
+	Method string
+	Roles  []string
+	// Tenant binds the principal to the records of the tenant, the admins without a tenant may choose any
+	Tenant string
+}
+
+// Authenticator is one authentication method. Returns ErrNoCredentials if the request has no credentials of the method
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+type Service struct {
+	authenticators []Authenticator
+	defaultRole    string
+}
+
+func CreateService(config Config) (*Service, error) {
+	if config.DefaultRole != "" && !validRole(config.DefaultRole) {
+		return nil, fmt.Errorf("unknown default role: '%v'", config.DefaultRole)
+	}
+	s := &Service{defaultRole: config.DefaultRole}
+	for _, method := range config.Methods {
+		var authenticator Authenticator
+		var err error
+		switch method {
+		case METHOD_API_KEY:
+			authenticator, err = createApiKeyAuthenticator(config.APIKeys, config.APIKeyRoles, config.APIKeyTenants)
+		case METHOD_JWT:
+			authenticator, err = createJwtAuthenticator(config)
+		default:
+			err = fmt.Errorf("unsupported authentication method: '%v'", method)
+		}
+		if err != nil {
+			return nil, err
+		}
+		s.authenticators = append(s.authenticators, authenticator)
+	}
+	return s, nil
+}
+
+// Enabled tells if the requests have to be authenticated
+func (s *Service) Enabled() bool {
+	return len(s.authenticators) != 0
+}
+
+// Authenticate tries the methods in the order. Returns ErrNoCredentials if the request has no credentials of any method
+func (s *Service) Authenticate(r *http.Request) (*Principal, error) {
+	for _, authenticator := range s.authenticators {
+		principal, err := authenticator.Authenticate(r)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		if err == nil && len(principal.Roles) == 0 && s.defaultRole != "" {
+			principal.Roles = []string{s.defaultRole}
+		}
+		return principal, err
+	}
+	return nil, ErrNoCredentials
+}
@@ -0,0 +1,220 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	ALGORITHM_HS256 = "HS256"
+	ALGORITHM_RS256 = "RS256"
+
+	BEARER_PREFIX = "Bearer "
+
+	DEFAULT_ROLES_CLAIM  = "roles"
+	DEFAULT_TENANT_CLAIM = "tenant"
+)
+
+// jwtAuthenticator verifies the bearer tokens signed with one algorithm. The keys are loaded once at the start
+type jwtAuthenticator struct {
+	algorithm string
+	// fileKey is the key of the key file, it verifies the tokens of any kid. keys are the ones of the JWKS file by kid
+	fileKey     interface{}
+	keys        map[string]interface{}
+	issuer      string
+	audience    string
+	rolesClaim  string
+	tenantClaim string
+	// roleMapping maps the values of the roles claim to the roles, nil takes the values as they are
+	roleMapping map[string][]string
+}
+
+// jwks is the JSON Web Key Set, only the fields of RSA and symmetric keys
+type jwks struct {
+	Keys []struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Alg string `json:"alg"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+		K   string `json:"k"`
+	} `json:"keys"`
+}
+
+func createJwtAuthenticator(config Config) (*jwtAuthenticator, error) {
+	if config.JWTAlgorithm != ALGORITHM_HS256 && config.JWTAlgorithm != ALGORITHM_RS256 {
+		return nil, fmt.Errorf("unsupported JWT algorithm: '%v'", config.JWTAlgorithm)
+	}
+	a := &jwtAuthenticator{
+		algorithm:   config.JWTAlgorithm,
+		keys:        make(map[string]interface{}),
+		issuer:      config.JWTIssuer,
+		audience:    config.JWTAudience,
+		rolesClaim:  config.JWTRolesClaim,
+		tenantClaim: config.JWTTenantClaim,
+	}
+	if a.rolesClaim == "" {
+		a.rolesClaim = DEFAULT_ROLES_CLAIM
+	}
+	if a.tenantClaim == "" {
+		a.tenantClaim = DEFAULT_TENANT_CLAIM
+	}
+	if len(config.JWTRoleMapping) != 0 {
+		mapping, err := roleMapping(config.JWTRoleMapping)
+		if err != nil {
+			return nil, err
+		}
+		a.roleMapping = mapping
+	}
+
+	var err error
+	switch {
+	case config.JWTJWKSFile != "":
+		err = a.loadJWKS(config.JWTJWKSFile)
+	case config.JWTKeyFile != "":
+		err = a.loadKeyFile(config.JWTKeyFile)
+	default:
+		err = fmt.Errorf("JWT authentication requires the key file or the JWKS file")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *jwtAuthenticator) loadKeyFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to read JWT key file. Error: %v", err)
+	}
+	if a.algorithm == ALGORITHM_HS256 {
+		secret := bytes.TrimSpace(content)
+		if len(secret) == 0 {
+			return fmt.Errorf("JWT key file is empty")
+		}
+		a.fileKey = secret
+		return nil
+	}
+	key, err := jwt.ParseRSAPublicKeyFromPEM(content)
+	if err != nil {
+		return fmt.Errorf("unable to parse JWT public key. Error: %v", err)
+	}
+	a.fileKey = key
+	return nil
+}
+
+func (a *jwtAuthenticator) loadJWKS(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to read JWKS file. Error: %v", err)
+	}
+	var set jwks
+	err = json.Unmarshal(content, &set)
+	if err != nil {
+		return fmt.Errorf("unable to parse JWKS file. Error: %v", err)
+	}
+	for _, key := range set.Keys {
+		if key.Alg != "" && key.Alg != a.algorithm {
+			continue
+		}
+		switch {
+		case a.algorithm == ALGORITHM_RS256 && key.Kty == "RSA":
+			n, err := base64.RawURLEncoding.DecodeString(key.N)
+			if err != nil {
+				return fmt.Errorf("invalid modulus of JWK '%v'. Error: %v", key.Kid, err)
+			}
+			e, err := base64.RawURLEncoding.DecodeString(key.E)
+			if err != nil || len(e) == 0 {
+				return fmt.Errorf("invalid exponent of JWK '%v'", key.Kid)
+			}
+			a.keys[key.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case a.algorithm == ALGORITHM_HS256 && key.Kty == "oct":
+			secret, err := base64.RawURLEncoding.DecodeString(key.K)
+			if err != nil || len(secret) == 0 {
+				return fmt.Errorf("invalid secret of JWK '%v'", key.Kid)
+			}
+			a.keys[key.Kid] = secret
+		}
+	}
+	if len(a.keys) == 0 {
+		return fmt.Errorf("JWKS file has no %v keys", a.algorithm)
+	}
+	return nil
+}
+
+func (a *jwtAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, BEARER_PREFIX) {
+		return nil, ErrNoCredentials
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(strings.TrimPrefix(header, BEARER_PREFIX), claims, a.key, jwt.WithValidMethods([]string{a.algorithm}))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	if a.issuer != "" && !claims.VerifyIssuer(a.issuer, true) {
+		return nil, fmt.Errorf("%w: unexpected issuer", ErrInvalidCredentials)
+	}
+	if a.audience != "" && !claims.VerifyAudience(a.audience, true) {
+		return nil, fmt.Errorf("%w: unexpected audience", ErrInvalidCredentials)
+	}
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return nil, fmt.Errorf("%w: missed subject", ErrInvalidCredentials)
+	}
+	tenant, _ := claims[a.tenantClaim].(string)
+	return &Principal{Id: subject, Method: METHOD_JWT, Roles: a.roles(claims[a.rolesClaim]), Tenant: tenant}, nil
+}
+
+// roles maps the value of the roles claim, the unknown values are ignored
+func (a *jwtAuthenticator) roles(claim interface{}) []string {
+	values := make([]string, 0)
+	switch typed := claim.(type) {
+	case string:
+		values = append(values, strings.Fields(typed)...)
+	case []interface{}:
+		for _, value := range typed {
+			if role, ok := value.(string); ok {
+				values = append(values, role)
+			}
+		}
+	}
+
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if a.roleMapping != nil {
+			result = append(result, a.roleMapping[value]...)
+		} else if validRole(value) {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// key returns the key of the key file whatever the kid of the token is. With the JWKS file it chooses the key
+// by the kid, the only key is used for the tokens without kid
+func (a *jwtAuthenticator) key(token *jwt.Token) (interface{}, error) {
+	if a.fileKey != nil {
+		return a.fileKey, nil
+	}
+	kid, _ := token.Header["kid"].(string)
+	if key, ok := a.keys[kid]; ok {
+		return key, nil
+	}
+	if kid == "" && len(a.keys) == 1 {
+		for _, key := range a.keys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown key '%v'", kid)
+}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/ArtemVoronov/artforintrovert-test/internal/api"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/api/audit"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/api/tenant"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/api/validation"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/logging"
+	"github.com/gin-gonic/gin"
+)
+
+// Middleware rejects the requests without valid credentials with 401. The principal of the accepted ones
+// is put in the gin context, see PrincipalOf, and so is the tenant of the request, see tenant.Of
+func (s *Service) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !s.Enabled() {
+			c.Next()
+			return
+		}
+
+		principal, err := s.Authenticate(c.Request)
+		if err != nil {
+			c.Header("WWW-Authenticate", "Bearer")
+			if errors.Is(err, ErrNoCredentials) {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, api.ERROR_MISSED_CREDENTIALS)
+				return
+			}
+			if errors.Is(err, ErrInvalidCredentials) {
+				logging.Of(c).WithError(err).Warn("request with invalid credentials")
+			} else {
+				logging.Of(c).WithError(err).Error("unable to authenticate request")
+			}
+			c.AbortWithStatusJSON(http.StatusUnauthorized, api.ERROR_INVALID_CREDENTIALS)
+			return
+		}
+
+		requested := tenant.Requested(c)
+		switch {
+		case requested == "" || requested == principal.Tenant:
+			c.Set(tenant.TENANT_KEY, principal.Tenant)
+		case principal.Tenant == "" && principal.Has(ROLE_ADMIN):
+			c.Set(tenant.TENANT_KEY, requested)
+		default:
+			validation.SendForbidden(c, "tenant", api.ERROR_TENANT_FORBIDDEN)
+			return
+		}
+
+		c.Set(PRINCIPAL_KEY, principal)
+		c.Set(audit.ACTOR_KEY, principal.Id)
+		c.Next()
+	}
+}
+
+// Require rejects the requests of the principals without the role with 403. It goes after Middleware,
+// with the authentication disabled every request passes
+func (s *Service) Require(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !s.Enabled() {
+			c.Next()
+			return
+		}
+
+		principal := PrincipalOf(c)
+		if principal == nil || !principal.Has(role) {
+			validation.SendForbidden(c, "role", fmt.Sprintf(api.ERROR_FORBIDDEN, role))
+			return
+		}
+		c.Next()
+	}
+}
+
+// PrincipalOf returns the authenticated principal of the request, nil if the authentication is disabled
+func PrincipalOf(c *gin.Context) *Principal {
+	value, ok := c.Get(PRINCIPAL_KEY)
+	if !ok {
+		return nil
+	}
+	principal, _ := value.(*Principal)
+	return principal
+}
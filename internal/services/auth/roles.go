@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	ROLE_READER = "reader"
+	ROLE_WRITER = "writer"
+	ROLE_ADMIN  = "admin"
+)
+
+// levels orders the roles, a role grants everything of the lower ones
+var levels = map[string]int{
+	ROLE_READER: 1,
+	ROLE_WRITER: 2,
+	ROLE_ADMIN:  3,
+}
+
+func validRole(role string) bool {
+	_, ok := levels[role]
+	return ok
+}
+
+// Has tells if any role of the principal grants the role
+func (p *Principal) Has(role string) bool {
+	for _, granted := range p.Roles {
+		if levels[granted] >= levels[role] {
+			return true
+		}
+	}
+	return false
+}
+
+// roleMapping parses the entries "key:role" to the roles of every key
+func roleMapping(entries []string) (map[string][]string, error) {
+	result := make(map[string][]string, len(entries))
+	for _, entry := range entries {
+		separator := strings.LastIndex(entry, ":")
+		if separator < 1 {
+			return nil, fmt.Errorf("invalid role entry '%v': expected 'name:role'", entry)
+		}
+		key, role := entry[:separator], entry[separator+1:]
+		if !validRole(role) {
+			return nil, fmt.Errorf("unknown role '%v': expected one of %v, %v, %v", role, ROLE_READER, ROLE_WRITER, ROLE_ADMIN)
+		}
+		result[key] = append(result[key], role)
+	}
+	return result, nil
+}
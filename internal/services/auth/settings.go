@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"strings"
+
+	"github.com/ArtemVoronov/artforintrovert-test/internal/utils"
+)
+
+type Config struct {
+	// Methods are the accepted authentication methods tried in the order, empty disables the authentication
+	Methods []string
+	// APIKeys are the entries "name:sha256 of the key in hex", the name is the principal of the key
+	APIKeys []string
+	// JWTAlgorithm is HS256 or RS256
+	JWTAlgorithm string
+	// JWTKeyFile has the HS256 secret or the RS256 public key in PEM
+	JWTKeyFile string
+	// JWTJWKSFile has the JSON Web Key Set, the key is chosen by the kid of the token. Used instead of JWTKeyFile
+	JWTJWKSFile string
+	// JWTIssuer is the required iss claim, empty skips the check
+	JWTIssuer string
+	// JWTAudience is the required aud claim, empty skips the check
+	JWTAudience string
+	// APIKeyRoles are the entries "name:role" granting the role to the API key of the name
+	APIKeyRoles []string
+	// JWTRolesClaim is the claim with the roles of the token, a string or an array of strings
+	JWTRolesClaim string
+	// JWTRoleMapping are the entries "claim value:role", empty takes the claim values as the role names
+	JWTRoleMapping []string
+	// DefaultRole is granted to the principals without roles, empty grants nothing
+	DefaultRole string
+	// APIKeyTenants are the entries "name:tenant" binding the API key of the name to the tenant
+	APIKeyTenants []string
+	// JWTTenantClaim is the claim with the tenant of the token
+	JWTTenantClaim string
+}
+
+func LoadConfig() Config {
+	return Config{
+		Methods:        list(utils.EnvVarDefault("AUTH_METHODS", "")),
+		APIKeys:        list(utils.EnvVarDefault("AUTH_API_KEYS", "")),
+		JWTAlgorithm:   utils.EnvVarDefault("AUTH_JWT_ALGORITHM", ALGORITHM_HS256),
+		JWTKeyFile:     utils.EnvVarDefault("AUTH_JWT_KEY_FILE", ""),
+		JWTJWKSFile:    utils.EnvVarDefault("AUTH_JWT_JWKS_FILE", ""),
+		JWTIssuer:      utils.EnvVarDefault("AUTH_JWT_ISSUER", ""),
+		JWTAudience:    utils.EnvVarDefault("AUTH_JWT_AUDIENCE", ""),
+		APIKeyRoles:    list(utils.EnvVarDefault("AUTH_API_KEY_ROLES", "")),
+		JWTRolesClaim:  utils.EnvVarDefault("AUTH_JWT_ROLES_CLAIM", DEFAULT_ROLES_CLAIM),
+		JWTRoleMapping: list(utils.EnvVarDefault("AUTH_JWT_ROLE_MAPPING", "")),
+		DefaultRole:    utils.EnvVarDefault("AUTH_DEFAULT_ROLE", ""),
+		APIKeyTenants:  list(utils.EnvVarDefault("AUTH_API_KEY_TENANTS", "")),
+		JWTTenantClaim: utils.EnvVarDefault("AUTH_JWT_TENANT_CLAIM", DEFAULT_TENANT_CLAIM),
+	}
+}
+
+func list(value string) []string {
+	result := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
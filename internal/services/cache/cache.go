@@ -1,127 +1,455 @@
 package cache
 
 import (
-	"log"
+	"context"
+	"net/http"
 	"sync"
 	"time"
 
+	"github.com/ArtemVoronov/artforintrovert-test/internal/api"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/logging"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/compression"
 	"github.com/ArtemVoronov/artforintrovert-test/internal/services/records"
-	"github.com/ArtemVoronov/artforintrovert-test/internal/utils"
 	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type CacheService interface {
 	ShutDown()
-	RecordsCacheToJSON(c *gin.Context)
+	RecordsCacheToJSON(c *gin.Context, tenant string, status int)
+	GetRecord(ctx context.Context, tenant string, id primitive.ObjectID) (*records.Record, error)
+	Find(ctx context.Context, tenant string, q records.Query) (records.Page, error)
+	Put(ctx context.Context, record records.Record)
+	Remove(ctx context.Context, tenant string, id primitive.ObjectID, version int64)
+}
+
+// cacheOp is a write applied to the cache while a reload is in progress. The reload result may have been read
+// from the database before the write, so such writes are replayed over it
+type cacheOp struct {
+	record  records.Record
+	removed bool
+}
+
+// tombstone keeps the version of the removed record, so a write older than the delete does not put it back
+type tombstone struct {
+	version int64
+	at      time.Time
+}
+
+type tenantChange struct {
+	generation uint64
+	at         time.Time
 }
 
 type Service struct {
+	records      records.RecordsService
 	quit         chan struct{}
 	recordsCache *[]records.Record
-	rwm          sync.RWMutex
+	recordsIndex map[primitive.ObjectID]int
+	lastSync     time.Time
+	live         bool
+	// syncDelay is the current delay between the syncs, syncFailures is the number of the syncs failed in a row
+	syncDelay    time.Duration
+	syncFailures int
+	resumeToken  bson.Raw
+	// stopped waits for the change stream to store its resume token on shut down
+	stopped    sync.WaitGroup
+	reloading  int
+	journal    []cacheOp
+	tombstones map[primitive.ObjectID]tombstone
+	// changes holds the latest change of every tenant
+	changes map[string]tenantChange
+	rwm     sync.RWMutex
+
+	// views and snapshots hold *view and *snapshot of every tenant unchanged since their build. snapshotMutex serializes the builds
+	// and guards published, the latest built snapshot of every tenant
+	views         sync.Map
+	snapshots     sync.Map
+	snapshotMutex sync.Mutex
+	published     map[string]*snapshot
+
+	// refreshMutex serializes reloads and incremental syncs, it guards the fields below
+	refreshMutex  sync.Mutex
+	changesSince  time.Time
+	lastReload    time.Time
+	reloadStarted time.Time
 
-	minDelay    time.Duration
-	maxDelay    time.Duration
-	factorDelay time.Duration
+	syncMode           string
+	minDelay           time.Duration
+	maxDelay           time.Duration
+	factorDelay        time.Duration
+	maxStaleness       time.Duration
+	fullReloadInterval time.Duration
+	instanceId         string
+	resumeTokenSave    time.Duration
+	compression        compression.CompressionService
+	log                *logrus.Entry
 }
 
-var once sync.Once
-var instance *Service
+func CreateService(recordsService records.RecordsService, compressionService compression.CompressionService, logger *logrus.Entry, config Config) *Service {
+	return &Service{
+		records:            recordsService,
+		quit:               make(chan struct{}),
+		recordsCache:       &[]records.Record{},
+		recordsIndex:       make(map[primitive.ObjectID]int),
+		changes:            make(map[string]tenantChange),
+		tombstones:         make(map[primitive.ObjectID]tombstone),
+		published:          make(map[string]*snapshot),
+		syncDelay:          config.MinDelay,
+		syncMode:           config.SyncMode,
+		minDelay:           config.MinDelay,
+		maxDelay:           config.MaxDelay,
+		factorDelay:        config.FactorDelay,
+		maxStaleness:       config.MaxStaleness,
+		fullReloadInterval: config.FullReloadInterval,
+		instanceId:         config.InstanceId,
+		resumeTokenSave:    config.ResumeTokenSaveInterval,
+		compression:        compressionService,
+		log:                logger,
+	}
+}
 
-func Instance() *Service {
-	once.Do(func() {
-		if instance == nil {
-			instance = createService()
-			instance.setup()
-			instance.startSync()
-		}
-	})
-	return instance
+func (s *Service) Start() {
+	ctx := s.stopContext()
+	switch s.syncMode {
+	case SYNC_MODE_CHANGE_STREAM:
+		s.startChangeStream(ctx)
+	case SYNC_MODE_INCREMENTAL:
+		s.setup(ctx)
+		s.startSync(ctx, s.syncChanges)
+	default:
+		s.setup(ctx)
+		s.startSync(ctx, s.Refresh)
+	}
+}
+
+// stopContext returns the context of the syncs, it is cancelled by ShutDown
+func (s *Service) stopContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-s.quit
+		cancel()
+	}()
+	return ctx
 }
 
 func (s *Service) ShutDown() {
-	defer close(s.quit)
-	s.quit <- struct{}{}
+	close(s.quit)
+	s.stopped.Wait()
+}
+
+// RecordsCacheToJSON sends the snapshot of all cached records of the tenant with ETag and Last-Modified headers of the list.
+// Conditional requests get 304 Not Modified if the list has not changed
+func (s *Service) RecordsCacheToJSON(c *gin.Context, tenant string, status int) {
+	current, err := s.currentSnapshot(c.Request.Context(), tenant)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, api.ERROR_INTERNAL_SERVER_ERROR)
+		logging.Of(c).WithError(err).Error("unable to serialize records cache")
+		return
+	}
 
+	c.Header("ETag", current.etag)
+	c.Header("Last-Modified", current.modified.UTC().Format(http.TimeFormat))
+	if len(s.compression.Encodings()) != 0 {
+		compression.Vary(c.Writer.Header())
+	}
+	if notModified(c.Request, current) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	encoding := s.compression.Negotiate(c.Request)
+	if encoded, found := current.encoded[encoding]; found {
+		c.Header("Content-Encoding", encoding)
+		c.Data(status, JSON_CONTENT_TYPE, encoded)
+		return
+	}
+	c.Data(status, JSON_CONTENT_TYPE, current.json)
 }
 
-func (s *Service) RecordsCacheToJSON(c *gin.Context, status int) {
+// GetRecord looks the record of the tenant up in the cache and falls back to the database when the cache is stale
+// or has no such record. Returns db.ErrNotFound if neither has it
+func (s *Service) GetRecord(ctx context.Context, tenant string, id primitive.ObjectID) (*records.Record, error) {
 	s.rwm.RLock()
-	defer s.rwm.RUnlock()
-	c.JSON(status, s.recordsCache)
+	index, found := s.recordsIndex[id]
+	var record records.Record
+	if found {
+		record = (*s.recordsCache)[index]
+		found = records.TenantOf(record) == tenant
+	}
+	fresh := s.live || !s.lastSync.IsZero() && time.Since(s.lastSync) <= s.maxStaleness
+	s.rwm.RUnlock()
+
+	if found && fresh {
+		return &record, nil
+	}
+	return s.records.WithTenant(tenant).GetById(ctx, id)
+}
+
+// Find paginates over the cached records of the tenant. Until the cache is loaded for the first time the query goes to the database
+func (s *Service) Find(ctx context.Context, tenant string, q records.Query) (records.Page, error) {
+	err := s.records.Validate(q)
+	if err != nil {
+		return records.Page{}, err
+	}
+
+	if !s.loaded() {
+		return s.records.WithTenant(tenant).Find(ctx, q)
+	}
+	return records.Paginate(s.view(ctx, tenant).sorted(q.SortBy), q), nil
+}
+
+// Put stores the record written to the database, so reads reflect the write before the next sync
+func (s *Service) Put(ctx context.Context, record records.Record) {
+	_, span := s.span(ctx, "Put", records.TenantOf(record))
+	defer span.End()
+	s.rwm.Lock()
+	defer s.rwm.Unlock()
+	s.put(record)
+	if s.reloading > 0 {
+		s.journal = append(s.journal, cacheOp{record: record})
+	}
+}
+
+// Remove drops the record of the tenant deleted from the database, so reads reflect the delete before the next sync.
+// The record of another tenant stays, the empty tenant drops the record of any one. The version of the delete
+// is kept in a tombstone, the zero version is a delete of unknown version, like a purge, which leaves no tombstone
+func (s *Service) Remove(ctx context.Context, tenant string, id primitive.ObjectID, version int64) {
+	_, span := s.span(ctx, "Remove", tenant)
+	defer span.End()
+	s.rwm.Lock()
+	defer s.rwm.Unlock()
+	s.removeOf(tenant, id, version)
+	if s.reloading > 0 {
+		s.journal = append(s.journal, cacheOp{record: records.Record{Id: id, Tenant: tenant, Version: version}, removed: true})
+	}
+}
+
+// put skips the records not newer than the cached or removed ones, the writes of concurrent requests
+// may land in any order
+func (s *Service) put(record records.Record) {
+	index, found := s.recordsIndex[record.Id]
+	if found && (*s.recordsCache)[index].Version >= record.Version {
+		return
+	}
+	if removed, buried := s.tombstones[record.Id]; buried && removed.version >= record.Version {
+		return
+	}
+	delete(s.tombstones, record.Id)
+
+	s.changed(records.TenantOf(record))
+	if found {
+		s.changed(records.TenantOf((*s.recordsCache)[index]))
+		(*s.recordsCache)[index] = record
+		return
+	}
+	*s.recordsCache = append(*s.recordsCache, record)
+	s.recordsIndex[record.Id] = len(*s.recordsCache) - 1
+}
+
+// changed drops the view and the snapshot of the tenant, must be called under the write lock
+func (s *Service) changed(tenant string) {
+	change := s.changes[tenant]
+	change.generation++
+	change.at = time.Now()
+	s.changes[tenant] = change
+	s.views.Delete(tenant)
+	s.snapshots.Delete(tenant)
+}
+
+func (s *Service) removeOf(tenant string, id primitive.ObjectID, version int64) {
+	index, found := s.recordsIndex[id]
+	if found && tenant != "" && records.TenantOf((*s.recordsCache)[index]) != tenant {
+		return
+	}
+	if version == 0 {
+		delete(s.tombstones, id)
+	} else if removed, buried := s.tombstones[id]; !buried || removed.version < version {
+		s.tombstones[id] = tombstone{version: version, at: time.Now()}
+	}
+	if !found || version != 0 && (*s.recordsCache)[index].Version > version {
+		return
+	}
+	s.remove(id)
 }
 
-func (s *Service) startSync() {
+// remove swaps the record with the last one, so the cache is not ordered
+func (s *Service) remove(id primitive.ObjectID) {
+	index, found := s.recordsIndex[id]
+	if !found {
+		return
+	}
+	recordsCache := *s.recordsCache
+	s.changed(records.TenantOf(recordsCache[index]))
+	last := len(recordsCache) - 1
+	if index != last {
+		recordsCache[index] = recordsCache[last]
+		s.recordsIndex[recordsCache[index].Id] = index
+	}
+	*s.recordsCache = recordsCache[:last]
+	delete(s.recordsIndex, id)
+}
+
+// startSync runs the sync function every delay until the context is cancelled, the delay grows while the sync fails
+func (s *Service) startSync(ctx context.Context, sync func(ctx context.Context) error) {
 	go func() {
 		delay := s.minDelay
 		for {
 			select {
-			case <-s.quit:
-				log.Printf("sync cache stopped")
+			case <-ctx.Done():
+				s.log.Info("sync cache stopped")
 				return
-			default:
-				time.Sleep(delay)
-				records, err := records.Instance().GetAll()
+			case <-time.After(delay):
+				err := sync(ctx)
 				if err != nil {
-					log.Printf("sync cache error: %v", err)
-					if delay < s.maxDelay {
-						delay = delay * s.factorDelay
-						log.Printf("sync delay increased by '%d' FACTOR to the value: %v", s.factorDelay, delay)
-					}
-
-					if delay >= s.maxDelay {
-						delay = s.maxDelay
-						log.Printf("sync delay has maximum value: %v", delay)
-					}
-
+					s.log.WithError(err).Error("sync cache error")
+					delay = s.increaseDelay(delay)
+					s.syncFailed(delay)
 					continue
 				} else {
 					delay = s.minDelay
+					s.syncSucceeded()
 				}
-
-				s.reloadCache(&records)
 			}
 		}
 	}()
 }
 
-func createService() *Service {
-	return &Service{
-		quit:         make(chan struct{}),
-		recordsCache: &[]records.Record{},
-		minDelay:     updateMinCacheInterval(),
-		maxDelay:     updateMaxCacheInterval(),
-		factorDelay:  updateCacheIntervalFactor(),
+func (s *Service) increaseDelay(delay time.Duration) time.Duration {
+	if delay < s.maxDelay {
+		delay = delay * s.factorDelay
+		s.log.WithField("factor", int64(s.factorDelay)).Warnf("sync delay increased to %v", delay)
+	}
+
+	if delay >= s.maxDelay {
+		delay = s.maxDelay
+		s.log.Warnf("sync delay has maximum value: %v", delay)
 	}
+	return delay
+}
+
+func (s *Service) syncFailed(delay time.Duration) {
+	s.rwm.Lock()
+	defer s.rwm.Unlock()
+	s.syncFailures++
+	s.syncDelay = delay
 }
 
-func (s *Service) setup() {
-	records, err := records.Instance().GetAll()
+func (s *Service) syncSucceeded() {
+	s.rwm.Lock()
+	defer s.rwm.Unlock()
+	s.syncFailures = 0
+	s.syncDelay = s.minDelay
+}
+
+func (s *Service) setup(ctx context.Context) {
+	err := s.Refresh(ctx)
 	if err != nil {
-		log.Printf("unable to init records cache: %v", err)
+		s.log.WithError(err).Error("unable to init records cache")
 		return
 	}
-	s.reloadCache(&records)
-	log.Printf("records cache initiation succeed")
+	s.log.Info("records cache initiation succeed")
+}
+
+// Refresh reloads the cache synchronously, without waiting for the next sync
+func (s *Service) Refresh(ctx context.Context) error {
+	s.refreshMutex.Lock()
+	defer s.refreshMutex.Unlock()
+	return s.reload(ctx)
 }
 
-func (s *Service) reloadCache(newRecordsCache *[]records.Record) {
+// reload must be called under the refreshMutex
+func (s *Service) reload(ctx context.Context) error {
+	var since time.Time
+	if s.syncMode == SYNC_MODE_INCREMENTAL {
+		// taken before the records are read, so the changes made during the reload are picked up by the next sync
+		var err error
+		since, err = s.records.LastChange(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	started := time.Now()
+	s.beginReload()
+	records, err := s.records.GetAll(ctx)
+	if err != nil {
+		s.endReload()
+		return err
+	}
+	s.reloadCache(&records, s.reloadStarted)
+	s.publishSnapshot(ctx)
+	s.changesSince = since
+	s.lastReload = time.Now()
+	s.reloadStarted = started
+	return nil
+}
+
+func (s *Service) beginReload() {
 	s.rwm.Lock()
 	defer s.rwm.Unlock()
-	s.recordsCache = newRecordsCache
+	s.reloading++
 }
 
-func updateMinCacheInterval() time.Duration {
-	value := utils.EnvVarIntDefault("UPDATE_CACHE_MIN_INTERVAL_IN_SECONDS", "30")
-	return time.Duration(value) * time.Second
+func (s *Service) endReload() {
+	s.rwm.Lock()
+	defer s.rwm.Unlock()
+	s.finishReload()
 }
 
-func updateMaxCacheInterval() time.Duration {
-	value := utils.EnvVarIntDefault("UPDATE_CACHE_MAX_INTERVAL_IN_SECONDS", "86400")
-	return time.Duration(value) * time.Second
+func (s *Service) finishReload() {
+	s.reloading--
+	if s.reloading == 0 {
+		s.journal = nil
+	}
+}
+
+// publishSnapshot builds the snapshots of the tenants right after a sync, so reads do not pay for the serialization
+func (s *Service) publishSnapshot(ctx context.Context) {
+	s.rwm.RLock()
+	tenants := s.tenants()
+	s.rwm.RUnlock()
+
+	for _, tenant := range tenants {
+		_, err := s.refreshSnapshot(ctx, tenant)
+		if err != nil {
+			s.log.WithError(err).WithField("tenant", tenant).Error("unable to serialize records cache of tenant")
+		}
+	}
 }
 
-func updateCacheIntervalFactor() time.Duration {
-	value := utils.EnvVarIntDefault("UPDATE_CACHE_INTERVAL_FACTOR", "2")
-	return time.Duration(value)
+// reloadCache drops the tombstones of the reloaded records, the database has been read after their deletes.
+// The other tombstones are kept since the start of the previous reload, the requests written before them are long done
+func (s *Service) reloadCache(newRecordsCache *[]records.Record, expired time.Time) {
+	newRecordsIndex := make(map[primitive.ObjectID]int, len(*newRecordsCache))
+	for i, record := range *newRecordsCache {
+		newRecordsIndex[record.Id] = i
+	}
+
+	s.rwm.Lock()
+	defer s.rwm.Unlock()
+	for tenant := range s.changes {
+		s.changed(tenant)
+	}
+	s.recordsCache = newRecordsCache
+	s.recordsIndex = newRecordsIndex
+	for _, tenant := range s.tenants() {
+		s.changed(tenant)
+	}
+	for id, removed := range s.tombstones {
+		if _, found := newRecordsIndex[id]; found || removed.at.Before(expired) {
+			delete(s.tombstones, id)
+		}
+	}
+	for _, op := range s.journal {
+		if op.removed {
+			s.removeOf(op.record.Tenant, op.record.Id, op.record.Version)
+		} else {
+			s.put(op.record)
+		}
+	}
+	s.lastSync = time.Now()
+	s.finishReload()
 }
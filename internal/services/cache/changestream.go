@@ -0,0 +1,154 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/db"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/records"
+)
+
+// errStreamInvalidated means that the collection has been dropped or renamed and the stream has to be reopened from scratch
+var errStreamInvalidated = errors.New("change stream is invalidated")
+
+// startChangeStream keeps the cache in sync by applying change events of the records collection.
+// A stream opened without a resume token is followed by a full reload, so the events are applied over a consistent state.
+// The resume token of the instance is stored periodically and on shut down, so after a restart the stream resumes where it stopped.
+// If the deployment is not a replica set, the cache falls back to polling
+func (s *Service) startChangeStream(ctx context.Context) {
+	s.stopped.Add(1)
+	go func() {
+		defer s.stopped.Done()
+		token, err := s.records.ResumeToken(ctx, s.instanceId)
+		if err != nil {
+			s.log.WithError(err).Warn("unable to get stored resume token of sync cache change stream")
+		}
+		s.resumeToken = token
+
+		delay := s.minDelay
+		for {
+			connected, err := s.watch(ctx)
+			if connected {
+				delay = s.minDelay
+			}
+			if ctx.Err() != nil {
+				s.log.Info("sync cache stopped")
+				return
+			}
+			if errors.Is(err, db.ErrChangeStreamsUnsupported) {
+				s.log.Warn("change streams are not supported by the database, sync cache falls back to polling")
+				s.setup(ctx)
+				s.startSync(ctx, s.Refresh)
+				return
+			}
+			if errors.Is(err, db.ErrChangeStreamHistoryLost) || errors.Is(err, errStreamInvalidated) {
+				s.log.WithError(err).Warn("sync cache change stream is not able to resume, reloading cache")
+				s.resumeToken = nil
+				s.saveResumeToken(ctx)
+				continue
+			}
+
+			s.log.WithError(err).Error("sync cache change stream closed")
+			s.syncFailed(delay)
+			select {
+			case <-ctx.Done():
+				s.log.Info("sync cache stopped")
+				return
+			case <-time.After(delay):
+				delay = s.increaseDelay(delay)
+			}
+		}
+	}()
+}
+
+// watch opens the change stream and applies its events until an error or cancellation.
+// Returns true if the stream has been successfully connected
+func (s *Service) watch(ctx context.Context) (bool, error) {
+	stream, err := s.records.Watch(ctx, s.resumeToken)
+	if err != nil {
+		return false, err
+	}
+	defer stream.Close(context.Background())
+
+	// the cache is empty after a restart, it is loaded once and the resumed stream applies the changes made meanwhile
+	if s.resumeToken == nil || !s.loaded() {
+		err = s.Refresh(ctx)
+		if err != nil {
+			return false, err
+		}
+	}
+	if s.resumeToken == nil {
+		s.resumeToken = stream.ResumeToken()
+		s.saveResumeToken(ctx)
+	}
+
+	s.setLive(true)
+	defer s.setLive(false)
+	s.syncSucceeded()
+	s.log.Info("sync cache change stream started")
+
+	// the token is stored at most once per resumeTokenSave, the events applied after the last store are resumed again after a crash
+	saved := time.Now()
+	unsaved := false
+	defer func() {
+		if unsaved {
+			s.saveResumeToken(context.Background())
+		}
+	}()
+
+	for stream.Next(ctx) {
+		var event records.ChangeEvent
+		err := stream.Decode(&event)
+		if err != nil {
+			return true, fmt.Errorf("unable to decode change event: %v", err)
+		}
+
+		switch event.OperationType {
+		case "insert", "update", "replace":
+			switch {
+			case event.FullDocument == nil:
+				// deleted before the update lookup
+				s.Remove(ctx, "", event.DocumentKey.Id, 0)
+			case event.FullDocument.DeletedAt != nil:
+				s.Remove(ctx, "", event.DocumentKey.Id, event.FullDocument.Version)
+			default:
+				s.Put(ctx, *event.FullDocument)
+			}
+		case "delete":
+			s.Remove(ctx, "", event.DocumentKey.Id, 0)
+		default:
+			// drop, rename, dropDatabase and invalidate close the stream
+			return true, fmt.Errorf("%w by '%v' event", errStreamInvalidated, event.OperationType)
+		}
+		s.resumeToken = stream.ResumeToken()
+		unsaved = true
+		if time.Since(saved) >= s.resumeTokenSave {
+			s.saveResumeToken(ctx)
+			saved = time.Now()
+			unsaved = false
+		}
+	}
+	return true, stream.Err()
+}
+
+func (s *Service) saveResumeToken(ctx context.Context) {
+	err := s.records.SaveResumeToken(ctx, s.instanceId, s.resumeToken)
+	if err != nil && ctx.Err() == nil {
+		s.log.WithError(err).Warn("unable to store resume token of sync cache change stream")
+	}
+}
+
+func (s *Service) loaded() bool {
+	s.rwm.RLock()
+	defer s.rwm.RUnlock()
+	return !s.lastSync.IsZero()
+}
+
+func (s *Service) setLive(live bool) {
+	s.rwm.Lock()
+	defer s.rwm.Unlock()
+	s.live = live
+	s.lastSync = time.Now()
+}
@@ -0,0 +1,54 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/records"
+)
+
+// syncChanges applies the records written and deleted since the previous sync. The whole cache is reloaded
+// on the first sync and then every fullReloadInterval: it picks up documents written without the change tracking
+// field and deletes whose tombstones have been expired while the sync was failing
+func (s *Service) syncChanges(ctx context.Context) error {
+	s.refreshMutex.Lock()
+	defer s.refreshMutex.Unlock()
+
+	if s.lastReload.IsZero() || time.Since(s.lastReload) >= s.fullReloadInterval {
+		return s.reload(ctx)
+	}
+
+	s.beginReload()
+	changes, err := s.records.GetChanges(ctx, s.changesSince)
+	if err != nil {
+		s.endReload()
+		return err
+	}
+	s.applyChanges(changes)
+	s.publishSnapshot(ctx)
+	s.changesSince = changes.Until
+	return nil
+}
+
+// applyChanges updates the cache in place. The changes may have been read before the writes made through the cache
+// meanwhile, so the journal is replayed over them like over a full reload
+func (s *Service) applyChanges(changes records.Changes) {
+	s.rwm.Lock()
+	defer s.rwm.Unlock()
+	for _, record := range changes.Updated {
+		delete(s.tombstones, record.Id)
+		s.put(record)
+	}
+	for _, id := range changes.Deleted {
+		s.remove(id)
+	}
+	for _, op := range s.journal {
+		if op.removed {
+			s.removeOf(op.record.Tenant, op.record.Id, op.record.Version)
+		} else {
+			s.put(op.record)
+		}
+	}
+	s.lastSync = time.Now()
+	s.finishReload()
+}
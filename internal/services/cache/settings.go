@@ -0,0 +1,92 @@
+package cache
+
+import (
+	"os"
+	"time"
+
+	"github.com/ArtemVoronov/artforintrovert-test/internal/utils"
+)
+
+const (
+	SYNC_MODE_POLL          = "poll"
+	SYNC_MODE_CHANGE_STREAM = "changestream"
+	SYNC_MODE_INCREMENTAL   = "incremental"
+)
+
+type Config struct {
+	// SyncMode is SYNC_MODE_POLL for periodic full reloads, SYNC_MODE_CHANGE_STREAM for applying change events
+	// or SYNC_MODE_INCREMENTAL for polling the records changed since the previous sync
+	SyncMode    string
+	MinDelay    time.Duration
+	MaxDelay    time.Duration
+	FactorDelay time.Duration
+	// MaxStaleness is the age of the last successful sync after which cached records are not trusted for single record reads
+	MaxStaleness time.Duration
+	// FullReloadInterval is how often the incremental sync reloads the whole cache. It has to be less than
+	// the tombstone TTL of the records service, otherwise deletes may be missed
+	FullReloadInterval time.Duration
+	// InstanceId keys the stored change stream resume token of the app instance
+	InstanceId string
+	// ResumeTokenSaveInterval is how often the change stream stores its resume token, zero stores it after every event
+	ResumeTokenSaveInterval time.Duration
+}
+
+func LoadConfig() Config {
+	return Config{
+		SyncMode:     syncMode(),
+		MinDelay:     updateMinCacheInterval(),
+		MaxDelay:     updateMaxCacheInterval(),
+		FactorDelay:  updateCacheIntervalFactor(),
+		MaxStaleness: maxCacheStaleness(),
+
+		FullReloadInterval:      fullReloadInterval(),
+		InstanceId:              instanceId(),
+		ResumeTokenSaveInterval: resumeTokenSaveInterval(),
+	}
+}
+
+func updateMinCacheInterval() time.Duration {
+	value := utils.EnvVarIntDefault("UPDATE_CACHE_MIN_INTERVAL_IN_SECONDS", "30")
+	return time.Duration(value) * time.Second
+}
+
+func updateMaxCacheInterval() time.Duration {
+	value := utils.EnvVarIntDefault("UPDATE_CACHE_MAX_INTERVAL_IN_SECONDS", "86400")
+	return time.Duration(value) * time.Second
+}
+
+func updateCacheIntervalFactor() time.Duration {
+	value := utils.EnvVarIntDefault("UPDATE_CACHE_INTERVAL_FACTOR", "2")
+	return time.Duration(value)
+}
+
+func maxCacheStaleness() time.Duration {
+	value := utils.EnvVarIntDefault("CACHE_MAX_STALENESS_IN_SECONDS", "60")
+	return time.Duration(value) * time.Second
+}
+
+func fullReloadInterval() time.Duration {
+	value := utils.EnvVarIntDefault("CACHE_FULL_RELOAD_INTERVAL_IN_SECONDS", "3600")
+	return time.Duration(value) * time.Second
+}
+
+func instanceId() string {
+	value := utils.EnvVarDefault("CACHE_INSTANCE_ID", "")
+	if value != "" {
+		return value
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	return hostname
+}
+
+func resumeTokenSaveInterval() time.Duration {
+	value := utils.EnvVarIntDefault("CACHE_RESUME_TOKEN_SAVE_INTERVAL_IN_SECONDS", "5")
+	return time.Duration(value) * time.Second
+}
+
+func syncMode() string {
+	return utils.EnvVarDefault("CACHE_SYNC_MODE", SYNC_MODE_POLL)
+}
@@ -0,0 +1,188 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/records"
+)
+
+const (
+	JSON_CONTENT_TYPE = "application/json; charset=utf-8"
+)
+
+// snapshot is the immutable serialized records list of one tenant. It is built once per change of the tenant and swapped
+// atomically, so sending the list is a map load and a byte write.
+// The etag is the hash of the serialized list, so it is the same on all app instances and survives reloads
+// which change nothing
+type snapshot struct {
+	json []byte
+	// encoded is the json compressed with every supported content coding
+	encoded  map[string][]byte
+	etag     string
+	modified time.Time
+}
+
+// view is the immutable sorted records list of one tenant
+type view struct {
+	generation uint64
+	at         time.Time
+	byId       []records.Record
+	byData     []records.Record
+	sortOnce   sync.Once
+}
+
+// view returns the view of the tenant. Only copying the records holds the read lock, the view is stored
+// if the tenant has not changed meanwhile
+func (s *Service) view(ctx context.Context, tenant string) *view {
+	if value, found := s.views.Load(tenant); found {
+		return value.(*view)
+	}
+	_, span := s.span(ctx, "view", tenant)
+	defer span.End()
+
+	s.rwm.RLock()
+	change := s.changes[tenant]
+	tenantRecords := s.tenantRecords(tenant)
+	s.rwm.RUnlock()
+
+	records.SortOf(records.SORT_BY_ID, tenantRecords)
+	result := &view{generation: change.generation, at: change.at, byId: tenantRecords}
+
+	s.rwm.RLock()
+	defer s.rwm.RUnlock()
+	if s.changes[tenant].generation == change.generation {
+		s.views.Store(tenant, result)
+	}
+	return result
+}
+
+// sorted returns the records in the ascending order of the sort, the order by data is sorted once on demand
+func (v *view) sorted(sortBy string) []records.Record {
+	if sortBy != records.SORT_BY_DATA {
+		return v.byId
+	}
+	v.sortOnce.Do(func() {
+		v.byData = make([]records.Record, len(v.byId))
+		copy(v.byData, v.byId)
+		records.SortOf(records.SORT_BY_DATA, v.byData)
+	})
+	return v.byData
+}
+
+// currentSnapshot returns the snapshot of the tenant. Reloads build it right away, while the writes
+// through the cache leave it to the first read, so a burst of writes costs one serialization
+func (s *Service) currentSnapshot(ctx context.Context, tenant string) (*snapshot, error) {
+	if current := s.loadSnapshot(tenant); current != nil {
+		return current, nil
+	}
+	return s.refreshSnapshot(ctx, tenant)
+}
+
+func (s *Service) loadSnapshot(tenant string) *snapshot {
+	value, found := s.snapshots.Load(tenant)
+	if !found {
+		return nil
+	}
+	return value.(*snapshot)
+}
+
+// refreshSnapshot builds the snapshot of the view of the tenant unless it is already built. The snapshot is stored
+// if the tenant has not changed meanwhile
+func (s *Service) refreshSnapshot(ctx context.Context, tenant string) (*snapshot, error) {
+	ctx, span := s.span(ctx, "refreshSnapshot", tenant)
+	defer span.End()
+	s.snapshotMutex.Lock()
+	defer s.snapshotMutex.Unlock()
+	if current := s.loadSnapshot(tenant); current != nil {
+		return current, nil
+	}
+
+	current := s.view(ctx, tenant)
+	body, err := json.Marshal(current.byId)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(body)
+	result := &snapshot{
+		json: body,
+		// weak, because the compressed representations are not byte to byte equal
+		etag:     "W/\"" + hex.EncodeToString(sum[:16]) + "\"",
+		modified: current.at,
+	}
+	if previous := s.published[tenant]; previous != nil && previous.etag == result.etag {
+		result.modified = previous.modified
+	} else if result.modified.IsZero() {
+		result.modified = time.Now()
+	}
+	if s.compression.Compressible(len(body)) {
+		result.encoded = make(map[string][]byte)
+		for _, encoding := range s.compression.Encodings() {
+			result.encoded[encoding], err = s.compression.Compress(encoding, body)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	s.rwm.RLock()
+	defer s.rwm.RUnlock()
+	if s.changes[tenant].generation == current.generation {
+		s.snapshots.Store(tenant, result)
+		s.published[tenant] = result
+	}
+	return result, nil
+}
+
+// tenantRecords returns the copy of the cached records of the tenant, must be called under the read lock
+func (s *Service) tenantRecords(tenant string) []records.Record {
+	result := make([]records.Record, 0)
+	for _, record := range *s.recordsCache {
+		if records.TenantOf(record) == tenant {
+			result = append(result, record)
+		}
+	}
+	return result
+}
+
+// tenants returns the tenants having the cached records, must be called under the read lock
+func (s *Service) tenants() []string {
+	found := make(map[string]bool)
+	result := make([]string, 0)
+	for _, record := range *s.recordsCache {
+		tenant := records.TenantOf(record)
+		if !found[tenant] {
+			found[tenant] = true
+			result = append(result, tenant)
+		}
+	}
+	return result
+}
+
+// notModified evaluates If-None-Match or, if it is absent, If-Modified-Since
+func notModified(r *http.Request, current *snapshot) bool {
+	if header := r.Header.Get("If-None-Match"); header != "" {
+		for _, tag := range strings.Split(header, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(current.etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	if header := r.Header.Get("If-Modified-Since"); header != "" {
+		since, err := http.ParseTime(header)
+		if err != nil {
+			return false
+		}
+		return !current.modified.Truncate(time.Second).After(since)
+	}
+	return false
+}
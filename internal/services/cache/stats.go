@@ -0,0 +1,38 @@
+package cache
+
+import (
+	"time"
+)
+
+// Stats is the state of the cache for the monitoring
+type Stats struct {
+	Records int
+	// SnapshotBytes is the size of the serialized snapshots of all tenants, without the compressed copies
+	SnapshotBytes int
+	// LastSync is the time of the last successful sync, zero before the first one
+	LastSync time.Time
+	// Live is true while the change stream is applying the changes, the cache is current whatever LastSync is
+	Live bool
+	// SyncDelay is the delay before the next sync, it grows while the syncs fail
+	SyncDelay    time.Duration
+	SyncFailures int
+}
+
+// Stats returns the current state of the cache
+func (s *Service) Stats() Stats {
+	s.rwm.RLock()
+	result := Stats{
+		Records:      len(*s.recordsCache),
+		LastSync:     s.lastSync,
+		Live:         s.live,
+		SyncDelay:    s.syncDelay,
+		SyncFailures: s.syncFailures,
+	}
+	s.rwm.RUnlock()
+
+	s.snapshots.Range(func(key, value interface{}) bool {
+		result.SnapshotBytes += len(value.(*snapshot).json)
+		return true
+	})
+	return result
+}
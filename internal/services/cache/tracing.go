@@ -0,0 +1,16 @@
+package cache
+
+import (
+	"context"
+
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/records"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// span starts the span of the method named as cache.Service.Put, so the waits for the cache locks and the builds
+// of the views and snapshots show up in the traces of the requests
+func (s *Service) span(ctx context.Context, method string, tenant string) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "cache.Service."+method, attribute.String(records.TENANT_ATTRIBUTE, tenant))
+}
@@ -0,0 +1,176 @@
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	ENCODING_GZIP    = "gzip"
+	ENCODING_DEFLATE = "deflate"
+	ENCODING_ZSTD    = "zstd"
+
+	MIN_LEVEL = 1
+	MAX_LEVEL = 9
+)
+
+type CompressionService interface {
+	Encodings() []string
+	Compressible(size int) bool
+	Negotiate(r *http.Request) string
+	Compress(encoding string, body []byte) ([]byte, error)
+}
+
+type Service struct {
+	encodings []string
+	minSize   int
+	level     int
+	zstd      *zstd.Encoder
+	gzipPool  sync.Pool
+	zlibPool  sync.Pool
+}
+
+func CreateService(config Config) (*Service, error) {
+	level := config.Level
+	if level < MIN_LEVEL {
+		level = MIN_LEVEL
+	}
+	if level > MAX_LEVEL {
+		level = MAX_LEVEL
+	}
+
+	s := &Service{
+		minSize: config.MinSize,
+		level:   level,
+	}
+	for _, encoding := range config.Encodings {
+		switch encoding {
+		case ENCODING_ZSTD:
+			encoder, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+			if err != nil {
+				return nil, fmt.Errorf("unable to create zstd encoder: %v", err)
+			}
+			s.zstd = encoder
+		case ENCODING_GZIP, ENCODING_DEFLATE:
+		default:
+			return nil, fmt.Errorf("unsupported content encoding: '%v'", encoding)
+		}
+		s.encodings = append(s.encodings, encoding)
+	}
+	return s, nil
+}
+
+// Encodings returns the supported content codings in the order of preference
+func (s *Service) Encodings() []string {
+	return s.encodings
+}
+
+// Negotiate chooses the content coding by the Accept-Encoding header. The highest quality wins, the ties are resolved
+// by the server preference. Returns the empty string if the response should not be compressed
+func (s *Service) Negotiate(r *http.Request) string {
+	header := r.Header.Get("Accept-Encoding")
+	if header == "" {
+		return ""
+	}
+
+	weights := make(map[string]float64)
+	wildcard := -1.0
+	for _, value := range strings.Split(header, ",") {
+		name, weight := parseCoding(value)
+		if name == "*" {
+			wildcard = weight
+			continue
+		}
+		weights[name] = weight
+	}
+
+	result, best := "", 0.0
+	for _, encoding := range s.encodings {
+		weight, found := weights[encoding]
+		if !found {
+			weight = wildcard
+		}
+		if weight > best {
+			result, best = encoding, weight
+		}
+	}
+	return result
+}
+
+// Compress encodes the body with one of the supported content codings
+func (s *Service) Compress(encoding string, body []byte) ([]byte, error) {
+	switch encoding {
+	case ENCODING_ZSTD:
+		if s.zstd == nil {
+			break
+		}
+		return s.zstd.EncodeAll(body, make([]byte, 0, len(body)/4)), nil
+	case ENCODING_GZIP:
+		return s.compress(&s.gzipPool, body, func(w io.Writer) (writer, error) {
+			return gzip.NewWriterLevel(w, s.level)
+		})
+	case ENCODING_DEFLATE:
+		// the deflate content coding is the zlib format
+		return s.compress(&s.zlibPool, body, func(w io.Writer) (writer, error) {
+			return zlib.NewWriterLevel(w, s.level)
+		})
+	}
+	return nil, fmt.Errorf("unsupported content encoding: '%v'", encoding)
+}
+
+type writer interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+}
+
+func (s *Service) compress(pool *sync.Pool, body []byte, create func(w io.Writer) (writer, error)) ([]byte, error) {
+	var buffer bytes.Buffer
+	compressor, ok := pool.Get().(writer)
+	if ok {
+		compressor.Reset(&buffer)
+	} else {
+		var err error
+		compressor, err = create(&buffer)
+		if err != nil {
+			return nil, err
+		}
+	}
+	defer pool.Put(compressor)
+
+	_, err := compressor.Write(body)
+	if err != nil {
+		return nil, err
+	}
+	err = compressor.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func parseCoding(value string) (string, float64) {
+	parts := strings.Split(value, ";")
+	name := strings.ToLower(strings.TrimSpace(parts[0]))
+	weight := 1.0
+	for _, param := range parts[1:] {
+		param = strings.TrimSpace(param)
+		if !strings.HasPrefix(param, "q=") {
+			continue
+		}
+		parsed, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64)
+		if err != nil {
+			return name, 0
+		}
+		weight = parsed
+	}
+	return name, weight
+}
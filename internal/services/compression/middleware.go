@@ -0,0 +1,89 @@
+package compression
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+
+	"github.com/ArtemVoronov/artforintrovert-test/internal/logging"
+	"github.com/gin-gonic/gin"
+)
+
+// bufferedWriter holds the response body until the handler returns, so its size is known before the headers are sent
+type bufferedWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bufferedWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+// Middleware compresses the response bodies of at least MinSize bytes with the negotiated content coding.
+// The responses which already have Content-Encoding, like the pre-compressed cache snapshots, are sent as is
+func (s *Service) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if len(s.encodings) == 0 {
+			c.Next()
+			return
+		}
+
+		original := c.Writer
+		buffered := &bufferedWriter{ResponseWriter: original}
+		c.Writer = buffered
+		c.Next()
+		c.Writer = original
+
+		body := buffered.body.Bytes()
+		if len(body) == 0 {
+			return
+		}
+		header := original.Header()
+		if header.Get("Content-Encoding") == "" {
+			Vary(header)
+			if encoding := s.negotiate(c.Request, len(body)); encoding != "" {
+				compressed, err := s.Compress(encoding, body)
+				if err == nil {
+					header.Set("Content-Encoding", encoding)
+					header.Del("Content-Length")
+					body = compressed
+				} else {
+					logging.Of(c).WithError(err).Error("unable to compress response")
+				}
+			}
+		}
+
+		_, err := original.Write(body)
+		if err != nil {
+			logging.Of(c).WithError(err).Error("unable to write response")
+		}
+	}
+}
+
+// Compressible reports whether the body of such size is worth compressing
+func (s *Service) Compressible(size int) bool {
+	return len(s.encodings) != 0 && size >= s.minSize
+}
+
+func (s *Service) negotiate(r *http.Request, size int) string {
+	if !s.Compressible(size) {
+		return ""
+	}
+	return s.Negotiate(r)
+}
+
+// Vary marks the response as dependent on Accept-Encoding
+func Vary(header http.Header) {
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(name), "Accept-Encoding") {
+				return
+			}
+		}
+	}
+	header.Add("Vary", "Accept-Encoding")
+}
@@ -0,0 +1,44 @@
+package compression
+
+import (
+	"strings"
+
+	"github.com/ArtemVoronov/artforintrovert-test/internal/utils"
+)
+
+type Config struct {
+	// Encodings are the supported content codings in the order of preference, empty disables the compression
+	Encodings []string
+	// MinSize is the response body size below which the response is sent as is
+	MinSize int
+	// Level is from 1 (fastest) to 9 (smallest), zstd takes it as the zstd level
+	Level int
+}
+
+func LoadConfig() Config {
+	return Config{
+		Encodings: encodings(),
+		MinSize:   minSize(),
+		Level:     level(),
+	}
+}
+
+func encodings() []string {
+	value := utils.EnvVarDefault("COMPRESSION_ENCODINGS", ENCODING_ZSTD+","+ENCODING_GZIP+","+ENCODING_DEFLATE)
+	result := make([]string, 0)
+	for _, encoding := range strings.Split(value, ",") {
+		encoding = strings.ToLower(strings.TrimSpace(encoding))
+		if encoding != "" {
+			result = append(result, encoding)
+		}
+	}
+	return result
+}
+
+func minSize() int {
+	return utils.EnvVarIntDefault("COMPRESSION_MIN_SIZE_IN_BYTES", "1024")
+}
+
+func level() int {
+	return utils.EnvVarIntDefault("COMPRESSION_LEVEL", "5")
+}
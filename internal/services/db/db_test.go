@@ -0,0 +1,427 @@
+package db_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ArtemVoronov/artforintrovert-test/internal/logging"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/db"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/utils"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const TEST_COLLECTION_NAME = "unit_documents"
+
+// CreateTestService runs the tests on the memory driver, DATABASE_DRIVER=mongo runs the same tests on a live MongoDB
+func CreateTestService(t *testing.T) db.MongoService {
+	config := db.Config{
+		Driver:         utils.EnvVarDefault("DATABASE_DRIVER", db.DRIVER_MEMORY),
+		ConnectionURL:  db.ConnectionURL(),
+		ConnectTimeout: 5 * time.Second,
+		QueryTimeout:   5 * time.Second,
+	}
+	service, err := db.CreateService(logging.Default("db"), config)
+	if err != nil {
+		t.Fatalf("unable to setup db service: %v", err)
+	}
+	err = service.Drop(context.Background(), db.DBName(), TEST_COLLECTION_NAME)
+	assert.Nil(t, err)
+	t.Cleanup(service.ShutDown)
+	return service
+}
+
+func InsertTestDocuments(t *testing.T, service db.MongoService, documents ...bson.M) {
+	for _, document := range documents {
+		_, err := service.Insert(context.Background(), db.DBName(), TEST_COLLECTION_NAME, document)
+		assert.Nil(t, err)
+	}
+}
+
+func FindIds(t *testing.T, service db.MongoService, filter bson.M, opts db.FindOptions) []primitive.ObjectID {
+	var found []bson.M
+	err := service.Find(context.Background(), db.DBName(), TEST_COLLECTION_NAME, filter, opts, &found)
+	assert.Nil(t, err)
+	result := make([]primitive.ObjectID, 0, len(found))
+	for _, document := range found {
+		result = append(result, document["_id"].(primitive.ObjectID))
+	}
+	return result
+}
+
+func FindTestDocument(t *testing.T, service db.MongoService, id primitive.ObjectID) bson.M {
+	var result bson.M
+	err := service.FindOne(context.Background(), db.DBName(), TEST_COLLECTION_NAME, bson.M{"_id": id}, &result)
+	assert.Nil(t, err)
+	return result
+}
+
+func TestFind(t *testing.T) {
+	service := CreateTestService(t)
+	apple, banana, cherry := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	InsertTestDocuments(t, service,
+		bson.M{"_id": apple, "data": "apple", "n": 1},
+		bson.M{"_id": banana, "data": "banana", "n": 2, "extra": true},
+		bson.M{"_id": cherry, "data": "Cherry", "n": 3},
+	)
+	byId := db.FindOptions{Sort: bson.D{{Key: "_id", Value: 1}}}
+
+	cases := []struct {
+		name     string
+		filter   bson.M
+		expected []primitive.ObjectID
+	}{
+		{"All", bson.M{}, []primitive.ObjectID{apple, banana, cherry}},
+		{"Equal", bson.M{"data": "apple"}, []primitive.ObjectID{apple}},
+		{"Range", bson.M{"n": bson.M{"$gte": 2, "$lt": 3}}, []primitive.ObjectID{banana}},
+		{"GreaterThan", bson.M{"n": bson.M{"$gt": 1}}, []primitive.ObjectID{banana, cherry}},
+		{"NotEqual", bson.M{"data": bson.M{"$ne": "banana"}}, []primitive.ObjectID{apple, cherry}},
+		{"In", bson.M{"n": bson.M{"$in": bson.A{1, 3}}}, []primitive.ObjectID{apple, cherry}},
+		{"NotIn", bson.M{"n": bson.M{"$nin": bson.A{1, 3}}}, []primitive.ObjectID{banana}},
+		{"InWithNull", bson.M{"extra": bson.M{"$in": bson.A{true, nil}}}, []primitive.ObjectID{apple, banana, cherry}},
+		{"Exists", bson.M{"extra": bson.M{"$exists": true}}, []primitive.ObjectID{banana}},
+		{"NotExists", bson.M{"extra": bson.M{"$exists": false}}, []primitive.ObjectID{apple, cherry}},
+		{"Regex", bson.M{"data": bson.M{"$regex": "^b"}}, []primitive.ObjectID{banana}},
+		{"RegexCaseInsensitive", bson.M{"data": bson.M{"$regex": "cherry", "$options": "i"}}, []primitive.ObjectID{cherry}},
+		{"Or", bson.M{"$or": bson.A{bson.M{"data": "apple"}, bson.M{"n": 3}}}, []primitive.ObjectID{apple, cherry}},
+		{"And", bson.M{"$and": bson.A{bson.M{"n": bson.M{"$gt": 1}}, bson.M{"data": bson.M{"$ne": "banana"}}}}, []primitive.ObjectID{cherry}},
+		{"NoMatch", bson.M{"data": "durian"}, []primitive.ObjectID{}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.expected, FindIds(t, service, c.filter, byId))
+		})
+	}
+
+	t.Run("SortAndLimit", func(t *testing.T) {
+		opts := db.FindOptions{Sort: bson.D{{Key: "n", Value: -1}}, Limit: 2}
+		assert.Equal(t, []primitive.ObjectID{cherry, banana}, FindIds(t, service, bson.M{}, opts))
+	})
+}
+
+func TestUpdateOperators(t *testing.T) {
+	t.Run("Update", func(t *testing.T) {
+		service := CreateTestService(t)
+		id := primitive.NewObjectID()
+		InsertTestDocuments(t, service, bson.M{"_id": id, "data": "exponent", "n": int32(1), "gone": "soon"})
+
+		var result bson.M
+		update := bson.M{
+			"$set":         bson.M{"data": "pi"},
+			"$inc":         bson.M{"n": 2, "counter": int64(1)},
+			"$unset":       bson.M{"gone": ""},
+			"$currentDate": bson.M{"at": true},
+			"$setOnInsert": bson.M{"created": true},
+		}
+		started := time.Now().Add(-time.Second)
+		err := service.FindOneAndUpdate(context.Background(), db.DBName(), TEST_COLLECTION_NAME, bson.M{"_id": id}, update, false, &result)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "pi", result["data"])
+		assert.Equal(t, int32(3), result["n"])
+		assert.Equal(t, int64(1), result["counter"])
+		assert.NotContains(t, result, "gone")
+		assert.NotContains(t, result, "created")
+		at, ok := result["at"].(primitive.DateTime)
+		assert.True(t, ok)
+		assert.True(t, at.Time().After(started))
+		assert.Equal(t, result, FindTestDocument(t, service, id))
+	})
+	t.Run("UpdateOne", func(t *testing.T) {
+		service := CreateTestService(t)
+		id := primitive.NewObjectID()
+		InsertTestDocuments(t, service, bson.M{"_id": id, "data": "exponent", "kept": "yes"})
+
+		err := service.UpdateOne(context.Background(), db.DBName(), TEST_COLLECTION_NAME, bson.M{"_id": id}, bson.M{"$set": bson.M{"data": "pi"}})
+
+		assert.Nil(t, err)
+		document := FindTestDocument(t, service, id)
+		assert.Equal(t, "pi", document["data"])
+		assert.Equal(t, "yes", document["kept"])
+	})
+	t.Run("ReplaceOne", func(t *testing.T) {
+		service := CreateTestService(t)
+		id := primitive.NewObjectID()
+		InsertTestDocuments(t, service, bson.M{"_id": id, "data": "exponent", "gone": "soon"})
+
+		err := service.ReplaceOne(context.Background(), db.DBName(), TEST_COLLECTION_NAME, bson.M{"_id": id}, bson.M{"data": "pi"})
+
+		assert.Nil(t, err)
+		assert.Equal(t, bson.M{"_id": id, "data": "pi"}, FindTestDocument(t, service, id))
+	})
+}
+
+func TestUpsert(t *testing.T) {
+	t.Run("InsertGeneratesId", func(t *testing.T) {
+		service := CreateTestService(t)
+
+		id, err := service.Insert(context.Background(), db.DBName(), TEST_COLLECTION_NAME, bson.M{"data": "exponent"})
+
+		assert.Nil(t, err)
+		assert.False(t, id.IsZero())
+		assert.Equal(t, bson.M{"_id": *id, "data": "exponent"}, FindTestDocument(t, service, *id))
+	})
+	t.Run("InsertKeepsId", func(t *testing.T) {
+		service := CreateTestService(t)
+		expected := primitive.NewObjectID()
+
+		id, err := service.Insert(context.Background(), db.DBName(), TEST_COLLECTION_NAME, bson.M{"_id": expected, "data": "exponent"})
+
+		assert.Nil(t, err)
+		assert.Equal(t, expected, *id)
+	})
+	t.Run("UpsertInserts", func(t *testing.T) {
+		service := CreateTestService(t)
+		expected := primitive.NewObjectID()
+
+		id, err := service.Upsert(context.Background(), db.DBName(), TEST_COLLECTION_NAME, expected, bson.M{"data": "exponent"})
+
+		assert.Nil(t, err)
+		assert.Equal(t, expected, *id)
+		assert.Equal(t, bson.M{"_id": expected, "data": "exponent"}, FindTestDocument(t, service, expected))
+	})
+	t.Run("UpsertUpdates", func(t *testing.T) {
+		service := CreateTestService(t)
+		id := primitive.NewObjectID()
+		InsertTestDocuments(t, service, bson.M{"_id": id, "data": "exponent", "kept": "yes"})
+
+		upserted, err := service.Upsert(context.Background(), db.DBName(), TEST_COLLECTION_NAME, id, bson.M{"data": "pi"})
+
+		assert.Nil(t, err)
+		assert.Nil(t, upserted)
+		assert.Equal(t, bson.M{"_id": id, "data": "pi", "kept": "yes"}, FindTestDocument(t, service, id))
+	})
+	t.Run("FindOneAndUpdateInsertsFilterFields", func(t *testing.T) {
+		service := CreateTestService(t)
+		id := primitive.NewObjectID()
+
+		var result bson.M
+		filter := bson.M{"_id": id, "tenant": "acme", "n": bson.M{"$exists": false}}
+		update := bson.M{"$set": bson.M{"data": "exponent"}, "$setOnInsert": bson.M{"created": true}}
+		err := service.FindOneAndUpdate(context.Background(), db.DBName(), TEST_COLLECTION_NAME, filter, update, true, &result)
+
+		assert.Nil(t, err)
+		assert.Equal(t, bson.M{"_id": id, "tenant": "acme", "data": "exponent", "created": true}, result)
+	})
+	t.Run("FindOneAndUpdateGeneratesId", func(t *testing.T) {
+		service := CreateTestService(t)
+
+		var result bson.M
+		err := service.FindOneAndUpdate(context.Background(), db.DBName(), TEST_COLLECTION_NAME, bson.M{"data": "exponent"}, bson.M{"$set": bson.M{"n": 1}}, true, &result)
+
+		assert.Nil(t, err)
+		id, ok := result["_id"].(primitive.ObjectID)
+		assert.True(t, ok)
+		assert.Equal(t, result, FindTestDocument(t, service, id))
+	})
+	t.Run("BulkWriteReportsUpserts", func(t *testing.T) {
+		service := CreateTestService(t)
+		existing, created := primitive.NewObjectID(), primitive.NewObjectID()
+		InsertTestDocuments(t, service, bson.M{"_id": existing, "data": "exponent"})
+
+		models := []mongo.WriteModel{
+			mongo.NewUpdateOneModel().SetFilter(bson.M{"_id": existing}).SetUpdate(bson.M{"$set": bson.M{"data": "e"}}).SetUpsert(true),
+			mongo.NewUpdateOneModel().SetFilter(bson.M{"_id": created}).SetUpdate(bson.M{"$set": bson.M{"data": "pi"}}).SetUpsert(true),
+		}
+		result, err := service.BulkWrite(context.Background(), db.DBName(), TEST_COLLECTION_NAME, models, true)
+
+		assert.Nil(t, err)
+		assert.Empty(t, result.Errors)
+		assert.Equal(t, map[int]interface{}{1: created}, result.Upserted)
+		assert.Equal(t, "e", FindTestDocument(t, service, existing)["data"])
+		assert.Equal(t, "pi", FindTestDocument(t, service, created)["data"])
+	})
+}
+
+func TestNotFound(t *testing.T) {
+	service := CreateTestService(t)
+	InsertTestDocuments(t, service, bson.M{"data": "exponent"})
+	filter := bson.M{"_id": primitive.NewObjectID()}
+	ctx := context.Background()
+
+	var result bson.M
+	assert.ErrorIs(t, service.FindOne(ctx, db.DBName(), TEST_COLLECTION_NAME, filter, &result), db.ErrNotFound)
+	assert.ErrorIs(t, service.UpdateOne(ctx, db.DBName(), TEST_COLLECTION_NAME, filter, bson.M{"$set": bson.M{"data": "pi"}}), db.ErrNotFound)
+	assert.ErrorIs(t, service.FindOneAndUpdate(ctx, db.DBName(), TEST_COLLECTION_NAME, filter, bson.M{"$set": bson.M{"data": "pi"}}, false, &result), db.ErrNotFound)
+	assert.ErrorIs(t, service.ReplaceOne(ctx, db.DBName(), TEST_COLLECTION_NAME, filter, bson.M{"data": "pi"}), db.ErrNotFound)
+	assert.ErrorIs(t, service.DeleteOne(ctx, db.DBName(), TEST_COLLECTION_NAME, filter), db.ErrNotFound)
+	// the delete by id is idempotent
+	assert.Nil(t, service.Delete(ctx, db.DBName(), TEST_COLLECTION_NAME, filter["_id"].(primitive.ObjectID)))
+	assert.Len(t, FindIds(t, service, bson.M{}, db.FindOptions{}), 1)
+}
+
+func TestDuplicateKey(t *testing.T) {
+	t.Run("Insert", func(t *testing.T) {
+		service := CreateTestService(t)
+		id := primitive.NewObjectID()
+		InsertTestDocuments(t, service, bson.M{"_id": id, "data": "exponent"})
+
+		_, err := service.Insert(context.Background(), db.DBName(), TEST_COLLECTION_NAME, bson.M{"_id": id, "data": "pi"})
+
+		assert.NotNil(t, err)
+		assert.Equal(t, "exponent", FindTestDocument(t, service, id)["data"])
+	})
+	t.Run("UpsertOfNotMatchedId", func(t *testing.T) {
+		service := CreateTestService(t)
+		id := primitive.NewObjectID()
+		InsertTestDocuments(t, service, bson.M{"_id": id, "data": "exponent", "tenant": "acme"})
+
+		var result bson.M
+		filter := bson.M{"_id": id, "tenant": "globex"}
+		err := service.FindOneAndUpdate(context.Background(), db.DBName(), TEST_COLLECTION_NAME, filter, bson.M{"$set": bson.M{"data": "pi"}}, true, &result)
+
+		assert.ErrorIs(t, err, db.ErrDuplicateKey)
+		assert.Equal(t, "exponent", FindTestDocument(t, service, id)["data"])
+	})
+	t.Run("BulkWrite", func(t *testing.T) {
+		service := CreateTestService(t)
+		id := primitive.NewObjectID()
+		InsertTestDocuments(t, service, bson.M{"_id": id, "data": "exponent"})
+
+		models := []mongo.WriteModel{
+			mongo.NewInsertOneModel().SetDocument(bson.M{"_id": id, "data": "pi"}),
+			mongo.NewInsertOneModel().SetDocument(bson.M{"data": "e"}),
+		}
+		result, err := service.BulkWrite(context.Background(), db.DBName(), TEST_COLLECTION_NAME, models, false)
+
+		assert.Nil(t, err)
+		assert.Contains(t, result.Errors, 0)
+		assert.NotContains(t, result.Errors, 1)
+		assert.Len(t, FindIds(t, service, bson.M{}, db.FindOptions{}), 2)
+	})
+}
+
+func RunTx(t *testing.T, service db.MongoService, f db.QueryFuncVoid) error {
+	err := service.Tx(context.Background(), f)()
+	if errors.Is(err, db.ErrTransactionsUnsupported) {
+		t.Skip("transactions are not supported by the database")
+	}
+	return err
+}
+
+func TestTx(t *testing.T) {
+	// the first conflicts attempts of the transaction conflict with a write made outside of it
+	RunConflictingTx := func(t *testing.T, conflicts int) (int, bson.M, error) {
+		service := CreateTestService(t)
+		id := primitive.NewObjectID()
+		InsertTestDocuments(t, service, bson.M{"_id": id, "n": 0, "outside": 0})
+
+		attempts := 0
+		err := RunTx(t, service, func(tx db.MongoService) error {
+			attempts++
+			err := tx.UpdateOne(context.Background(), db.DBName(), TEST_COLLECTION_NAME, bson.M{"_id": id}, bson.M{"$inc": bson.M{"n": 1}})
+			if err != nil || attempts > conflicts {
+				return err
+			}
+			return service.UpdateOne(context.Background(), db.DBName(), TEST_COLLECTION_NAME, bson.M{"_id": id}, bson.M{"$inc": bson.M{"outside": 1}})
+		})
+		return attempts, FindTestDocument(t, service, id), err
+	}
+
+	t.Run("RetriesWriteConflict", func(t *testing.T) {
+		attempts, document, err := RunConflictingTx(t, 2)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 3, attempts)
+		assert.EqualValues(t, 1, document["n"])
+		assert.EqualValues(t, 2, document["outside"])
+	})
+	t.Run("GivesUpAfterMaxAttempts", func(t *testing.T) {
+		attempts, document, err := RunConflictingTx(t, db.TX_MAX_ATTEMPTS)
+
+		assert.ErrorIs(t, err, db.ErrTransactionConflict)
+		assert.Equal(t, db.TX_MAX_ATTEMPTS, attempts)
+		assert.EqualValues(t, 0, document["n"])
+		assert.EqualValues(t, db.TX_MAX_ATTEMPTS, document["outside"])
+	})
+	t.Run("DoesNotRetryOtherErrors", func(t *testing.T) {
+		service := CreateTestService(t)
+		id := primitive.NewObjectID()
+		InsertTestDocuments(t, service, bson.M{"_id": id, "n": 0})
+		expected := errors.New("validation failed")
+
+		attempts := 0
+		err := RunTx(t, service, func(tx db.MongoService) error {
+			attempts++
+			err := tx.UpdateOne(context.Background(), db.DBName(), TEST_COLLECTION_NAME, bson.M{"_id": id}, bson.M{"$inc": bson.M{"n": 1}})
+			if err != nil {
+				return err
+			}
+			return expected
+		})
+
+		assert.ErrorIs(t, err, expected)
+		assert.Equal(t, 1, attempts)
+		assert.EqualValues(t, 0, FindTestDocument(t, service, id)["n"])
+	})
+}
+
+func TestScope(t *testing.T) {
+	ctx := context.Background()
+	CreateScopedService := func(t *testing.T) (db.MongoService, primitive.ObjectID) {
+		service := CreateTestService(t)
+		other := primitive.NewObjectID()
+		InsertTestDocuments(t, service, bson.M{"_id": other, "data": "exponent", "tenant": "globex"})
+		return db.Scope(service, bson.M{"tenant": "acme"}), other
+	}
+	AssertUnchanged := func(t *testing.T, scoped db.MongoService, id primitive.ObjectID) {
+		var result bson.M
+		err := scoped.(*db.ScopedService).MongoService.FindOne(ctx, db.DBName(), TEST_COLLECTION_NAME, bson.M{"_id": id}, &result)
+		assert.Nil(t, err)
+		assert.Equal(t, bson.M{"_id": id, "data": "exponent", "tenant": "globex"}, result)
+	}
+
+	t.Run("UpsertInsertsIntoScope", func(t *testing.T) {
+		scoped, _ := CreateScopedService(t)
+		id := primitive.NewObjectID()
+
+		upserted, err := scoped.Upsert(ctx, db.DBName(), TEST_COLLECTION_NAME, id, bson.M{"data": "pi"})
+		assert.Nil(t, err)
+		assert.Equal(t, id, *upserted)
+
+		upserted, err = scoped.Upsert(ctx, db.DBName(), TEST_COLLECTION_NAME, id, bson.M{"data": "e"})
+		assert.Nil(t, err)
+		assert.Nil(t, upserted)
+		var result bson.M
+		assert.Nil(t, scoped.FindOne(ctx, db.DBName(), TEST_COLLECTION_NAME, bson.M{"_id": id}, &result))
+		assert.Equal(t, bson.M{"_id": id, "data": "e", "tenant": "acme"}, result)
+	})
+	t.Run("UpsertOfOtherScope", func(t *testing.T) {
+		scoped, other := CreateScopedService(t)
+
+		_, err := scoped.Upsert(ctx, db.DBName(), TEST_COLLECTION_NAME, other, bson.M{"data": "pi"})
+
+		assert.ErrorIs(t, err, db.ErrDuplicateKey)
+		AssertUnchanged(t, scoped, other)
+	})
+	t.Run("WritesOfOtherScope", func(t *testing.T) {
+		scoped, other := CreateScopedService(t)
+		filter := bson.M{"_id": other}
+		update := bson.M{"$set": bson.M{"data": "pi"}}
+
+		var result bson.M
+		assert.ErrorIs(t, scoped.UpdateOne(ctx, db.DBName(), TEST_COLLECTION_NAME, filter, update), db.ErrNotFound)
+		assert.ErrorIs(t, scoped.FindOneAndUpdate(ctx, db.DBName(), TEST_COLLECTION_NAME, filter, update, false, &result), db.ErrNotFound)
+		assert.ErrorIs(t, scoped.ReplaceOne(ctx, db.DBName(), TEST_COLLECTION_NAME, filter, bson.M{"data": "pi", "tenant": "acme"}), db.ErrNotFound)
+		assert.ErrorIs(t, scoped.DeleteOne(ctx, db.DBName(), TEST_COLLECTION_NAME, filter), db.ErrNotFound)
+		assert.Nil(t, scoped.Delete(ctx, db.DBName(), TEST_COLLECTION_NAME, other))
+
+		models := []mongo.WriteModel{
+			mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update),
+			mongo.NewReplaceOneModel().SetFilter(filter).SetReplacement(bson.M{"data": "pi", "tenant": "acme"}),
+			mongo.NewDeleteOneModel().SetFilter(filter),
+		}
+		_, err := scoped.BulkWrite(ctx, db.DBName(), TEST_COLLECTION_NAME, models, false)
+		assert.Nil(t, err)
+
+		err = RunTx(t, scoped, func(tx db.MongoService) error {
+			return tx.UpdateOne(ctx, db.DBName(), TEST_COLLECTION_NAME, filter, update)
+		})
+		assert.ErrorIs(t, err, db.ErrNotFound)
+		AssertUnchanged(t, scoped, other)
+	})
+}
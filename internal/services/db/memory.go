@@ -0,0 +1,527 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MemoryService keeps documents in process memory. It mirrors the semantics of the mongo backed Service
+// and is intended for local runs and tests without a live MongoDB. As the mongo queries, the queries fail with
+// the error of the context once it is done
+type MemoryService struct {
+	rwm         sync.RWMutex
+	collections map[string]map[primitive.ObjectID]bson.M
+	changes     memoryChangeLog
+}
+
+func (s *MemoryService) ShutDown() {
+}
+
+// Ping succeeds while the context is not done, the memory is always reachable
+func (s *MemoryService) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+func (s *MemoryService) Insert(ctx context.Context, dbName string, collectionName string, document interface{}) (*primitive.ObjectID, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	doc, err := toDocument(document)
+	if err != nil {
+		return nil, fmt.Errorf("unable to insert document '%v'. Error: %v", document, err)
+	}
+
+	id := primitive.NewObjectID()
+	if value, ok := doc["_id"]; ok {
+		id, ok = value.(primitive.ObjectID)
+		if !ok {
+			return nil, fmt.Errorf("unable to insert document '%v'. Error: unsupported type of _id", document)
+		}
+	}
+	doc["_id"] = id
+
+	s.rwm.Lock()
+	defer s.rwm.Unlock()
+
+	collection := s.collection(dbName, collectionName)
+	if _, exists := collection[id]; exists {
+		return nil, fmt.Errorf("unable to insert document '%v'. Error: duplicate key: %v", document, id.Hex())
+	}
+	collection[id] = doc
+	s.publish(dbName, collectionName, "insert", id, doc)
+
+	return &id, nil
+}
+
+func (s *MemoryService) Upsert(ctx context.Context, dbName string, collectionName string, id primitive.ObjectID, document interface{}) (*primitive.ObjectID, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	doc, err := toDocument(document)
+	if err != nil {
+		return nil, fmt.Errorf("unable to update document. ID: '%v'. Document: '%v'. Error: %v", id, document, err)
+	}
+
+	s.rwm.Lock()
+	defer s.rwm.Unlock()
+
+	collection := s.collection(dbName, collectionName)
+	existing, exists := collection[id]
+	if exists {
+		updated := copyDocument(existing)
+		err = applyUpdate(updated, bson.M{"$set": doc}, false)
+		if err != nil {
+			return nil, fmt.Errorf("unable to update document. ID: '%v'. Document: '%v'. Error: %v", id, document, err)
+		}
+		collection[id] = updated
+		s.publish(dbName, collectionName, "update", id, updated)
+		return nil, nil
+	}
+
+	doc["_id"] = id
+	collection[id] = doc
+	s.publish(dbName, collectionName, "insert", id, doc)
+	return &id, nil
+}
+
+func (s *MemoryService) Delete(ctx context.Context, dbName string, collectionName string, id primitive.ObjectID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.rwm.Lock()
+	defer s.rwm.Unlock()
+
+	collection := s.collection(dbName, collectionName)
+	if _, exists := collection[id]; exists {
+		delete(collection, id)
+		s.publish(dbName, collectionName, "delete", id, nil)
+	}
+	return nil
+}
+
+func (s *MemoryService) FindAll(ctx context.Context, dbName string, collectionName string, results interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.rwm.RLock()
+	documents := s.snapshot(dbName, collectionName)
+	s.rwm.RUnlock()
+
+	return decodeAll(documents, results)
+}
+
+func (s *MemoryService) Find(ctx context.Context, dbName string, collectionName string, filter interface{}, opts FindOptions, results interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	filterDoc, err := toFilter(filter)
+	if err != nil {
+		return fmt.Errorf("unable to find documents. Filter: '%v'. Error: %v", filter, err)
+	}
+
+	s.rwm.RLock()
+	documents := s.snapshot(dbName, collectionName)
+	s.rwm.RUnlock()
+
+	selected := make([]bson.M, 0)
+	for _, doc := range documents {
+		ok, err := matches(doc, filterDoc)
+		if err != nil {
+			return fmt.Errorf("unable to find documents. Filter: '%v'. Error: %v", filter, err)
+		}
+		if ok {
+			selected = append(selected, doc)
+		}
+	}
+
+	sortDocuments(selected, opts.Sort)
+	if opts.Limit > 0 && int64(len(selected)) > opts.Limit {
+		selected = selected[:opts.Limit]
+	}
+
+	return decodeAll(selected, results)
+}
+
+func (s *MemoryService) FindOne(ctx context.Context, dbName string, collectionName string, filter interface{}, result interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.rwm.RLock()
+	doc, err := s.findOne(dbName, collectionName, filter)
+	if doc != nil {
+		doc = copyDocument(doc)
+	}
+	s.rwm.RUnlock()
+
+	if err != nil {
+		return fmt.Errorf("unable to find document. Filter: '%v'. Error: %v", filter, err)
+	}
+	if doc == nil {
+		return ErrNotFound
+	}
+	return decode(doc, result)
+}
+
+func (s *MemoryService) UpdateOne(ctx context.Context, dbName string, collectionName string, filter interface{}, update interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.rwm.Lock()
+	defer s.rwm.Unlock()
+
+	_, _, err := s.updateOne(dbName, collectionName, filter, update, false)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("unable to update document. Filter: '%v'. Update: '%v'. Error: %v", filter, update, err)
+	}
+	return err
+}
+
+func (s *MemoryService) FindOneAndUpdate(ctx context.Context, dbName string, collectionName string, filter interface{}, update interface{}, upsert bool, result interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.rwm.Lock()
+	updated, _, err := s.updateOne(dbName, collectionName, filter, update, upsert)
+	if updated != nil {
+		updated = copyDocument(updated)
+	}
+	s.rwm.Unlock()
+
+	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrDuplicateKey) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("unable to update document. Filter: '%v'. Update: '%v'. Error: %v", filter, update, err)
+	}
+	return decode(updated, result)
+}
+
+func (s *MemoryService) ReplaceOne(ctx context.Context, dbName string, collectionName string, filter interface{}, replacement interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	replacementDoc, err := toDocument(replacement)
+	if err != nil {
+		return fmt.Errorf("unable to replace document. Filter: '%v'. Document: '%v'. Error: %v", filter, replacement, err)
+	}
+
+	s.rwm.Lock()
+	defer s.rwm.Unlock()
+
+	doc, err := s.findOne(dbName, collectionName, filter)
+	if err != nil {
+		return fmt.Errorf("unable to replace document. Filter: '%v'. Document: '%v'. Error: %v", filter, replacement, err)
+	}
+	if doc == nil {
+		return ErrNotFound
+	}
+
+	id := doc["_id"].(primitive.ObjectID)
+	replacementDoc["_id"] = id
+	s.collection(dbName, collectionName)[id] = replacementDoc
+	s.publish(dbName, collectionName, "replace", id, replacementDoc)
+	return nil
+}
+
+func (s *MemoryService) DeleteOne(ctx context.Context, dbName string, collectionName string, filter interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.rwm.Lock()
+	defer s.rwm.Unlock()
+
+	doc, err := s.findOne(dbName, collectionName, filter)
+	if err != nil {
+		return fmt.Errorf("unable to delete document. Filter: '%v'. Error: %v", filter, err)
+	}
+	if doc == nil {
+		return ErrNotFound
+	}
+
+	id := doc["_id"].(primitive.ObjectID)
+	delete(s.collection(dbName, collectionName), id)
+	s.publish(dbName, collectionName, "delete", id, nil)
+	return nil
+}
+
+func (s *MemoryService) BulkWrite(ctx context.Context, dbName string, collectionName string, models []mongo.WriteModel, ordered bool) (*BulkResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.rwm.Lock()
+	defer s.rwm.Unlock()
+
+	result := &BulkResult{Upserted: make(map[int]interface{}), Errors: make(map[int]string)}
+	for index, model := range models {
+		err := s.write(dbName, collectionName, model, index, result)
+		if err != nil {
+			result.Errors[index] = err.Error()
+			if ordered {
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+// write executes one write of a bulk, must be called under the write lock
+func (s *MemoryService) write(dbName string, collectionName string, model mongo.WriteModel, index int, result *BulkResult) error {
+	switch typed := model.(type) {
+	case *mongo.InsertOneModel:
+		doc, err := toDocument(typed.Document)
+		if err != nil {
+			return err
+		}
+		id, ok := doc["_id"].(primitive.ObjectID)
+		if !ok {
+			id = primitive.NewObjectID()
+			doc["_id"] = id
+		}
+		collection := s.collection(dbName, collectionName)
+		if _, exists := collection[id]; exists {
+			return fmt.Errorf("duplicate key: %v", id.Hex())
+		}
+		collection[id] = doc
+		s.publish(dbName, collectionName, "insert", id, doc)
+	case *mongo.UpdateOneModel:
+		upsert := typed.Upsert != nil && *typed.Upsert
+		updated, inserted, err := s.updateOne(dbName, collectionName, typed.Filter, typed.Update, upsert)
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if inserted {
+			result.Upserted[index] = updated["_id"]
+		}
+	case *mongo.DeleteOneModel:
+		doc, err := s.findOne(dbName, collectionName, typed.Filter)
+		if err != nil || doc == nil {
+			return err
+		}
+		id := doc["_id"].(primitive.ObjectID)
+		delete(s.collection(dbName, collectionName), id)
+		s.publish(dbName, collectionName, "delete", id, nil)
+	default:
+		return fmt.Errorf("unsupported write model: %T", model)
+	}
+	return nil
+}
+
+// CreateIndex does nothing: memory collections are scanned, and text search works without an index
+func (s *MemoryService) CreateIndex(ctx context.Context, dbName string, collectionName string, index mongo.IndexModel) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *MemoryService) Drop(ctx context.Context, dbName string, collectionName string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.rwm.Lock()
+	defer s.rwm.Unlock()
+
+	delete(s.collections, collectionKey(dbName, collectionName))
+	s.publish(dbName, collectionName, "drop", nil, nil)
+	s.publish(dbName, collectionName, "invalidate", nil, nil)
+	return nil
+}
+
+// updateOne applies the update to the first matched document and publishes the change. Without the upsert
+// returns ErrNotFound if nothing is matched. Must be called under the write lock
+func (s *MemoryService) updateOne(dbName string, collectionName string, filter interface{}, update interface{}, upsert bool) (bson.M, bool, error) {
+	filterDoc, err := toFilter(filter)
+	if err != nil {
+		return nil, false, err
+	}
+	updateDoc, err := toDocument(update)
+	if err != nil {
+		return nil, false, err
+	}
+
+	doc, err := s.findOne(dbName, collectionName, filterDoc)
+	if err != nil {
+		return nil, false, err
+	}
+	if doc == nil && !upsert {
+		return nil, false, ErrNotFound
+	}
+
+	inserting := doc == nil
+	var updated bson.M
+	if inserting {
+		updated = insertedDocument(filterDoc)
+	} else {
+		updated = copyDocument(doc)
+	}
+	err = applyUpdate(updated, updateDoc, inserting)
+	if err != nil {
+		return nil, false, err
+	}
+
+	id := updated["_id"].(primitive.ObjectID)
+	if _, exists := s.collection(dbName, collectionName)[id]; exists && inserting {
+		return nil, false, fmt.Errorf("%w: %v", ErrDuplicateKey, id.Hex())
+	}
+	s.collection(dbName, collectionName)[id] = updated
+	if inserting {
+		s.publish(dbName, collectionName, "insert", id, updated)
+	} else {
+		s.publish(dbName, collectionName, "update", id, updated)
+	}
+	return updated, inserting, nil
+}
+
+func (s *MemoryService) collection(dbName string, collectionName string) map[primitive.ObjectID]bson.M {
+	key := collectionKey(dbName, collectionName)
+	collection, ok := s.collections[key]
+	if !ok {
+		collection = make(map[primitive.ObjectID]bson.M)
+		s.collections[key] = collection
+	}
+	return collection
+}
+
+// findOne returns the stored document matching the filter or nil. Filters by _id are resolved without a scan
+func (s *MemoryService) findOne(dbName string, collectionName string, filter interface{}) (bson.M, error) {
+	filterDoc, err := toFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	collection := s.collections[collectionKey(dbName, collectionName)]
+	if id, ok := filterDoc["_id"].(primitive.ObjectID); ok {
+		doc, exists := collection[id]
+		if !exists {
+			return nil, nil
+		}
+		ok, err := matches(doc, filterDoc)
+		if err != nil || !ok {
+			return nil, err
+		}
+		return doc, nil
+	}
+
+	for _, doc := range s.snapshot(dbName, collectionName) {
+		ok, err := matches(doc, filterDoc)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return collection[doc["_id"].(primitive.ObjectID)], nil
+		}
+	}
+	return nil, nil
+}
+
+// snapshot returns copies of documents ordered by _id, which approximates the natural order of a mongo collection
+func (s *MemoryService) snapshot(dbName string, collectionName string) []bson.M {
+	collection := s.collections[collectionKey(dbName, collectionName)]
+	result := make([]bson.M, 0, len(collection))
+	for _, doc := range collection {
+		result = append(result, copyDocument(doc))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		left := result[i]["_id"].(primitive.ObjectID)
+		right := result[j]["_id"].(primitive.ObjectID)
+		return bytes.Compare(left[:], right[:]) < 0
+	})
+	return result
+}
+
+func createMemoryService() *MemoryService {
+	return &MemoryService{
+		collections: make(map[string]map[primitive.ObjectID]bson.M),
+		changes:     memoryChangeLog{notify: make(chan struct{})},
+	}
+}
+
+func collectionKey(dbName string, collectionName string) string {
+	return dbName + "." + collectionName
+}
+
+// toDocument converts any bson serializable value into a plain document, so stored values never share memory with callers
+func toDocument(document interface{}) (bson.M, error) {
+	raw, err := bson.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
+	var result bson.M
+	err = bson.Unmarshal(raw, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// insertedDocument takes equality conditions of the upsert filter as the initial fields of the new document
+func insertedDocument(filter bson.M) bson.M {
+	result := bson.M{"_id": primitive.NewObjectID()}
+	for key, value := range filter {
+		if strings.HasPrefix(key, "$") {
+			continue
+		}
+		if operators, ok := value.(bson.M); ok && isOperatorDocument(operators) {
+			continue
+		}
+		result[key] = value
+	}
+	return result
+}
+
+func toFilter(filter interface{}) (bson.M, error) {
+	if filter == nil {
+		return bson.M{}, nil
+	}
+	return toDocument(filter)
+}
+
+func copyDocument(doc bson.M) bson.M {
+	result := make(bson.M, len(doc))
+	for key, value := range doc {
+		result[key] = value
+	}
+	return result
+}
+
+func decode(document bson.M, result interface{}) error {
+	raw, err := bson.Marshal(document)
+	if err != nil {
+		return fmt.Errorf("unable to decode document. Error: %v", err)
+	}
+	err = bson.Unmarshal(raw, result)
+	if err != nil {
+		return fmt.Errorf("unable to decode document. Error: %v", err)
+	}
+	return nil
+}
+
+func decodeAll(documents []bson.M, results interface{}) error {
+	items := make([]interface{}, len(documents))
+	for i, doc := range documents {
+		items[i] = doc
+	}
+
+	cursor, err := mongo.NewCursorFromDocuments(items, nil, nil)
+	if err != nil {
+		return fmt.Errorf("unable to decode documents. Error: %v", err)
+	}
+
+	err = cursor.All(context.Background(), results)
+	if err != nil {
+		return fmt.Errorf("unable to decode documents. Error: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,343 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// matches evaluates a mongo query filter against a stored document.
+// Only the subset of query operators used by the services is supported
+func matches(doc bson.M, filter bson.M) (bool, error) {
+	for key, condition := range filter {
+		var ok bool
+		var err error
+		switch key {
+		case "$and":
+			ok, err = matchesAll(doc, condition, true)
+		case "$or":
+			ok, err = matchesAll(doc, condition, false)
+		case "$text":
+			ok, err = matchesText(doc, condition)
+		default:
+			ok, err = matchesField(doc[key], condition)
+		}
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchesAll(doc bson.M, condition interface{}, all bool) (bool, error) {
+	filters, ok := condition.(bson.A)
+	if !ok {
+		return false, fmt.Errorf("unsupported filter: expected array, got %T", condition)
+	}
+	for _, item := range filters {
+		filter, ok := item.(bson.M)
+		if !ok {
+			return false, fmt.Errorf("unsupported filter: expected document, got %T", item)
+		}
+		result, err := matches(doc, filter)
+		if err != nil {
+			return false, err
+		}
+		if result != all {
+			return result, nil
+		}
+	}
+	return all, nil
+}
+
+// TEXT_INDEX_FIELD is the field of the only text index, the one over the records data
+const TEXT_INDEX_FIELD = "data"
+
+// matchesText emulates the text index over the TEXT_INDEX_FIELD of the document
+func matchesText(doc bson.M, condition interface{}) (bool, error) {
+	operators, ok := condition.(bson.M)
+	if !ok {
+		return false, fmt.Errorf("unsupported $text: expected document, got %T", condition)
+	}
+	search, ok := operators["$search"].(string)
+	if !ok {
+		return false, fmt.Errorf("unsupported $text: missed $search")
+	}
+
+	text, ok := doc[TEXT_INDEX_FIELD].(string)
+	if !ok {
+		return false, nil
+	}
+	terms := TextTerms(search)
+	for _, word := range TextTerms(text) {
+		for _, term := range terms {
+			if word == term {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// TextTerms splits the text into lower case words. Text indexes are created without a language,
+// so mongo does not apply stemming and stop words either
+func TextTerms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func matchesField(value interface{}, condition interface{}) (bool, error) {
+	operators, ok := condition.(bson.M)
+	if !ok || !isOperatorDocument(operators) {
+		return compare(value, condition) == 0, nil
+	}
+
+	for operator, operand := range operators {
+		var ok bool
+		switch operator {
+		case "$eq":
+			ok = compare(value, operand) == 0
+		case "$ne":
+			ok = compare(value, operand) != 0
+		case "$gt":
+			ok = value != nil && compare(value, operand) > 0
+		case "$gte":
+			ok = value != nil && compare(value, operand) >= 0
+		case "$lt":
+			ok = value != nil && compare(value, operand) < 0
+		case "$lte":
+			ok = value != nil && compare(value, operand) <= 0
+		case "$in":
+			ok = contains(operand, value)
+		case "$nin":
+			ok = !contains(operand, value)
+		case "$exists":
+			exists, _ := operand.(bool)
+			ok = (value != nil) == exists
+		case "$regex":
+			var err error
+			ok, err = matchesRegex(value, operand, operators["$options"])
+			if err != nil {
+				return false, err
+			}
+		case "$options":
+			ok = true
+		default:
+			return false, fmt.Errorf("unsupported query operator: %v", operator)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func isOperatorDocument(doc bson.M) bool {
+	for key := range doc {
+		if !strings.HasPrefix(key, "$") {
+			return false
+		}
+	}
+	return len(doc) != 0
+}
+
+func contains(values interface{}, value interface{}) bool {
+	items, ok := values.(bson.A)
+	if !ok {
+		return false
+	}
+	for _, item := range items {
+		if compare(value, item) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesRegex(value interface{}, pattern interface{}, options interface{}) (bool, error) {
+	text, ok := value.(string)
+	if !ok {
+		return false, nil
+	}
+
+	var expression, flags string
+	switch typed := pattern.(type) {
+	case primitive.Regex:
+		expression, flags = typed.Pattern, typed.Options
+	case string:
+		expression = typed
+	default:
+		return false, fmt.Errorf("unsupported $regex value: %T", pattern)
+	}
+	if extra, ok := options.(string); ok {
+		flags += extra
+	}
+	if strings.Contains(flags, "i") {
+		expression = "(?i)" + expression
+	}
+
+	re, err := regexp.Compile(expression)
+	if err != nil {
+		return false, fmt.Errorf("invalid $regex: %v", err)
+	}
+	return re.MatchString(text), nil
+}
+
+// sortDocuments orders documents by a mongo sort specification, where 1 is ascending and -1 is descending
+func sortDocuments(documents []bson.M, spec bson.D) {
+	if len(spec) == 0 {
+		return
+	}
+	sort.SliceStable(documents, func(i, j int) bool {
+		for _, field := range spec {
+			result := compare(documents[i][field.Key], documents[j][field.Key])
+			if result == 0 {
+				continue
+			}
+			if direction, _ := toFloat(field.Value); direction < 0 {
+				return result > 0
+			}
+			return result < 0
+		}
+		return false
+	})
+}
+
+// compare orders two bson values. Values of different kinds are ordered by the kind, like mongo does
+func compare(left interface{}, right interface{}) int {
+	leftRank, rightRank := typeRank(left), typeRank(right)
+	if leftRank != rightRank {
+		return leftRank - rightRank
+	}
+
+	switch typed := left.(type) {
+	case nil:
+		return 0
+	case string:
+		return strings.Compare(typed, right.(string))
+	case primitive.ObjectID:
+		id := right.(primitive.ObjectID)
+		return bytes.Compare(typed[:], id[:])
+	case primitive.DateTime:
+		return compareFloat(float64(typed), float64(right.(primitive.DateTime)))
+	case bool:
+		if typed == right.(bool) {
+			return 0
+		}
+		if typed {
+			return 1
+		}
+		return -1
+	}
+
+	if leftNumber, ok := toFloat(left); ok {
+		rightNumber, _ := toFloat(right)
+		return compareFloat(leftNumber, rightNumber)
+	}
+	return strings.Compare(fmt.Sprint(left), fmt.Sprint(right))
+}
+
+func typeRank(value interface{}) int {
+	switch value.(type) {
+	case nil:
+		return 0
+	case int32, int64, float64:
+		return 1
+	case string:
+		return 2
+	case bson.M:
+		return 3
+	case bson.A:
+		return 4
+	case primitive.Binary:
+		return 5
+	case primitive.ObjectID:
+		return 6
+	case bool:
+		return 7
+	case primitive.DateTime:
+		return 8
+	}
+	return 9
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch typed := value.(type) {
+	case int:
+		return float64(typed), true
+	case int32:
+		return float64(typed), true
+	case int64:
+		return float64(typed), true
+	case float64:
+		return typed, true
+	}
+	return 0, false
+}
+
+func compareFloat(left float64, right float64) int {
+	switch {
+	case left < right:
+		return -1
+	case left > right:
+		return 1
+	}
+	return 0
+}
+
+// applyUpdate executes a mongo update document against a stored document. $setOnInsert is applied only for upserted documents
+func applyUpdate(doc bson.M, update bson.M, inserting bool) error {
+	for operator, operand := range update {
+		fields, ok := operand.(bson.M)
+		if !ok {
+			return fmt.Errorf("unsupported update: expected document for %v, got %T", operator, operand)
+		}
+		for key, value := range fields {
+			switch operator {
+			case "$set":
+				doc[key] = value
+			case "$setOnInsert":
+				if inserting {
+					doc[key] = value
+				}
+			case "$unset":
+				delete(doc, key)
+			case "$inc":
+				current, _ := toFloat(doc[key])
+				delta, ok := toFloat(value)
+				if !ok {
+					return fmt.Errorf("unsupported $inc value: %T", value)
+				}
+				doc[key] = increment(doc[key], value, current+delta)
+			case "$currentDate":
+				doc[key] = primitive.NewDateTimeFromTime(time.Now())
+			default:
+				return fmt.Errorf("unsupported update operator: %v", operator)
+			}
+		}
+	}
+	return nil
+}
+
+// increment keeps the integer types of mongo $inc results
+func increment(current interface{}, delta interface{}, sum float64) interface{} {
+	_, currentIsFloat := current.(float64)
+	_, deltaIsFloat := delta.(float64)
+	if currentIsFloat || deltaIsFloat {
+		return sum
+	}
+	_, currentIsLong := current.(int64)
+	_, deltaIsLong := delta.(int64)
+	if currentIsLong || deltaIsLong {
+		return int64(sum)
+	}
+	return int32(sum)
+}
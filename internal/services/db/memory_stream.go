@@ -0,0 +1,185 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	MEMORY_CHANGE_LOG_LIMIT = 10000
+)
+
+// memoryChangeLog is the in process analogue of the oplog. It keeps the latest changes of all collections,
+// so change streams are able to resume after a token while the change is still in the log
+type memoryChangeLog struct {
+	changes []memoryChange
+	seq     int64
+	// notify is closed and replaced on every change to wake up waiting streams
+	notify chan struct{}
+}
+
+type memoryChange struct {
+	seq        int64
+	collection string
+	event      bson.M
+}
+
+type memoryChangeStream struct {
+	service    *MemoryService
+	collection string
+	last       int64
+	current    bson.M
+	err        error
+	closed     chan struct{}
+	closeOnce  sync.Once
+}
+
+func (s *MemoryService) Watch(ctx context.Context, dbName string, collectionName string, resumeToken bson.Raw) (ChangeStream, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.rwm.RLock()
+	defer s.rwm.RUnlock()
+
+	last := s.changes.seq
+	if resumeToken != nil {
+		var err error
+		last, err = parseResumeToken(resumeToken)
+		if err != nil {
+			return nil, err
+		}
+		if s.changes.lost(last) {
+			return nil, ErrChangeStreamHistoryLost
+		}
+	}
+
+	return &memoryChangeStream{
+		service:    s,
+		collection: collectionKey(dbName, collectionName),
+		last:       last,
+		closed:     make(chan struct{}),
+	}, nil
+}
+
+// publish must be called under the write lock
+func (s *MemoryService) publish(dbName string, collectionName string, operationType string, id interface{}, doc bson.M) {
+	event := bson.M{"operationType": operationType}
+	if id != nil {
+		event["documentKey"] = bson.M{"_id": id}
+	}
+	if doc != nil {
+		event["fullDocument"] = copyDocument(doc)
+	}
+	s.changes.append(collectionKey(dbName, collectionName), event)
+}
+
+// append stamps the event with the next resume token and wakes up the streams
+func (l *memoryChangeLog) append(collection string, event bson.M) {
+	l.seq++
+	event["_id"] = resumeTokenDocument(l.seq)
+
+	l.changes = append(l.changes, memoryChange{
+		seq:        l.seq,
+		collection: collection,
+		event:      event,
+	})
+	if len(l.changes) > MEMORY_CHANGE_LOG_LIMIT {
+		l.changes = append([]memoryChange(nil), l.changes[MEMORY_CHANGE_LOG_LIMIT/2:]...)
+	}
+
+	close(l.notify)
+	l.notify = make(chan struct{})
+}
+
+// lost reports whether changes after the seq have been already dropped from the log
+func (l *memoryChangeLog) lost(seq int64) bool {
+	return len(l.changes) != 0 && seq+1 < l.changes[0].seq
+}
+
+func (cs *memoryChangeStream) Next(ctx context.Context) bool {
+	for {
+		if cs.err != nil {
+			return false
+		}
+		if cs.current != nil && cs.current["operationType"] == "invalidate" {
+			cs.err = fmt.Errorf("change stream is invalidated")
+			return false
+		}
+
+		cs.service.rwm.RLock()
+		log := &cs.service.changes
+		if log.lost(cs.last) {
+			cs.service.rwm.RUnlock()
+			cs.err = ErrChangeStreamHistoryLost
+			return false
+		}
+		var event bson.M
+		if len(log.changes) != 0 {
+			for i := int(cs.last + 1 - log.changes[0].seq); i < len(log.changes); i++ {
+				cs.last = log.changes[i].seq
+				if log.changes[i].collection == cs.collection {
+					event = log.changes[i].event
+					break
+				}
+			}
+		}
+		notify := log.notify
+		cs.service.rwm.RUnlock()
+
+		if event != nil {
+			cs.current = event
+			return true
+		}
+
+		select {
+		case <-notify:
+		case <-cs.closed:
+			return false
+		case <-ctx.Done():
+			cs.err = ctx.Err()
+			return false
+		}
+	}
+}
+
+func (cs *memoryChangeStream) Decode(val interface{}) error {
+	if cs.current == nil {
+		return fmt.Errorf("unable to decode change event: there is no current event")
+	}
+	return decode(cs.current, val)
+}
+
+func (cs *memoryChangeStream) ResumeToken() bson.Raw {
+	raw, _ := bson.Marshal(resumeTokenDocument(cs.last))
+	return raw
+}
+
+func (cs *memoryChangeStream) Err() error {
+	return cs.err
+}
+
+func (cs *memoryChangeStream) Close(ctx context.Context) error {
+	cs.closeOnce.Do(func() {
+		close(cs.closed)
+	})
+	return nil
+}
+
+func resumeTokenDocument(seq int64) bson.M {
+	return bson.M{"_data": seq}
+}
+
+func parseResumeToken(token bson.Raw) (int64, error) {
+	value, err := token.LookupErr("_data")
+	if err != nil {
+		return 0, fmt.Errorf("invalid resume token: %v", err)
+	}
+	seq, ok := value.Int64OK()
+	if !ok {
+		return 0, fmt.Errorf("invalid resume token: unexpected type %v", value.Type)
+	}
+	return seq, nil
+}
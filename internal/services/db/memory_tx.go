@@ -0,0 +1,123 @@
+package db
+
+import (
+	"context"
+	"reflect"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memoryWriteConflict is the analogue of the mongo WriteConflict error, it is retried as the mongo one
+type memoryWriteConflict struct {
+}
+
+func (memoryWriteConflict) Error() string {
+	return "write conflict: the documents have been changed since the start of the transaction"
+}
+
+func (memoryWriteConflict) HasErrorLabel(label string) bool {
+	return label == LABEL_TRANSIENT_TRANSACTION_ERROR
+}
+
+// memoryWrite is a document written by a transaction, nil doc means the document is deleted
+type memoryWrite struct {
+	collection string
+	id         primitive.ObjectID
+	doc        bson.M
+}
+
+// SupportsTransactions is always true: the memory driver isolates transactions by snapshots
+func (s *MemoryService) SupportsTransactions(ctx context.Context) (bool, error) {
+	return true, nil
+}
+
+// Tx runs f on a copy of the collections and applies its writes at the commit. The first committer wins:
+// if a document written by the transaction has been changed since its start, the transaction is retried
+// as a mongo one on a write conflict
+func (s *MemoryService) Tx(ctx context.Context, f QueryFuncVoid) func() error {
+	return func() error {
+		return retryTx(func() error {
+			s.rwm.RLock()
+			started := s.copyCollections()
+			tx := &MemoryService{
+				collections: s.copyCollections(),
+				changes:     memoryChangeLog{notify: make(chan struct{})},
+			}
+			s.rwm.RUnlock()
+
+			err := f(tx)
+			if err != nil {
+				return err
+			}
+			return s.commit(started, tx)
+		})
+	}
+}
+
+func (s *MemoryService) commit(started map[string]map[primitive.ObjectID]bson.M, tx *MemoryService) error {
+	s.rwm.Lock()
+	defer s.rwm.Unlock()
+
+	writes := make([]memoryWrite, 0)
+	for key, collection := range tx.collections {
+		for id, doc := range collection {
+			if !sameDocument(doc, started[key][id]) {
+				writes = append(writes, memoryWrite{collection: key, id: id, doc: doc})
+			}
+		}
+	}
+	for key, collection := range started {
+		for id := range collection {
+			if _, exists := tx.collections[key][id]; !exists {
+				writes = append(writes, memoryWrite{collection: key, id: id})
+			}
+		}
+	}
+
+	// documents are never changed in place, so an unchanged document is the same map as at the start
+	for _, w := range writes {
+		if !sameDocument(s.collections[w.collection][w.id], started[w.collection][w.id]) {
+			return memoryWriteConflict{}
+		}
+	}
+
+	for _, w := range writes {
+		collection, ok := s.collections[w.collection]
+		if !ok {
+			collection = make(map[primitive.ObjectID]bson.M)
+			s.collections[w.collection] = collection
+		}
+		if w.doc == nil {
+			delete(collection, w.id)
+		} else {
+			collection[w.id] = w.doc
+		}
+	}
+	for _, change := range tx.changes.changes {
+		event := copyDocument(change.event)
+		delete(event, "_id")
+		s.changes.append(change.collection, event)
+	}
+	return nil
+}
+
+// copyCollections copies the maps of collections sharing the documents, must be called under the lock
+func (s *MemoryService) copyCollections() map[string]map[primitive.ObjectID]bson.M {
+	result := make(map[string]map[primitive.ObjectID]bson.M, len(s.collections))
+	for key, collection := range s.collections {
+		copied := make(map[primitive.ObjectID]bson.M, len(collection))
+		for id, doc := range collection {
+			copied[id] = doc
+		}
+		result[key] = copied
+	}
+	return result
+}
+
+func sameDocument(left bson.M, right bson.M) bool {
+	if left == nil || right == nil {
+		return left == nil && right == nil
+	}
+	return reflect.ValueOf(left).Pointer() == reflect.ValueOf(right).Pointer()
+}
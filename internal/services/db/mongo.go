@@ -2,44 +2,127 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
-	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ArtemVoronov/artforintrovert-test/internal/api"
-	"github.com/ArtemVoronov/artforintrovert-test/internal/utils"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/logging"
+	"github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
 )
 
+const (
+	DRIVER_MONGO  = "mongo"
+	DRIVER_MEMORY = "memory"
+)
+
+var ErrNotFound = errors.New("document not found")
+
+// ErrChangeStreamsUnsupported is returned by Watch when the deployment is not a replica set
+var ErrChangeStreamsUnsupported = errors.New("change streams are supported only by replica sets")
+
+// ErrChangeStreamHistoryLost means that the resume token is too old to continue the change stream
+var ErrChangeStreamHistoryLost = errors.New("change stream history is lost")
+
+// ErrTransactionsUnsupported is returned by Tx when the deployment is neither a replica set nor a sharded cluster
+var ErrTransactionsUnsupported = errors.New("transactions are supported only by replica sets and sharded clusters")
+
+// ErrTransactionConflict is returned by Tx when the transaction keeps failing with transient errors, e.g. write conflicts
+var ErrTransactionConflict = errors.New("transaction conflicts with concurrent writes")
+
+// ErrDuplicateKey is returned by FindOneAndUpdate when the upsert creates a document with the _id of another one
+var ErrDuplicateKey = errors.New("duplicate key")
+
+const (
+	errorCodeChangeStreamHistoryLost  = 286
+	errorCodeChangeStreamsUnsupported = 40573
+)
+
+const (
+	LABEL_TRANSIENT_TRANSACTION_ERROR       = "TransientTransactionError"
+	LABEL_UNKNOWN_TRANSACTION_COMMIT_RESULT = "UnknownTransactionCommitResult"
+	TX_MAX_ATTEMPTS                         = 5
+)
+
+const (
+	transactionsUnknown int32 = iota
+	transactionsSupported
+	transactionsUnsupported
+)
+
+// ChangeStream is implemented by *mongo.ChangeStream
+type ChangeStream interface {
+	Next(ctx context.Context) bool
+	Decode(val interface{}) error
+	ResumeToken() bson.Raw
+	Err() error
+	Close(ctx context.Context) error
+}
+
+type FindOptions struct {
+	Sort  bson.D
+	Limit int64
+}
+
+// BulkResult is the outcome of every write of BulkWrite. The writes which are neither upserted nor failed
+// are done, except the ones after the first failure of an ordered bulk
+type BulkResult struct {
+	// Upserted maps the index of the write to the id of the inserted document
+	Upserted map[int]interface{}
+	// Errors maps the index of the write to the error message
+	Errors map[int]string
+}
+
 type MongoService interface {
 	ShutDown()
 
-	GetCollection(dbName string, collectionName string) *mongo.Collection
-	Insert(dbName string, collectionName string, document interface{}) (*primitive.ObjectID, error)
-	Upsert(dbName string, collectionName string, id primitive.ObjectID, document interface{}) (*primitive.ObjectID, error)
-	Delete(dbName string, collectionName string, id primitive.ObjectID) error
+	Insert(ctx context.Context, dbName string, collectionName string, document interface{}) (*primitive.ObjectID, error)
+	Upsert(ctx context.Context, dbName string, collectionName string, id primitive.ObjectID, document interface{}) (*primitive.ObjectID, error)
+	Delete(ctx context.Context, dbName string, collectionName string, id primitive.ObjectID) error
+	FindAll(ctx context.Context, dbName string, collectionName string, results interface{}) error
+	Find(ctx context.Context, dbName string, collectionName string, filter interface{}, opts FindOptions, results interface{}) error
+	FindOne(ctx context.Context, dbName string, collectionName string, filter interface{}, result interface{}) error
+	UpdateOne(ctx context.Context, dbName string, collectionName string, filter interface{}, update interface{}) error
+	// FindOneAndUpdate applies the update and decodes the updated document into the result. Without the upsert
+	// returns ErrNotFound if nothing is matched
+	FindOneAndUpdate(ctx context.Context, dbName string, collectionName string, filter interface{}, update interface{}, upsert bool, result interface{}) error
+	ReplaceOne(ctx context.Context, dbName string, collectionName string, filter interface{}, replacement interface{}) error
+	// BulkWrite executes the writes in one request. An ordered bulk stops at the first failed write, an unordered one
+	// tries all of them. Failures of the writes are reported by the result, the error is returned only if the request failed
+	BulkWrite(ctx context.Context, dbName string, collectionName string, models []mongo.WriteModel, ordered bool) (*BulkResult, error)
+	DeleteOne(ctx context.Context, dbName string, collectionName string, filter interface{}) error
+	CreateIndex(ctx context.Context, dbName string, collectionName string, index mongo.IndexModel) error
+	// Watch opens a change stream over the collection with full documents for updates. A nil token starts from now
+	Watch(ctx context.Context, dbName string, collectionName string, resumeToken bson.Raw) (ChangeStream, error)
+	Drop(ctx context.Context, dbName string, collectionName string) error
+	// SupportsTransactions tells whether the deployment is able to run Tx
+	SupportsTransactions(ctx context.Context) (bool, error)
+	// Tx returns the function running f in a transaction: the operations of the service passed to f are executed
+	// in the transaction, whatever context they get. f may be called several times, because the transaction
+	// is retried on transient errors
+	Tx(ctx context.Context, f QueryFuncVoid) func() error
+	// Ping checks that the deployment is reachable before the deadline of the context
+	Ping(ctx context.Context) error
 }
 
+// Service runs every query in the context of the caller limited by the query timeout, so the query of a cancelled
+// request is cancelled as well
 type Service struct {
 	connectTimeout time.Duration
 	queryTimeout   time.Duration
 	client         *mongo.Client
-}
-
-var once sync.Once
-var instance *Service
-
-func Instance() *Service {
-	once.Do(func() {
-		if instance == nil {
-			instance = createService()
-		}
-	})
-	return instance
+	// session is the session of the transaction, nil outside of it
+	session mongo.Session
+	// transactions caches the result of the transactions support detection
+	transactions *int32
+	log          *logrus.Entry
 }
 
 func (s *Service) ShutDown() {
@@ -48,24 +131,32 @@ func (s *Service) ShutDown() {
 	defer func() {
 		err := s.client.Disconnect(ctx)
 		if err != nil {
-			log.Printf("mongo client unable to disconnect: %v", err)
+			s.log.WithError(err).Error("mongo client unable to disconnect")
 		}
 	}()
 }
 
+// queryContext limits the query of the caller by the timeout. Inside a transaction the context carries the session
+func (s *Service) queryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.session != nil {
+		ctx = mongo.NewSessionContext(ctx, s.session)
+	}
+	return context.WithTimeout(ctx, s.queryTimeout)
+}
+
 func (s *Service) GetCollection(dbName string, collectionName string) *mongo.Collection {
 	return s.client.Database(dbName).Collection(collectionName)
 }
 
-func (s *Service) Insert(dbName string, collectionName string, document interface{}) (*primitive.ObjectID, error) {
+func (s *Service) Insert(ctx context.Context, dbName string, collectionName string, document interface{}) (*primitive.ObjectID, error) {
 	collection := s.GetCollection(dbName, collectionName)
 
-	ctx, cancel := context.WithTimeout(context.Background(), s.queryTimeout)
+	ctx, cancel := s.queryContext(ctx)
 	defer cancel()
 
 	insertResult, err := collection.InsertOne(ctx, document)
 	if err != nil {
-		return nil, fmt.Errorf("unable to insert document '%v'. Error: %v", document, err)
+		return nil, fmt.Errorf("unable to insert document '%v'. Error: %w", document, err)
 	}
 
 	result, ok := insertResult.InsertedID.(primitive.ObjectID)
@@ -76,18 +167,18 @@ func (s *Service) Insert(dbName string, collectionName string, document interfac
 	return &result, nil
 }
 
-func (s *Service) Upsert(dbName string, collectionName string, id primitive.ObjectID, document interface{}) (*primitive.ObjectID, error) {
+func (s *Service) Upsert(ctx context.Context, dbName string, collectionName string, id primitive.ObjectID, document interface{}) (*primitive.ObjectID, error) {
 	collection := s.GetCollection(dbName, collectionName)
 
-	ctx, cancel := context.WithTimeout(context.Background(), s.queryTimeout)
+	ctx, cancel := s.queryContext(ctx)
 	defer cancel()
 
 	opts := options.Update().SetUpsert(true)
-	filter := bson.D{{"_id", id}}
-	update := bson.D{{"$set", document}}
+	filter := bson.D{{Key: "_id", Value: id}}
+	update := bson.D{{Key: "$set", Value: document}}
 	result, err := collection.UpdateOne(ctx, filter, update, opts)
 	if err != nil {
-		return nil, fmt.Errorf("unable to update document. ID: '%v'. Document: '%v'. Error: %v", id, document, err)
+		return nil, fmt.Errorf("unable to update document. ID: '%v'. Document: '%v'. Error: %w", id, document, err)
 	}
 
 	if result.MatchedCount != 0 {
@@ -105,44 +196,256 @@ func (s *Service) Upsert(dbName string, collectionName string, id primitive.Obje
 	return nil, nil
 }
 
-func (s *Service) Delete(dbName string, collectionName string, id primitive.ObjectID) error {
+func (s *Service) Delete(ctx context.Context, dbName string, collectionName string, id primitive.ObjectID) error {
 	collection := s.GetCollection(dbName, collectionName)
 
-	ctx, cancel := context.WithTimeout(context.Background(), s.queryTimeout)
+	ctx, cancel := s.queryContext(ctx)
 	defer cancel()
 
 	_, err := collection.DeleteOne(ctx, bson.M{"_id": id})
 	if err != nil {
-		return fmt.Errorf("unable to delete document. ID: '%v'. Error: %v", id, err)
+		return fmt.Errorf("unable to delete document. ID: '%v'. Error: %w", id, err)
 	}
 	return err
 }
 
+func (s *Service) FindAll(ctx context.Context, dbName string, collectionName string, results interface{}) error {
+	collection := s.GetCollection(dbName, collectionName)
+
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	cursor, err := collection.Find(ctx, bson.D{})
+	if err != nil {
+		return fmt.Errorf("unable to find documents. Error: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	err = cursor.All(ctx, results)
+	if err != nil {
+		return fmt.Errorf("unable to decode documents. Error: %w", err)
+	}
+	return nil
+}
+
+func (s *Service) Find(ctx context.Context, dbName string, collectionName string, filter interface{}, opts FindOptions, results interface{}) error {
+	collection := s.GetCollection(dbName, collectionName)
+
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	findOptions := options.Find()
+	if opts.Sort != nil {
+		findOptions.SetSort(opts.Sort)
+	}
+	if opts.Limit > 0 {
+		findOptions.SetLimit(opts.Limit)
+	}
+
+	cursor, err := collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return fmt.Errorf("unable to find documents. Filter: '%v'. Error: %w", filter, err)
+	}
+	defer cursor.Close(ctx)
+
+	err = cursor.All(ctx, results)
+	if err != nil {
+		return fmt.Errorf("unable to decode documents. Error: %w", err)
+	}
+	return nil
+}
+
+func (s *Service) FindOne(ctx context.Context, dbName string, collectionName string, filter interface{}, result interface{}) error {
+	collection := s.GetCollection(dbName, collectionName)
+
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	err := collection.FindOne(ctx, filter).Decode(result)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("unable to find document. Filter: '%v'. Error: %w", filter, err)
+	}
+	return nil
+}
+
+func (s *Service) UpdateOne(ctx context.Context, dbName string, collectionName string, filter interface{}, update interface{}) error {
+	collection := s.GetCollection(dbName, collectionName)
+
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("unable to update document. Filter: '%v'. Update: '%v'. Error: %w", filter, update, err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *Service) FindOneAndUpdate(ctx context.Context, dbName string, collectionName string, filter interface{}, update interface{}, upsert bool, result interface{}) error {
+	collection := s.GetCollection(dbName, collectionName)
+
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	opts := options.FindOneAndUpdate().SetUpsert(upsert).SetReturnDocument(options.After)
+	err := collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(result)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrNotFound
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w: %v", ErrDuplicateKey, err)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to update document. Filter: '%v'. Update: '%v'. Error: %w", filter, update, err)
+	}
+	return nil
+}
+
+func (s *Service) ReplaceOne(ctx context.Context, dbName string, collectionName string, filter interface{}, replacement interface{}) error {
+	collection := s.GetCollection(dbName, collectionName)
+
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	result, err := collection.ReplaceOne(ctx, filter, replacement)
+	if err != nil {
+		return fmt.Errorf("unable to replace document. Filter: '%v'. Document: '%v'. Error: %w", filter, replacement, err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *Service) DeleteOne(ctx context.Context, dbName string, collectionName string, filter interface{}) error {
+	collection := s.GetCollection(dbName, collectionName)
+
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	result, err := collection.DeleteOne(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("unable to delete document. Filter: '%v'. Error: %w", filter, err)
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *Service) BulkWrite(ctx context.Context, dbName string, collectionName string, models []mongo.WriteModel, ordered bool) (*BulkResult, error) {
+	collection := s.GetCollection(dbName, collectionName)
+
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	result := &BulkResult{Upserted: make(map[int]interface{}), Errors: make(map[int]string)}
+	opts := options.BulkWrite().SetOrdered(ordered)
+	bulkResult, err := collection.BulkWrite(ctx, models, opts)
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) && bulkErr.WriteConcernError == nil {
+		for _, writeErr := range bulkErr.WriteErrors {
+			result.Errors[writeErr.Index] = writeErr.Message
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to execute bulk write. Error: %w", err)
+	}
+
+	if bulkResult != nil {
+		for index, id := range bulkResult.UpsertedIDs {
+			result.Upserted[int(index)] = id
+		}
+	}
+	return result, nil
+}
+
+func (s *Service) CreateIndex(ctx context.Context, dbName string, collectionName string, index mongo.IndexModel) error {
+	collection := s.GetCollection(dbName, collectionName)
+
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateOne(ctx, index)
+	if err != nil {
+		return fmt.Errorf("unable to create index '%v' for collection '%v'. Error: %w", index.Keys, collectionName, err)
+	}
+	return nil
+}
+
+func (s *Service) Watch(ctx context.Context, dbName string, collectionName string, resumeToken bson.Raw) (ChangeStream, error) {
+	collection := s.GetCollection(dbName, collectionName)
+
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	if resumeToken != nil {
+		opts.SetResumeAfter(resumeToken)
+	}
+
+	stream, err := collection.Watch(ctx, mongo.Pipeline{}, opts)
+	if err != nil {
+		return nil, changeStreamError(err)
+	}
+	return &mongoChangeStream{stream}, nil
+}
+
+func (s *Service) Drop(ctx context.Context, dbName string, collectionName string) error {
+	collection := s.GetCollection(dbName, collectionName)
+
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	err := collection.Drop(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to drop collection '%v'. Error: %w", collectionName, err)
+	}
+	return nil
+}
+
 func (s *Service) GetQueryTimeout() time.Duration {
 	return s.queryTimeout
 }
 
-func createService() *Service {
-	connectTimeout := ConnectTimeout()
-	queryTimeout := QueryTimeout()
-	client, err := createClient(connectTimeout)
+func CreateService(logger *logrus.Entry, config Config) (MongoService, error) {
+	switch config.Driver {
+	case DRIVER_MONGO:
+		return createMongoService(logger, config)
+	case DRIVER_MEMORY:
+		return createMemoryService(), nil
+	}
+	return nil, fmt.Errorf("unknown database driver: %v", config.Driver)
+}
+
+func createMongoService(logger *logrus.Entry, config Config) (*Service, error) {
+	client, err := createClient(config.ConnectionURL, config.ConnectTimeout)
 	if err != nil {
-		log.Fatalf("unable to setup mongo service: %v", err)
+		return nil, fmt.Errorf("unable to setup mongo service: %v", err)
 	}
 	return &Service{
-		connectTimeout: connectTimeout,
-		queryTimeout:   queryTimeout,
+		connectTimeout: config.ConnectTimeout,
+		queryTimeout:   config.QueryTimeout,
 		client:         client,
-	}
+		transactions:   new(int32),
+		log:            logger,
+	}, nil
 }
 
-func createClient(connectTimeout time.Duration) (*mongo.Client, error) {
+func createClient(connectionURL string, connectTimeout time.Duration) (*mongo.Client, error) {
 	var result *mongo.Client
 
 	ctx, cancel := context.WithTimeout(context.Background(), connectTimeout)
 	defer cancel()
 
-	result, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoConnectionURL()))
+	// the monitor reports every command as a child span of the span of the query context
+	opts := options.Client().ApplyURI(connectionURL).SetMonitor(otelmongo.NewMonitor())
+	result, err := mongo.Connect(ctx, opts)
 	if err != nil {
 		return result, fmt.Errorf("unable to create mongo client: %v", err)
 	}
@@ -150,49 +453,159 @@ func createClient(connectTimeout time.Duration) (*mongo.Client, error) {
 	return result, nil
 }
 
-func mongoConnectionURL() string {
-	username := utils.EnvVarDefault("DATABASE_USERNAME", "mongo_admin")
-	password := utils.EnvVarDefault("DATABASE_PASSWORD", "mongo_admin_password")
-	host := utils.EnvVarDefault("DATABASE_HOST", "mongo")
-	port := utils.EnvVarDefault("DATABASE_PORT", "27017")
-	return "mongodb://" + username + ":" + password + "@" + host + ":" + port
+// mongoChangeStream translates errors of the driver change stream into the package errors
+type mongoChangeStream struct {
+	*mongo.ChangeStream
+}
+
+func (cs *mongoChangeStream) Err() error {
+	err := cs.ChangeStream.Err()
+	if err != nil {
+		return changeStreamError(err)
+	}
+	return nil
 }
 
-// TODO: add processing of case when we have replica set of mongos and need to use sessions + tx
-type QueryFuncVoid func(sc mongo.SessionContext) error
+func changeStreamError(err error) error {
+	var serverError mongo.ServerError
+	if errors.As(err, &serverError) {
+		if serverError.HasErrorCode(errorCodeChangeStreamsUnsupported) {
+			return ErrChangeStreamsUnsupported
+		}
+		if serverError.HasErrorCode(errorCodeChangeStreamHistoryLost) {
+			return ErrChangeStreamHistoryLost
+		}
+	}
+	return fmt.Errorf("change stream error: %v", err)
+}
 
-func Tx(f QueryFuncVoid) func() error {
-	service := Instance()
+// QueryFuncVoid is the body of a transaction, tx executes the operations in the transaction
+type QueryFuncVoid func(tx MongoService) error
 
-	ctx, cancel := context.WithTimeout(context.Background(), service.queryTimeout)
+func (s *Service) Ping(ctx context.Context) error {
+	err := s.client.Ping(ctx, readpref.Primary())
+	if err != nil {
+		return fmt.Errorf("unable to ping db. Error: %v", err)
+	}
+	return nil
+}
+
+// SupportsTransactions detects whether the deployment is a replica set or a sharded cluster. The result is cached,
+// since the topology of the deployment does not change while the service is running
+func (s *Service) SupportsTransactions(ctx context.Context) (bool, error) {
+	switch atomic.LoadInt32(s.transactions) {
+	case transactionsSupported:
+		return true, nil
+	case transactionsUnsupported:
+		return false, nil
+	}
+
+	ctx, cancel := s.queryContext(ctx)
 	defer cancel()
 
+	var result bson.M
+	err := s.client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&result)
+	if err != nil {
+		// servers before 4.4.2 know only the legacy name of the command
+		err = s.client.Database("admin").RunCommand(ctx, bson.D{{Key: "isMaster", Value: 1}}).Decode(&result)
+	}
+	if err != nil {
+		return false, fmt.Errorf("unable to detect transactions support. Error: %w", err)
+	}
+
+	_, replicaSet := result["setName"]
+	supported := replicaSet || result["msg"] == "isdbgrid"
+	if supported {
+		atomic.StoreInt32(s.transactions, transactionsSupported)
+	} else {
+		atomic.StoreInt32(s.transactions, transactionsUnsupported)
+	}
+	return supported, nil
+}
+
+func (s *Service) Tx(ctx context.Context, f QueryFuncVoid) func() error {
 	return func() error {
-		session, err := service.client.StartSession()
+		supported, err := s.SupportsTransactions(ctx)
 		if err != nil {
-			return fmt.Errorf("unable to start session: %v", err)
+			return err
+		}
+		if !supported {
+			return ErrTransactionsUnsupported
+		}
+
+		ctx, cancel := s.queryContext(ctx)
+		defer cancel()
+
+		session, err := s.client.StartSession()
+		if err != nil {
+			return fmt.Errorf("unable to start session: %w", err)
 		}
 		defer session.EndSession(ctx)
 
-		err = mongo.WithSession(ctx, session, func(sc mongo.SessionContext) error {
-			err = session.StartTransaction()
-			if err != nil {
-				return fmt.Errorf("unable to start tx: %v", err)
-			}
-			defer session.AbortTransaction(sc)
-
-			err := f(sc)
-			if err != nil {
-				return err
-			}
-
-			err = session.CommitTransaction(sc)
-			if err != nil {
-				return fmt.Errorf("unable to commit tx: %v", err)
-			}
-			return nil
+		return retryTx(func() error {
+			return mongo.WithSession(ctx, session, func(sc mongo.SessionContext) error {
+				err := session.StartTransaction()
+				if err != nil {
+					return fmt.Errorf("unable to start tx: %w", err)
+				}
+
+				err = f(s.bind(session))
+				if err != nil {
+					abortErr := session.AbortTransaction(sc)
+					if abortErr != nil {
+						logging.With(ctx, s.log).WithError(abortErr).Error("unable to abort tx")
+					}
+					return err
+				}
+
+				return retryCommit(func() error {
+					err := session.CommitTransaction(sc)
+					if err != nil {
+						return fmt.Errorf("unable to commit tx: %w", err)
+					}
+					return nil
+				})
+			})
 		})
+	}
+}
+
+// bind returns the service executing queries in the session
+func (s *Service) bind(session mongo.Session) *Service {
+	return &Service{
+		connectTimeout: s.connectTimeout,
+		queryTimeout:   s.queryTimeout,
+		client:         s.client,
+		session:        session,
+		transactions:   s.transactions,
+		log:            s.log,
+	}
+}
 
-		return err
+// retryTx runs the whole transaction again while it fails with the TransientTransactionError label
+func retryTx(attempt func() error) error {
+	for i := 1; ; i++ {
+		err := attempt()
+		if err == nil || !hasErrorLabel(err, LABEL_TRANSIENT_TRANSACTION_ERROR) {
+			return err
+		}
+		if i == TX_MAX_ATTEMPTS {
+			return fmt.Errorf("%w: %v", ErrTransactionConflict, err)
+		}
 	}
 }
+
+// retryCommit commits again while the result of the commit is unknown, the commit is idempotent
+func retryCommit(commit func() error) error {
+	for i := 1; ; i++ {
+		err := commit()
+		if err == nil || !hasErrorLabel(err, LABEL_UNKNOWN_TRANSACTION_COMMIT_RESULT) || i == TX_MAX_ATTEMPTS {
+			return err
+		}
+	}
+}
+
+func hasErrorLabel(err error, label string) bool {
+	var labeled interface{ HasErrorLabel(string) bool }
+	return errors.As(err, &labeled) && labeled.HasErrorLabel(label)
+}
@@ -0,0 +1,118 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Observer gets the duration and the result of every query. ErrNotFound is a result, not a failure, so it is passed
+// as nil
+type Observer interface {
+	ObserveQuery(operation string, collectionName string, duration time.Duration, err error)
+}
+
+// ObservedService reports the queries of the service to the observer. Change streams, indexes and drops are not observed
+type ObservedService struct {
+	MongoService
+	observer Observer
+}
+
+// Observe returns the service reporting its queries to the observer
+func Observe(service MongoService, observer Observer) *ObservedService {
+	return &ObservedService{MongoService: service, observer: observer}
+}
+
+func (s *ObservedService) Insert(ctx context.Context, dbName string, collectionName string, document interface{}) (*primitive.ObjectID, error) {
+	start := time.Now()
+	id, err := s.MongoService.Insert(ctx, dbName, collectionName, document)
+	s.observe("insert", collectionName, start, err)
+	return id, err
+}
+
+func (s *ObservedService) Upsert(ctx context.Context, dbName string, collectionName string, id primitive.ObjectID, document interface{}) (*primitive.ObjectID, error) {
+	start := time.Now()
+	result, err := s.MongoService.Upsert(ctx, dbName, collectionName, id, document)
+	s.observe("upsert", collectionName, start, err)
+	return result, err
+}
+
+func (s *ObservedService) Delete(ctx context.Context, dbName string, collectionName string, id primitive.ObjectID) error {
+	start := time.Now()
+	err := s.MongoService.Delete(ctx, dbName, collectionName, id)
+	s.observe("delete", collectionName, start, err)
+	return err
+}
+
+func (s *ObservedService) FindAll(ctx context.Context, dbName string, collectionName string, results interface{}) error {
+	start := time.Now()
+	err := s.MongoService.FindAll(ctx, dbName, collectionName, results)
+	s.observe("find_all", collectionName, start, err)
+	return err
+}
+
+func (s *ObservedService) Find(ctx context.Context, dbName string, collectionName string, filter interface{}, opts FindOptions, results interface{}) error {
+	start := time.Now()
+	err := s.MongoService.Find(ctx, dbName, collectionName, filter, opts, results)
+	s.observe("find", collectionName, start, err)
+	return err
+}
+
+func (s *ObservedService) FindOne(ctx context.Context, dbName string, collectionName string, filter interface{}, result interface{}) error {
+	start := time.Now()
+	err := s.MongoService.FindOne(ctx, dbName, collectionName, filter, result)
+	s.observe("find_one", collectionName, start, err)
+	return err
+}
+
+func (s *ObservedService) UpdateOne(ctx context.Context, dbName string, collectionName string, filter interface{}, update interface{}) error {
+	start := time.Now()
+	err := s.MongoService.UpdateOne(ctx, dbName, collectionName, filter, update)
+	s.observe("update_one", collectionName, start, err)
+	return err
+}
+
+func (s *ObservedService) FindOneAndUpdate(ctx context.Context, dbName string, collectionName string, filter interface{}, update interface{}, upsert bool, result interface{}) error {
+	start := time.Now()
+	err := s.MongoService.FindOneAndUpdate(ctx, dbName, collectionName, filter, update, upsert, result)
+	s.observe("find_one_and_update", collectionName, start, err)
+	return err
+}
+
+func (s *ObservedService) ReplaceOne(ctx context.Context, dbName string, collectionName string, filter interface{}, replacement interface{}) error {
+	start := time.Now()
+	err := s.MongoService.ReplaceOne(ctx, dbName, collectionName, filter, replacement)
+	s.observe("replace_one", collectionName, start, err)
+	return err
+}
+
+func (s *ObservedService) BulkWrite(ctx context.Context, dbName string, collectionName string, models []mongo.WriteModel, ordered bool) (*BulkResult, error) {
+	start := time.Now()
+	result, err := s.MongoService.BulkWrite(ctx, dbName, collectionName, models, ordered)
+	s.observe("bulk_write", collectionName, start, err)
+	return result, err
+}
+
+func (s *ObservedService) DeleteOne(ctx context.Context, dbName string, collectionName string, filter interface{}) error {
+	start := time.Now()
+	err := s.MongoService.DeleteOne(ctx, dbName, collectionName, filter)
+	s.observe("delete_one", collectionName, start, err)
+	return err
+}
+
+// Tx observes the queries of the transaction with the same observer
+func (s *ObservedService) Tx(ctx context.Context, f QueryFuncVoid) func() error {
+	return s.MongoService.Tx(ctx, func(tx MongoService) error {
+		return f(Observe(tx, s.observer))
+	})
+}
+
+func (s *ObservedService) observe(operation string, collectionName string, start time.Time, err error) {
+	if errors.Is(err, ErrNotFound) {
+		err = nil
+	}
+	s.observer.ObserveQuery(operation, collectionName, time.Since(start), err)
+}
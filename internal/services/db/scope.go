@@ -0,0 +1,187 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ScopedService adds the condition to the filters of every query, so the queries see and change only the documents
+// of the scope, whatever filters the callers build. The inserted documents have to match the condition themselves,
+// except the upserted ones.
+// Change streams, indexes and drops are not scoped
+type ScopedService struct {
+	MongoService
+	condition bson.M
+}
+
+// Scope returns the service limited to the documents matching the condition
+func Scope(service MongoService, condition bson.M) *ScopedService {
+	return &ScopedService{MongoService: service, condition: condition}
+}
+
+// Upsert updates the document of the scope or inserts it with the equality fields of the condition.
+// Returns ErrDuplicateKey if the id is taken by a document out of the scope
+func (s *ScopedService) Upsert(ctx context.Context, dbName string, collectionName string, id primitive.ObjectID, document interface{}) (*primitive.ObjectID, error) {
+	err := s.UpdateOne(ctx, dbName, collectionName, bson.M{"_id": id}, bson.M{"$set": document})
+	if !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+
+	update := bson.M{"$set": document}
+	if fields := s.equalities(); len(fields) != 0 {
+		update["$setOnInsert"] = fields
+	}
+	var result bson.M
+	err = s.FindOneAndUpdate(ctx, dbName, collectionName, bson.M{"_id": id}, update, true, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+func (s *ScopedService) Delete(ctx context.Context, dbName string, collectionName string, id primitive.ObjectID) error {
+	err := s.DeleteOne(ctx, dbName, collectionName, bson.M{"_id": id})
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (s *ScopedService) FindAll(ctx context.Context, dbName string, collectionName string, results interface{}) error {
+	return s.Find(ctx, dbName, collectionName, bson.M{}, FindOptions{}, results)
+}
+
+func (s *ScopedService) Find(ctx context.Context, dbName string, collectionName string, filter interface{}, opts FindOptions, results interface{}) error {
+	scoped, err := s.scope(filter)
+	if err != nil {
+		return err
+	}
+	return s.MongoService.Find(ctx, dbName, collectionName, scoped, opts, results)
+}
+
+func (s *ScopedService) FindOne(ctx context.Context, dbName string, collectionName string, filter interface{}, result interface{}) error {
+	scoped, err := s.scope(filter)
+	if err != nil {
+		return err
+	}
+	return s.MongoService.FindOne(ctx, dbName, collectionName, scoped, result)
+}
+
+func (s *ScopedService) UpdateOne(ctx context.Context, dbName string, collectionName string, filter interface{}, update interface{}) error {
+	scoped, err := s.scope(filter)
+	if err != nil {
+		return err
+	}
+	return s.MongoService.UpdateOne(ctx, dbName, collectionName, scoped, update)
+}
+
+func (s *ScopedService) FindOneAndUpdate(ctx context.Context, dbName string, collectionName string, filter interface{}, update interface{}, upsert bool, result interface{}) error {
+	scoped, err := s.scope(filter)
+	if err != nil {
+		return err
+	}
+	return s.MongoService.FindOneAndUpdate(ctx, dbName, collectionName, scoped, update, upsert, result)
+}
+
+func (s *ScopedService) ReplaceOne(ctx context.Context, dbName string, collectionName string, filter interface{}, replacement interface{}) error {
+	scoped, err := s.scope(filter)
+	if err != nil {
+		return err
+	}
+	return s.MongoService.ReplaceOne(ctx, dbName, collectionName, scoped, replacement)
+}
+
+func (s *ScopedService) DeleteOne(ctx context.Context, dbName string, collectionName string, filter interface{}) error {
+	scoped, err := s.scope(filter)
+	if err != nil {
+		return err
+	}
+	return s.MongoService.DeleteOne(ctx, dbName, collectionName, scoped)
+}
+
+// BulkWrite scopes the filters of the models, the inserts are passed as they are
+func (s *ScopedService) BulkWrite(ctx context.Context, dbName string, collectionName string, models []mongo.WriteModel, ordered bool) (*BulkResult, error) {
+	scoped := make([]mongo.WriteModel, len(models))
+	for i, model := range models {
+		var err error
+		switch typed := model.(type) {
+		case *mongo.InsertOneModel:
+			scoped[i] = typed
+		case *mongo.UpdateOneModel:
+			copied := *typed
+			copied.Filter, err = s.scope(typed.Filter)
+			scoped[i] = &copied
+		case *mongo.ReplaceOneModel:
+			copied := *typed
+			copied.Filter, err = s.scope(typed.Filter)
+			scoped[i] = &copied
+		case *mongo.DeleteOneModel:
+			copied := *typed
+			copied.Filter, err = s.scope(typed.Filter)
+			scoped[i] = &copied
+		default:
+			err = fmt.Errorf("unsupported write model in a scope: %T", model)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s.MongoService.BulkWrite(ctx, dbName, collectionName, scoped, ordered)
+}
+
+// Tx runs f with the transaction bound service limited to the same scope
+func (s *ScopedService) Tx(ctx context.Context, f QueryFuncVoid) func() error {
+	return s.MongoService.Tx(ctx, func(tx MongoService) error {
+		return f(Scope(tx, s.condition))
+	})
+}
+
+// equalities returns the fields of the condition having plain values
+func (s *ScopedService) equalities() bson.M {
+	result := bson.M{}
+	for key, value := range s.condition {
+		switch value.(type) {
+		case bson.M, bson.D, map[string]interface{}:
+			continue
+		}
+		if !strings.HasPrefix(key, "$") {
+			result[key] = value
+		}
+	}
+	return result
+}
+
+// scope merges the condition into the filter. The fields of the filter stay at the top level, so the lookups by _id
+// keep using the index. A filter having a field of the condition is combined with $and
+func (s *ScopedService) scope(filter interface{}) (bson.M, error) {
+	result := bson.M{}
+	switch typed := filter.(type) {
+	case nil:
+	case bson.M:
+		for key, value := range typed {
+			result[key] = value
+		}
+	case bson.D:
+		for _, element := range typed {
+			result[element.Key] = element.Value
+		}
+	default:
+		return nil, fmt.Errorf("unable to scope filter of type %T", filter)
+	}
+
+	for key := range s.condition {
+		if _, found := result[key]; found {
+			return bson.M{"$and": bson.A{result, s.condition}}, nil
+		}
+	}
+	for key, value := range s.condition {
+		result[key] = value
+	}
+	return result, nil
+}
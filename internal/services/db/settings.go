@@ -6,6 +6,22 @@ import (
 	"github.com/ArtemVoronov/artforintrovert-test/internal/utils"
 )
 
+type Config struct {
+	Driver         string
+	ConnectionURL  string
+	ConnectTimeout time.Duration
+	QueryTimeout   time.Duration
+}
+
+func LoadConfig() Config {
+	return Config{
+		Driver:         Driver(),
+		ConnectionURL:  ConnectionURL(),
+		ConnectTimeout: ConnectTimeout(),
+		QueryTimeout:   QueryTimeout(),
+	}
+}
+
 func ConnectTimeout() time.Duration {
 	value := utils.EnvVarIntDefault("DATABASE_CONNECT_TIMEOUT_IN_SECONDS", "30")
 	return time.Duration(value) * time.Second
@@ -19,3 +35,15 @@ func QueryTimeout() time.Duration {
 func DBName() string {
 	return utils.EnvVarDefault("DATABASE_NAME", "testdb")
 }
+
+func Driver() string {
+	return utils.EnvVarDefault("DATABASE_DRIVER", DRIVER_MONGO)
+}
+
+func ConnectionURL() string {
+	username := utils.EnvVarDefault("DATABASE_USERNAME", "mongo_admin")
+	password := utils.EnvVarDefault("DATABASE_PASSWORD", "mongo_admin_password")
+	host := utils.EnvVarDefault("DATABASE_HOST", "mongo")
+	port := utils.EnvVarDefault("DATABASE_PORT", "27017")
+	return "mongodb://" + username + ":" + password + "@" + host + ":" + port
+}
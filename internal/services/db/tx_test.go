@@ -0,0 +1,92 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type labeledError struct {
+	label string
+}
+
+func (e labeledError) Error() string {
+	return "labeled " + e.label
+}
+
+func (e labeledError) HasErrorLabel(label string) bool {
+	return label == e.label
+}
+
+// failing returns the attempt failing with the errors one by one and succeeding after them
+func failing(errs ...error) (func() error, *int) {
+	attempts := 0
+	return func() error {
+		attempts++
+		if attempts <= len(errs) {
+			return errs[attempts-1]
+		}
+		return nil
+	}, &attempts
+}
+
+func TestRetryTx(t *testing.T) {
+	transient := labeledError{LABEL_TRANSIENT_TRANSACTION_ERROR}
+
+	t.Run("RetriesTransientErrors", func(t *testing.T) {
+		attempt, attempts := failing(transient, fmt.Errorf("unable to insert: %w", transient))
+
+		assert.Nil(t, retryTx(attempt))
+		assert.Equal(t, 3, *attempts)
+	})
+	t.Run("GivesUpAfterMaxAttempts", func(t *testing.T) {
+		errs := make([]error, TX_MAX_ATTEMPTS)
+		for i := range errs {
+			errs[i] = transient
+		}
+		attempt, attempts := failing(errs...)
+
+		err := retryTx(attempt)
+
+		assert.ErrorIs(t, err, ErrTransactionConflict)
+		assert.Equal(t, TX_MAX_ATTEMPTS, *attempts)
+	})
+	t.Run("DoesNotRetryOtherErrors", func(t *testing.T) {
+		for _, expected := range []error{errors.New("validation failed"), labeledError{LABEL_UNKNOWN_TRANSACTION_COMMIT_RESULT}} {
+			attempt, attempts := failing(expected)
+
+			assert.Equal(t, expected, retryTx(attempt))
+			assert.Equal(t, 1, *attempts)
+		}
+	})
+}
+
+func TestRetryCommit(t *testing.T) {
+	unknown := labeledError{LABEL_UNKNOWN_TRANSACTION_COMMIT_RESULT}
+
+	t.Run("RetriesUnknownResult", func(t *testing.T) {
+		commit, attempts := failing(unknown, unknown)
+
+		assert.Nil(t, retryCommit(commit))
+		assert.Equal(t, 3, *attempts)
+	})
+	t.Run("GivesUpAfterMaxAttempts", func(t *testing.T) {
+		errs := make([]error, TX_MAX_ATTEMPTS)
+		for i := range errs {
+			errs[i] = unknown
+		}
+		commit, attempts := failing(errs...)
+
+		assert.Equal(t, unknown, retryCommit(commit))
+		assert.Equal(t, TX_MAX_ATTEMPTS, *attempts)
+	})
+	t.Run("DoesNotRetryTransientErrors", func(t *testing.T) {
+		expected := labeledError{LABEL_TRANSIENT_TRANSACTION_ERROR}
+		commit, attempts := failing(expected)
+
+		assert.Equal(t, expected, retryCommit(commit))
+		assert.Equal(t, 1, *attempts)
+	})
+}
@@ -0,0 +1,112 @@
+package health
+
+import (
+	"context"
+	"time"
+
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/cache"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/db"
+)
+
+const (
+	STATUS_UP   = "up"
+	STATUS_DOWN = "down"
+)
+
+// Report is the state of the instance and of every dependency, the instance is up when all of them are
+type Report struct {
+	Status       string       `json:"status"`
+	Dependencies Dependencies `json:"dependencies"`
+}
+
+type Dependencies struct {
+	Mongo DBCheck    `json:"mongo"`
+	Cache CacheCheck `json:"cache"`
+}
+
+type DBCheck struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latencyMs"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type CacheCheck struct {
+	Status string `json:"status"`
+	// Loaded is false until the first successful sync
+	Loaded   bool       `json:"loaded"`
+	Live     bool       `json:"live"`
+	LastSync *time.Time `json:"lastSync,omitempty"`
+	// StalenessSeconds is the age of the last successful sync, 0 while the change stream is live
+	StalenessSeconds    float64 `json:"stalenessSeconds"`
+	MaxStalenessSeconds float64 `json:"maxStalenessSeconds"`
+}
+
+type Service struct {
+	db                db.MongoService
+	cacheStats        func() cache.Stats
+	dbTimeout         time.Duration
+	maxCacheStaleness time.Duration
+}
+
+func CreateService(dbService db.MongoService, cacheStats func() cache.Stats, config Config) *Service {
+	return &Service{
+		db:                dbService,
+		cacheStats:        cacheStats,
+		dbTimeout:         config.DBTimeout,
+		maxCacheStaleness: config.MaxCacheStaleness,
+	}
+}
+
+// Check checks every dependency of the readiness, the db ping is limited by the db timeout within the context
+func (s *Service) Check(ctx context.Context) Report {
+	result := Report{
+		Status: STATUS_UP,
+		Dependencies: Dependencies{
+			Mongo: s.checkDB(ctx),
+			Cache: s.checkCache(),
+		},
+	}
+	if result.Dependencies.Mongo.Status != STATUS_UP || result.Dependencies.Cache.Status != STATUS_UP {
+		result.Status = STATUS_DOWN
+	}
+	return result
+}
+
+func (s *Service) checkDB(ctx context.Context) DBCheck {
+	ctx, cancel := context.WithTimeout(ctx, s.dbTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := s.db.Ping(ctx)
+	result := DBCheck{Status: STATUS_UP, LatencyMs: float64(time.Since(start).Microseconds()) / 1000}
+	if err != nil {
+		result.Status = STATUS_DOWN
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// checkCache reports the cache down if it has never been loaded or the last successful sync is too old,
+// the instance would serve an empty or outdated list otherwise
+func (s *Service) checkCache() CacheCheck {
+	stats := s.cacheStats()
+	result := CacheCheck{
+		Status:              STATUS_UP,
+		Loaded:              !stats.LastSync.IsZero(),
+		Live:                stats.Live,
+		MaxStalenessSeconds: s.maxCacheStaleness.Seconds(),
+	}
+	if !result.Loaded {
+		result.Status = STATUS_DOWN
+		return result
+	}
+	result.LastSync = &stats.LastSync
+	if !stats.Live {
+		staleness := time.Since(stats.LastSync)
+		result.StalenessSeconds = staleness.Seconds()
+		if staleness > s.maxCacheStaleness {
+			result.Status = STATUS_DOWN
+		}
+	}
+	return result
+}
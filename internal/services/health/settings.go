@@ -0,0 +1,31 @@
+package health
+
+import (
+	"time"
+
+	"github.com/ArtemVoronov/artforintrovert-test/internal/utils"
+)
+
+type Config struct {
+	// DBTimeout is the timeout of the db ping, the readiness probe of the orchestrator must wait longer
+	DBTimeout time.Duration
+	// MaxCacheStaleness is the age of the last successful cache sync after which the instance is not ready
+	MaxCacheStaleness time.Duration
+}
+
+func LoadConfig() Config {
+	return Config{
+		DBTimeout:         dbTimeout(),
+		MaxCacheStaleness: maxCacheStaleness(),
+	}
+}
+
+func dbTimeout() time.Duration {
+	value := utils.EnvVarIntDefault("HEALTH_DB_TIMEOUT_IN_MILLISECONDS", "1000")
+	return time.Duration(value) * time.Millisecond
+}
+
+func maxCacheStaleness() time.Duration {
+	value := utils.EnvVarIntDefault("HEALTH_CACHE_MAX_STALENESS_IN_SECONDS", "300")
+	return time.Duration(value) * time.Second
+}
@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/cache"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// cacheCollector reads the stats of the cache once per scrape
+type cacheCollector struct {
+	stats func() cache.Stats
+
+	records       *prometheus.Desc
+	snapshotBytes *prometheus.Desc
+	lastSync      *prometheus.Desc
+	syncDelay     *prometheus.Desc
+	syncFailures  *prometheus.Desc
+}
+
+func createCacheCollector(stats func() cache.Stats) *cacheCollector {
+	name := func(name string) string {
+		return prometheus.BuildFQName(NAMESPACE, "cache", name)
+	}
+	return &cacheCollector{
+		stats:         stats,
+		records:       prometheus.NewDesc(name("records"), "Number of the cached records of all tenants.", nil, nil),
+		snapshotBytes: prometheus.NewDesc(name("snapshot_bytes"), "Size of the serialized records list snapshots of all tenants.", nil, nil),
+		lastSync:      prometheus.NewDesc(name("last_sync_timestamp_seconds"), "Time of the last successful sync, 0 before the first one.", nil, nil),
+		syncDelay:     prometheus.NewDesc(name("sync_delay_seconds"), "Current delay between the syncs, it grows while the syncs fail.", nil, nil),
+		syncFailures:  prometheus.NewDesc(name("sync_failures"), "Number of the syncs failed in a row.", nil, nil),
+	}
+}
+
+func (c *cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.records
+	ch <- c.snapshotBytes
+	ch <- c.lastSync
+	ch <- c.syncDelay
+	ch <- c.syncFailures
+}
+
+func (c *cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.stats()
+	var lastSync float64
+	if !stats.LastSync.IsZero() {
+		lastSync = float64(stats.LastSync.UnixNano()) / 1e9
+	}
+	ch <- prometheus.MustNewConstMetric(c.records, prometheus.GaugeValue, float64(stats.Records))
+	ch <- prometheus.MustNewConstMetric(c.snapshotBytes, prometheus.GaugeValue, float64(stats.SnapshotBytes))
+	ch <- prometheus.MustNewConstMetric(c.lastSync, prometheus.GaugeValue, lastSync)
+	ch <- prometheus.MustNewConstMetric(c.syncDelay, prometheus.GaugeValue, stats.SyncDelay.Seconds())
+	ch <- prometheus.MustNewConstMetric(c.syncFailures, prometheus.GaugeValue, float64(stats.SyncFailures))
+}
@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/cache"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	NAMESPACE = "records"
+
+	// UNMATCHED_ROUTE is the route label of the requests not matched by any route, so scans do not blow up the label values
+	UNMATCHED_ROUTE = "unmatched"
+)
+
+// Service collects the metrics of the HTTP requests, the database queries and the cache into its own registry
+type Service struct {
+	path     string
+	registry *prometheus.Registry
+
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	queryDuration   *prometheus.HistogramVec
+	queryErrors     *prometheus.CounterVec
+}
+
+func CreateService(config Config) *Service {
+	s := &Service{
+		path:     config.Path,
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: NAMESPACE,
+			Subsystem: "http",
+			Name:      "requests_total",
+			Help:      "Number of the HTTP requests by route, method and status.",
+		}, []string{"route", "method", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: NAMESPACE,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "Latency of the HTTP requests by route, method and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: NAMESPACE,
+			Subsystem: "mongo",
+			Name:      "query_duration_seconds",
+			Help:      "Latency of the MongoDB queries by operation and collection.",
+			Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		}, []string{"operation", "collection"}),
+		queryErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: NAMESPACE,
+			Subsystem: "mongo",
+			Name:      "query_errors_total",
+			Help:      "Number of the failed MongoDB queries by operation and collection, not found is not a failure.",
+		}, []string{"operation", "collection"}),
+	}
+	s.registry.MustRegister(
+		s.requests,
+		s.requestDuration,
+		s.queryDuration,
+		s.queryErrors,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return s
+}
+
+// Enabled tells whether the metrics are served
+func (s *Service) Enabled() bool {
+	return s.path != ""
+}
+
+// Path returns the route of the metrics
+func (s *Service) Path() string {
+	return s.path
+}
+
+// ObserveQuery implements db.Observer
+func (s *Service) ObserveQuery(operation string, collectionName string, duration time.Duration, err error) {
+	s.queryDuration.WithLabelValues(operation, collectionName).Observe(duration.Seconds())
+	if err != nil {
+		s.queryErrors.WithLabelValues(operation, collectionName).Inc()
+	}
+}
+
+// RegisterCache exposes the stats of the cache, they are read on every scrape
+func (s *Service) RegisterCache(stats func() cache.Stats) {
+	s.registry.MustRegister(createCacheCollector(stats))
+}
+
+// Handler serves the metrics in the Prometheus text format
+func (s *Service) Handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.HandlerFor(s.registry, promhttp.HandlerOpts{}))
+}
@@ -0,0 +1,25 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Middleware counts the requests and observes their latency. The route label is the route pattern, not the path,
+// so the ids do not make new label values
+func (s *Service) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = UNMATCHED_ROUTE
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		s.requests.WithLabelValues(route, c.Request.Method, status).Inc()
+		s.requestDuration.WithLabelValues(route, c.Request.Method, status).Observe(time.Since(start).Seconds())
+	}
+}
@@ -0,0 +1,16 @@
+package metrics
+
+import (
+	"github.com/ArtemVoronov/artforintrovert-test/internal/utils"
+)
+
+type Config struct {
+	// Path is the route of the metrics in the Prometheus text format, empty disables the metrics
+	Path string
+}
+
+func LoadConfig() Config {
+	return Config{
+		Path: utils.EnvVarDefault("METRICS_PATH", "/metrics"),
+	}
+}
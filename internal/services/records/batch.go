@@ -0,0 +1,180 @@
+package records
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	BATCH_REPLACE = "replace"
+	BATCH_DELETE  = "delete"
+
+	BATCH_STATUS_REPLACED = "replaced"
+	// BATCH_STATUS_ROLLED_BACK is the status of the succeeded operations of an atomic batch which has failed
+	BATCH_STATUS_ROLLED_BACK = "rolled_back"
+)
+
+// errBatchRollback aborts the transaction of an atomic batch with a failed operation
+var errBatchRollback = errors.New("batch operation failed")
+
+// BatchOperation replaces or deletes an existing record. Version makes the operation conditional as If-Match does
+type BatchOperation struct {
+	Type    string
+	Id      primitive.ObjectID
+	Data    *string
+	Version *int64
+}
+
+// BatchResult has the result of every operation in the same order, and the state of the written records for the cache
+type BatchResult struct {
+	Results []BulkOperationResult
+	// RolledBack is true if an atomic batch has failed and none of its operations is applied
+	RolledBack bool
+	Written    []Record
+	Deleted    []Record
+}
+
+// Batch executes the operations one by one. An atomic batch runs in a transaction: either all operations are applied
+// or none of them. Returns db.ErrTransactionsUnsupported if the deployment is unable to run an atomic batch
+func (s *Service) Batch(ctx context.Context, operations []BatchOperation, atomic bool) (*BatchResult, error) {
+	ctx, span := s.span(ctx, "Batch")
+	defer span.End()
+
+	if len(operations) == 0 {
+		return nil, ErrBulkEmpty
+	}
+	if len(operations) > s.bulkMaxSize {
+		return nil, ErrBulkTooLarge
+	}
+
+	if !atomic {
+		return s.batch(ctx, operations, false)
+	}
+
+	var result *BatchResult
+	err := s.db.Tx(ctx, func(tx db.MongoService) error {
+		var err error
+		result, err = s.with(tx).batch(ctx, operations, true)
+		if err != nil {
+			return err
+		}
+		if result.RolledBack {
+			return errBatchRollback
+		}
+		return nil
+	})()
+	if err != nil && !errors.Is(err, errBatchRollback) {
+		return nil, err
+	}
+	return result, nil
+}
+
+// with returns the service executing its queries by the database service, e.g. in a transaction
+func (s *Service) with(database db.MongoService) *Service {
+	result := *s
+	result.db = database
+	return &result
+}
+
+func (s *Service) batch(ctx context.Context, operations []BatchOperation, atomic bool) (*BatchResult, error) {
+	result := &BatchResult{
+		Results: make([]BulkOperationResult, len(operations)),
+		Written: make([]Record, 0),
+		Deleted: make([]Record, 0),
+	}
+
+	invalid := false
+	for i, operation := range operations {
+		result.Results[i].Status = BULK_STATUS_SKIPPED
+		if operation.Id != primitive.NilObjectID {
+			id := operation.Id
+			result.Results[i].Id = &id
+		}
+		err := validateBatchOperation(operation)
+		if err != nil {
+			result.Results[i].Status = BULK_STATUS_FAILED
+			result.Results[i].Error = err.Error()
+			invalid = true
+		}
+	}
+	if invalid && atomic {
+		result.RolledBack = true
+		return result, nil
+	}
+
+	for i, operation := range operations {
+		if result.Results[i].Status == BULK_STATUS_FAILED {
+			continue
+		}
+
+		var versions []int64
+		if operation.Version != nil {
+			versions = []int64{*operation.Version}
+		}
+
+		var err error
+		switch operation.Type {
+		case BATCH_REPLACE:
+			var record *Record
+			record, err = s.Replace(ctx, operation.Id, bson.M{"data": *operation.Data}, versions)
+			if err == nil {
+				result.Results[i].Status = BATCH_STATUS_REPLACED
+				result.Written = append(result.Written, *record)
+			}
+		case BATCH_DELETE:
+			var record *Record
+			record, err = s.Delete(ctx, operation.Id, versions)
+			if err == nil {
+				result.Results[i].Status = BULK_STATUS_DELETED
+				result.Deleted = append(result.Deleted, *record)
+			}
+		}
+
+		if errors.Is(err, db.ErrNotFound) || errors.Is(err, ErrVersionMismatch) {
+			result.Results[i].Status = BULK_STATUS_FAILED
+			result.Results[i].Error = err.Error()
+			if atomic {
+				rollBack(result)
+				return result, nil
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// rollBack marks the applied operations of the failed atomic batch
+func rollBack(result *BatchResult) {
+	result.RolledBack = true
+	result.Written = make([]Record, 0)
+	result.Deleted = make([]Record, 0)
+	for i := range result.Results {
+		if result.Results[i].Status == BATCH_STATUS_REPLACED || result.Results[i].Status == BULK_STATUS_DELETED {
+			result.Results[i].Status = BATCH_STATUS_ROLLED_BACK
+		}
+	}
+}
+
+func validateBatchOperation(operation BatchOperation) error {
+	switch operation.Type {
+	case BATCH_REPLACE:
+		if operation.Id == primitive.NilObjectID || operation.Data == nil {
+			return fmt.Errorf("replace requires id and data")
+		}
+	case BATCH_DELETE:
+		if operation.Id == primitive.NilObjectID {
+			return fmt.Errorf("delete requires id")
+		}
+	default:
+		return fmt.Errorf("unknown operation '%v'", operation.Type)
+	}
+	return nil
+}
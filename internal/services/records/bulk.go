@@ -0,0 +1,236 @@
+package records
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	BULK_CREATE = "create"
+	BULK_UPDATE = "update"
+	BULK_DELETE = "delete"
+
+	BULK_STATUS_CREATED = "created"
+	BULK_STATUS_UPDATED = "updated"
+	BULK_STATUS_DELETED = "deleted"
+	BULK_STATUS_FAILED  = "failed"
+	// BULK_STATUS_SKIPPED is the status of the operations after the first failure of an ordered bulk
+	BULK_STATUS_SKIPPED = "skipped"
+)
+
+var ErrBulkEmpty = errors.New("bulk has no operations")
+var ErrBulkTooLarge = errors.New("bulk has too many operations")
+
+// BulkOperation is one write of a bulk. Update creates the record if there is no record with such id,
+// delete of a missing record succeeds: the same as for single record writes of API v1. Delete moves the record to the trash
+type BulkOperation struct {
+	Type string
+	Id   primitive.ObjectID
+	Data *string
+}
+
+type BulkOperationResult struct {
+	Status string              `json:"status"`
+	Id     *primitive.ObjectID `json:"id,omitempty"`
+	Error  string              `json:"error,omitempty"`
+}
+
+// BulkResult has the result of every operation in the same order, and the state of the written records for the cache
+type BulkResult struct {
+	Results []BulkOperationResult
+	Written []Record
+	Deleted []Record
+}
+
+// Bulk executes the operations with one bulk write. An ordered bulk stops at the first failed operation,
+// an unordered one tries all of them. Invalid operations fail without being sent to the database
+func (s *Service) Bulk(ctx context.Context, operations []BulkOperation, ordered bool) (*BulkResult, error) {
+	ctx, span := s.span(ctx, "Bulk")
+	defer span.End()
+
+	if len(operations) == 0 {
+		return nil, ErrBulkEmpty
+	}
+	if len(operations) > s.bulkMaxSize {
+		return nil, ErrBulkTooLarge
+	}
+
+	results := make([]BulkOperationResult, len(operations))
+	models := make([]mongo.WriteModel, 0, len(operations))
+	// indexes maps the index of the write model to the index of the operation
+	indexes := make([]int, 0, len(operations))
+	for i := range operations {
+		results[i].Status = BULK_STATUS_SKIPPED
+	}
+	for i, operation := range operations {
+		model, id, err := s.bulkModel(operation)
+		if err != nil {
+			results[i] = BulkOperationResult{Status: BULK_STATUS_FAILED, Error: err.Error()}
+			if ordered {
+				break
+			}
+			continue
+		}
+		results[i].Id = &id
+		models = append(models, model)
+		indexes = append(indexes, i)
+	}
+
+	result := &BulkResult{Results: results, Written: make([]Record, 0), Deleted: make([]Record, 0)}
+	if len(models) == 0 {
+		return result, nil
+	}
+
+	// the previous state for the history is read before the write, a concurrent write may get in between
+	targets := make([]primitive.ObjectID, 0, len(indexes))
+	for _, i := range indexes {
+		targets = append(targets, *results[i].Id)
+	}
+	before, err := s.states(ctx, targets)
+	if err != nil {
+		return nil, err
+	}
+
+	bulkResult, err := s.db.BulkWrite(ctx, s.dbName, RECORDS_COLLECTION_NAME, models, ordered)
+	if err != nil {
+		return nil, err
+	}
+
+	written := make([]primitive.ObjectID, 0, len(models))
+	deleted := make([]primitive.ObjectID, 0, len(models))
+	for modelIndex, i := range indexes {
+		if message, failed := bulkResult.Errors[modelIndex]; failed {
+			results[i] = BulkOperationResult{Status: BULK_STATUS_FAILED, Id: results[i].Id, Error: message}
+			if ordered {
+				break
+			}
+			continue
+		}
+
+		id := *results[i].Id
+		switch operations[i].Type {
+		case BULK_DELETE:
+			results[i].Status = BULK_STATUS_DELETED
+			deleted = append(deleted, id)
+		case BULK_CREATE:
+			results[i].Status = BULK_STATUS_CREATED
+			written = append(written, id)
+		default:
+			results[i].Status = BULK_STATUS_UPDATED
+			if _, upserted := bulkResult.Upserted[modelIndex]; upserted {
+				results[i].Status = BULK_STATUS_CREATED
+			}
+			written = append(written, id)
+		}
+	}
+
+	after, err := s.states(ctx, append(written, deleted...))
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range written {
+		if record, found := after[id]; found && record.DeletedAt == nil {
+			result.Written = append(result.Written, record)
+		}
+	}
+	for _, id := range deleted {
+		record, found := after[id]
+		if !found {
+			record = Record{Id: id}
+		}
+		result.Deleted = append(result.Deleted, record)
+	}
+	s.remember(ctx, s.bulkHistory(written, deleted, before, after)...)
+	return result, nil
+}
+
+// bulkHistory describes the writes of the bulk which have changed the records
+func (s *Service) bulkHistory(written []primitive.ObjectID, deleted []primitive.ObjectID, before map[primitive.ObjectID]Record, after map[primitive.ObjectID]Record) []HistoryEntry {
+	entries := make([]HistoryEntry, 0, len(written)+len(deleted))
+	for _, id := range written {
+		current, found := after[id]
+		if !found {
+			continue
+		}
+		previous, existed := before[id]
+		if !existed || previous.DeletedAt != nil {
+			entries = append(entries, s.historyEntry(HISTORY_CREATE, nil, &current))
+			continue
+		}
+		entries = append(entries, s.historyEntry(HISTORY_UPDATE, &previous, &current))
+	}
+	for _, id := range deleted {
+		previous, existed := before[id]
+		current, found := after[id]
+		// delete of a missing record succeeds without a write
+		if !existed || !found || previous.DeletedAt != nil || previous.Version == current.Version {
+			continue
+		}
+		entries = append(entries, s.historyEntry(HISTORY_DELETE, &previous, &current))
+	}
+	return entries
+}
+
+// states returns the records of ids in any state, including the trash
+func (s *Service) states(ctx context.Context, ids []primitive.ObjectID) (map[primitive.ObjectID]Record, error) {
+	result := make(map[primitive.ObjectID]Record, len(ids))
+	if len(ids) == 0 {
+		return result, nil
+	}
+	var found []Record = make([]Record, 0, len(ids))
+	err := s.db.Find(ctx, s.dbName, RECORDS_COLLECTION_NAME, bson.M{"_id": bson.M{"$in": ids}}, db.FindOptions{}, &found)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find documents. Error: %v", err)
+	}
+	for _, record := range found {
+		result[record.Id] = record
+	}
+	return result, nil
+}
+
+// GetByIds returns the existing records of ids, except the ones in the trash
+func (s *Service) GetByIds(ctx context.Context, ids []primitive.ObjectID) ([]Record, error) {
+	ctx, span := s.span(ctx, "GetByIds")
+	defer span.End()
+
+	var result []Record = make([]Record, 0, len(ids))
+	err := s.db.Find(ctx, s.dbName, RECORDS_COLLECTION_NAME, live(bson.M{"_id": bson.M{"$in": ids}}), db.FindOptions{}, &result)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find documents. Error: %v", err)
+	}
+	return result, nil
+}
+
+func (s *Service) bulkModel(operation BulkOperation) (mongo.WriteModel, primitive.ObjectID, error) {
+	switch operation.Type {
+	case BULK_CREATE:
+		if operation.Data == nil {
+			return nil, primitive.NilObjectID, fmt.Errorf("create requires data")
+		}
+		id := primitive.NewObjectID()
+		return s.upsertModel(id, *operation.Data), id, nil
+	case BULK_UPDATE:
+		if operation.Id == primitive.NilObjectID || operation.Data == nil {
+			return nil, primitive.NilObjectID, fmt.Errorf("update requires id and data")
+		}
+		return s.upsertModel(operation.Id, *operation.Data), operation.Id, nil
+	case BULK_DELETE:
+		if operation.Id == primitive.NilObjectID {
+			return nil, primitive.NilObjectID, fmt.Errorf("delete requires id")
+		}
+		return mongo.NewUpdateOneModel().SetFilter(live(bson.M{"_id": operation.Id})).SetUpdate(track(trash())), operation.Id, nil
+	}
+	return nil, primitive.NilObjectID, fmt.Errorf("unknown operation '%v'", operation.Type)
+}
+
+// upsertModel writes the record, the one in the trash is created again
+func (s *Service) upsertModel(id primitive.ObjectID, data string) mongo.WriteModel {
+	update := s.owned(track(bson.M{"$set": bson.M{"data": data}, "$unset": bson.M{DELETED_AT_FIELD: ""}}))
+	return mongo.NewUpdateOneModel().SetFilter(bson.M{"_id": id}).SetUpdate(update).SetUpsert(true)
+}
@@ -0,0 +1,194 @@
+package records
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ArtemVoronov/artforintrovert-test/internal/logging"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	VERSION_FIELD    = "version"
+	UPDATED_AT_FIELD = "updatedAt"
+	DELETED_AT_FIELD = "deletedAt"
+
+	// CHANGES_OVERLAP is how far back every changes query reaches before the previous one. A write takes its timestamp
+	// before the commit, so a concurrent write may become visible after a later one has been already read
+	CHANGES_OVERLAP = 5 * time.Second
+)
+
+// Changes are the records written and deleted since some moment. Applying them again is harmless
+type Changes struct {
+	Updated []Record
+	Deleted []primitive.ObjectID
+	// Until is the timestamp of the latest change, the next query continues from it
+	Until time.Time
+}
+
+type trackedRecord struct {
+	Record    `bson:",inline"`
+	UpdatedAt time.Time `bson:"updatedAt"`
+}
+
+type tombstone struct {
+	Id        primitive.ObjectID `bson:"_id"`
+	DeletedAt time.Time          `bson:"deletedAt"`
+}
+
+// track adds the version increment and the server side timestamp of the write to the update
+func track(update bson.M) bson.M {
+	update["$inc"] = bson.M{VERSION_FIELD: 1}
+	currentDate, ok := update["$currentDate"].(bson.M)
+	if !ok {
+		currentDate = bson.M{}
+	}
+	currentDate[UPDATED_AT_FIELD] = true
+	update["$currentDate"] = currentDate
+	return update
+}
+
+// versionFilter matches the record only in one of versions, nil versions match any.
+// Records written before the versioning have no version field, it reads as 0
+func versionFilter(id primitive.ObjectID, versions []int64) bson.M {
+	filter := bson.M{"_id": id}
+	if versions == nil {
+		return filter
+	}
+	for _, version := range versions {
+		if version == 0 {
+			filter["$or"] = bson.A{bson.M{VERSION_FIELD: bson.M{"$in": versions}}, bson.M{VERSION_FIELD: bson.M{"$exists": false}}}
+			return filter
+		}
+	}
+	filter[VERSION_FIELD] = bson.M{"$in": versions}
+	return filter
+}
+
+// versionError tells apart the conditional write which has not matched the version. As for HTTP preconditions,
+// a missing record does not match any version either
+func versionError(err error, versions []int64) error {
+	if versions != nil && errors.Is(err, db.ErrNotFound) {
+		return ErrVersionMismatch
+	}
+	return err
+}
+
+// bury leaves the tombstones of the purged records. The records are already deleted at this point, so the failure
+// is only logged: caches miss the deletes until the next full reload. The tombstones are left even if the caller
+// has gone meanwhile
+func (s *Service) bury(ctx context.Context, ids ...primitive.ObjectID) {
+	ctx = detached(ctx)
+	models := make([]mongo.WriteModel, 0, len(ids))
+	for _, id := range ids {
+		update := bson.M{"$currentDate": bson.M{DELETED_AT_FIELD: true}}
+		models = append(models, mongo.NewUpdateOneModel().SetFilter(bson.M{"_id": id}).SetUpdate(update).SetUpsert(true))
+	}
+	result, err := s.db.BulkWrite(ctx, s.dbName, TOMBSTONES_COLLECTION_NAME, models, false)
+	if err != nil {
+		logging.With(ctx, s.log).WithError(err).WithField("records", ids).Error("unable to write tombstones of records")
+		return
+	}
+	for index, message := range result.Errors {
+		logging.With(ctx, s.log).WithField("record", ids[index].Hex()).Errorf("unable to write tombstone of record: %v", message)
+	}
+}
+
+// LastChange returns the timestamp of the latest write or delete, the zero time if there were none.
+// It should be taken before the full reload and passed to GetChanges afterwards
+func (s *Service) LastChange(ctx context.Context) (time.Time, error) {
+	ctx, span := s.span(ctx, "LastChange")
+	defer span.End()
+
+	updated, err := s.latest(ctx, RECORDS_COLLECTION_NAME, UPDATED_AT_FIELD)
+	if err != nil {
+		return time.Time{}, err
+	}
+	deleted, err := s.latest(ctx, TOMBSTONES_COLLECTION_NAME, DELETED_AT_FIELD)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if deleted.After(updated) {
+		return deleted, nil
+	}
+	return updated, nil
+}
+
+// GetChanges returns the records written and deleted since the timestamp, moving to the trash is a delete.
+// If a record has been purged and created again with the same id, the latest of both wins
+func (s *Service) GetChanges(ctx context.Context, since time.Time) (Changes, error) {
+	ctx, span := s.span(ctx, "GetChanges")
+	defer span.End()
+
+	from := since.Add(-CHANGES_OVERLAP)
+
+	var updated []trackedRecord = make([]trackedRecord, 0)
+	filter := bson.M{UPDATED_AT_FIELD: bson.M{"$gte": from}}
+	opts := db.FindOptions{Sort: bson.D{{Key: UPDATED_AT_FIELD, Value: 1}}}
+	err := s.db.Find(ctx, s.dbName, RECORDS_COLLECTION_NAME, filter, opts, &updated)
+	if err != nil {
+		return Changes{}, fmt.Errorf("unable to get changed documents. Error: %v", err)
+	}
+
+	var deleted []tombstone = make([]tombstone, 0)
+	filter = bson.M{DELETED_AT_FIELD: bson.M{"$gte": from}}
+	opts = db.FindOptions{Sort: bson.D{{Key: DELETED_AT_FIELD, Value: 1}}}
+	err = s.db.Find(ctx, s.dbName, TOMBSTONES_COLLECTION_NAME, filter, opts, &deleted)
+	if err != nil {
+		return Changes{}, fmt.Errorf("unable to get tombstones. Error: %v", err)
+	}
+
+	result := Changes{Updated: make([]Record, 0, len(updated)), Deleted: make([]primitive.ObjectID, 0, len(deleted)), Until: since}
+	deletedAt := make(map[primitive.ObjectID]time.Time, len(deleted))
+	for _, t := range deleted {
+		deletedAt[t.Id] = t.DeletedAt
+		if t.DeletedAt.After(result.Until) {
+			result.Until = t.DeletedAt
+		}
+	}
+	for _, r := range updated {
+		if r.UpdatedAt.After(result.Until) {
+			result.Until = r.UpdatedAt
+		}
+		if at, found := deletedAt[r.Id]; found {
+			if !r.UpdatedAt.After(at) {
+				continue
+			}
+			delete(deletedAt, r.Id)
+		}
+		if r.DeletedAt != nil {
+			result.Deleted = append(result.Deleted, r.Id)
+			continue
+		}
+		result.Updated = append(result.Updated, r.Record)
+	}
+	for _, t := range deleted {
+		if _, found := deletedAt[t.Id]; found {
+			result.Deleted = append(result.Deleted, t.Id)
+		}
+	}
+	return result, nil
+}
+
+func (s *Service) latest(ctx context.Context, collectionName string, field string) (time.Time, error) {
+	var result []bson.M = make([]bson.M, 0)
+	filter := bson.M{field: bson.M{"$exists": true}}
+	opts := db.FindOptions{Sort: bson.D{{Key: field, Value: -1}}, Limit: 1}
+	err := s.db.Find(ctx, s.dbName, collectionName, filter, opts, &result)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unable to get the latest '%v' of '%v'. Error: %v", field, collectionName, err)
+	}
+	if len(result) == 0 {
+		return time.Time{}, nil
+	}
+	at, ok := result[0][field].(primitive.DateTime)
+	if !ok {
+		return time.Time{}, fmt.Errorf("unable to get the latest '%v' of '%v': unexpected type %T", field, collectionName, result[0][field])
+	}
+	return at.Time(), nil
+}
@@ -0,0 +1,33 @@
+package records
+
+import (
+	"context"
+	"time"
+)
+
+// detachedContext keeps the values of the parent, e.g. its span, but neither its deadline nor its cancellation
+type detachedContext struct {
+	parent context.Context
+}
+
+// detached returns the context of the writes which have to follow the done ones whatever happens to the caller.
+// The queries are still limited by the query timeout
+func detached(ctx context.Context) context.Context {
+	return detachedContext{parent: ctx}
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
@@ -0,0 +1,220 @@
+package records
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ArtemVoronov/artforintrovert-test/internal/logging"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	HISTORY_COLLECTION_NAME = "records_history"
+
+	HISTORY_CREATE  = "create"
+	HISTORY_UPDATE  = "update"
+	HISTORY_DELETE  = "delete"
+	HISTORY_RESTORE = "restore"
+	HISTORY_REVERT  = "revert"
+
+	DEFAULT_HISTORY_LIMIT = 100
+	MAX_HISTORY_LIMIT     = 1000
+)
+
+// ErrVersionNotInHistory means that the record history has no entry of the version
+var ErrVersionNotInHistory = errors.New("version is not in the record history")
+
+// ErrVersionWithoutData means that the version is a delete, there is no data to revert to
+var ErrVersionWithoutData = errors.New("version has no data")
+
+// Audit tells who makes the writes, it is stored with every history entry
+type Audit struct {
+	Actor     string
+	RequestId string
+}
+
+// HistoryEntry is the immutable trace of one write of a record. Version is the version of the record after the write
+type HistoryEntry struct {
+	Id         primitive.ObjectID `json:"id" bson:"_id"`
+	RecordId   primitive.ObjectID `json:"recordId" bson:"recordId"`
+	Version    int64              `json:"version" bson:"version"`
+	Operation  string             `json:"operation" bson:"operation"`
+	OldData    *string            `json:"oldData" bson:"oldData"`
+	NewData    *string            `json:"newData" bson:"newData"`
+	RevertedTo *int64             `json:"revertedTo,omitempty" bson:"revertedTo,omitempty"`
+	At         time.Time          `json:"at" bson:"at"`
+	Actor      string             `json:"actor" bson:"actor"`
+	RequestId  string             `json:"requestId,omitempty" bson:"requestId,omitempty"`
+	Tenant     string             `json:"-" bson:"tenant"`
+}
+
+// WithAudit returns the service writing the history entries on behalf of the audit
+func (s *Service) WithAudit(audit Audit) RecordsService {
+	result := *s
+	result.audit = audit
+	return &result
+}
+
+// modify applies the update to the record read in the state at its current version, so the history gets the exact
+// previous record. The record written meanwhile is read again. Returns db.ErrNotFound if there is no record in the state,
+// or ErrVersionMismatch if the record does not match versions
+func (s *Service) modify(ctx context.Context, id primitive.ObjectID, versions []int64, state func(bson.M) bson.M, update bson.M) (*Record, *Record, error) {
+	return s.modifyWith(ctx, id, versions, state, func(bson.M) bson.M { return update })
+}
+
+// modifyWith is modify with the update made of the current document of the record
+func (s *Service) modifyWith(ctx context.Context, id primitive.ObjectID, versions []int64, state func(bson.M) bson.M, update func(current bson.M) bson.M) (*Record, *Record, error) {
+	for {
+		var current bson.M
+		err := s.db.FindOne(ctx, s.dbName, RECORDS_COLLECTION_NAME, state(bson.M{"_id": id}), &current)
+		if err != nil {
+			return nil, nil, versionError(err, versions)
+		}
+		var before Record
+		err = decode(current, &before)
+		if err != nil {
+			return nil, nil, err
+		}
+		if versions != nil && !hasVersion(versions, before.Version) {
+			return nil, nil, ErrVersionMismatch
+		}
+
+		var after Record
+		filter := state(versionFilter(id, []int64{before.Version}))
+		err = s.db.FindOneAndUpdate(ctx, s.dbName, RECORDS_COLLECTION_NAME, filter, track(update(current)), false, &after)
+		if errors.Is(err, db.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		return &before, &after, nil
+	}
+}
+
+func decode(document interface{}, result interface{}) error {
+	data, err := bson.Marshal(document)
+	if err != nil {
+		return fmt.Errorf("unable to encode document. Error: %v", err)
+	}
+	err = bson.Unmarshal(data, result)
+	if err != nil {
+		return fmt.Errorf("unable to decode document. Error: %v", err)
+	}
+	return nil
+}
+
+func hasVersion(versions []int64, version int64) bool {
+	for _, v := range versions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// historyEntry describes the write turning before into after, nil is the missing or deleted record
+func (s *Service) historyEntry(operation string, before *Record, after *Record) HistoryEntry {
+	entry := HistoryEntry{
+		Id:        primitive.NewObjectID(),
+		Operation: operation,
+		At:        time.Now().UTC(),
+		Actor:     s.audit.Actor,
+		RequestId: s.audit.RequestId,
+	}
+	if before != nil {
+		entry.RecordId = before.Id
+		entry.Tenant = TenantOf(*before)
+		entry.Version = before.Version
+		if before.DeletedAt == nil {
+			data := before.Data
+			entry.OldData = &data
+		}
+	}
+	if after != nil {
+		entry.RecordId = after.Id
+		entry.Tenant = TenantOf(*after)
+		entry.Version = after.Version
+		if after.DeletedAt == nil {
+			data := after.Data
+			entry.NewData = &data
+		}
+	}
+	return entry
+}
+
+// remember appends the entries to the history. The records are already written at this point, so the failure
+// is only logged, and the history is written even if the caller has gone meanwhile
+func (s *Service) remember(ctx context.Context, entries ...HistoryEntry) {
+	if len(entries) == 0 {
+		return
+	}
+	ctx = detached(ctx)
+	models := make([]mongo.WriteModel, len(entries))
+	for i, entry := range entries {
+		models[i] = mongo.NewInsertOneModel().SetDocument(entry)
+	}
+	result, err := s.db.BulkWrite(ctx, s.dbName, HISTORY_COLLECTION_NAME, models, false)
+	if err != nil {
+		logging.With(ctx, s.log).WithError(err).Error("unable to write history of records")
+		return
+	}
+	for index, message := range result.Errors {
+		logging.With(ctx, s.log).WithField("record", entries[index].RecordId.Hex()).Errorf("unable to write history of record: %v", message)
+	}
+}
+
+// GetHistory returns the history of the record from the latest version. A positive before skips the entries
+// of the version and later ones
+func (s *Service) GetHistory(ctx context.Context, id primitive.ObjectID, before int64, limit int) ([]HistoryEntry, error) {
+	ctx, span := s.span(ctx, "GetHistory")
+	defer span.End()
+
+	var result []HistoryEntry = make([]HistoryEntry, 0)
+	filter := bson.M{"recordId": id}
+	if before > 0 {
+		filter["version"] = bson.M{"$lt": before}
+	}
+	opts := db.FindOptions{Sort: bson.D{{Key: "version", Value: -1}, {Key: "_id", Value: -1}}, Limit: int64(limit)}
+	err := s.db.Find(ctx, s.dbName, HISTORY_COLLECTION_NAME, filter, opts, &result)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get history of record '%v'. Error: %v", id.Hex(), err)
+	}
+	return result, nil
+}
+
+// Revert sets the data of the record to the one it had at the version. Returns ErrVersionNotInHistory
+// or ErrVersionWithoutData if there is nothing to revert to, the errors of Update otherwise.
+// A record purged and created again with the same id restarts its versions, the latest entry of the version is taken
+func (s *Service) Revert(ctx context.Context, id primitive.ObjectID, version int64, versions []int64) (*Record, error) {
+	ctx, span := s.span(ctx, "Revert")
+	defer span.End()
+
+	var entries []HistoryEntry
+	opts := db.FindOptions{Sort: bson.D{{Key: "_id", Value: -1}}, Limit: 1}
+	err := s.db.Find(ctx, s.dbName, HISTORY_COLLECTION_NAME, bson.M{"recordId": id, "version": version}, opts, &entries)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get version %v of record '%v'. Error: %v", version, id.Hex(), err)
+	}
+	if len(entries) == 0 {
+		return nil, ErrVersionNotInHistory
+	}
+	entry := entries[0]
+	if entry.NewData == nil {
+		return nil, ErrVersionWithoutData
+	}
+
+	before, after, err := s.modify(ctx, id, versions, live, bson.M{"$set": bson.M{"data": *entry.NewData}})
+	if err != nil {
+		return nil, err
+	}
+	reverted := s.historyEntry(HISTORY_REVERT, before, after)
+	reverted.RevertedTo = &version
+	s.remember(ctx, reverted)
+	return after, nil
+}
@@ -0,0 +1,229 @@
+package records
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	SORT_BY_ID   = "id"
+	SORT_BY_DATA = "data"
+
+	DEFAULT_PAGE_LIMIT = 100
+	MAX_PAGE_LIMIT     = 1000
+)
+
+// Query describes one page of records. The same query is executed either by mongo or in process over the cache,
+// and both ways return identical pages
+type Query struct {
+	Limit  int
+	After  *Cursor
+	SortBy string
+	Desc   bool
+
+	// Data selects records with exactly this data
+	Data *string
+	// Prefix selects records which data starts with the value
+	Prefix string
+	// Search selects records which data contains the value, case insensitive
+	Search string
+	// Text selects records which data contains any of the words, case insensitive. Requires the text index
+	Text string
+}
+
+// Cursor points to the last record of the previous page
+type Cursor struct {
+	SortBy string             `json:"sort"`
+	Desc   bool               `json:"desc,omitempty"`
+	Id     primitive.ObjectID `json:"id"`
+	Data   string             `json:"data,omitempty"`
+}
+
+type Page struct {
+	Records []Record `json:"records"`
+	Next    string   `json:"next,omitempty"`
+}
+
+func EncodeCursor(cursor Cursor) string {
+	raw, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func DecodeCursor(value string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode cursor: %v", err)
+	}
+	var cursor Cursor
+	err = json.Unmarshal(raw, &cursor)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode cursor: %v", err)
+	}
+	if cursor.SortBy != SORT_BY_ID && cursor.SortBy != SORT_BY_DATA {
+		return nil, fmt.Errorf("unable to decode cursor: unknown sort '%v'", cursor.SortBy)
+	}
+	return &cursor, nil
+}
+
+// Paginate executes the query over records in process. The records must be sorted by SortOf(q.SortBy)
+func Paginate(sorted []Record, q Query) Page {
+	ascending := q
+	ascending.Desc = false
+	start, step := 0, 1
+	if q.Desc {
+		start, step = len(sorted)-1, -1
+	}
+	if q.After != nil {
+		after := q.cursorRecord()
+		if q.Desc {
+			start = sort.Search(len(sorted), func(i int) bool { return !ascending.less(sorted[i], after) }) - 1
+		} else {
+			start = sort.Search(len(sorted), func(i int) bool { return ascending.less(after, sorted[i]) })
+		}
+	}
+
+	matches := q.matcher()
+	selected := make([]Record, 0)
+	for i := start; i >= 0 && i < len(sorted) && len(selected) <= q.Limit; i += step {
+		if matches(sorted[i]) {
+			selected = append(selected, sorted[i])
+		}
+	}
+	return q.page(selected)
+}
+
+// SortOf sorts the records in the ascending order of the sort
+func SortOf(sortBy string, records []Record) {
+	q := Query{SortBy: sortBy}
+	sort.Slice(records, func(i, j int) bool {
+		return q.less(records[i], records[j])
+	})
+}
+
+// less reports whether a goes before b in the query order. Records with the same data are ordered by id
+func (q Query) less(a Record, b Record) bool {
+	if q.SortBy == SORT_BY_DATA {
+		if result := strings.Compare(a.Data, b.Data); result != 0 {
+			return (result < 0) != q.Desc
+		}
+	}
+	if result := bytes.Compare(a.Id[:], b.Id[:]); result != 0 {
+		return (result < 0) != q.Desc
+	}
+	return false
+}
+
+func (q Query) cursorRecord() Record {
+	return Record{Id: q.After.Id, Data: q.After.Data}
+}
+
+// page cuts the sorted records to the limit, the caller should provide one extra record to detect the next page
+func (q Query) page(sorted []Record) Page {
+	if len(sorted) <= q.Limit {
+		return Page{Records: sorted}
+	}
+	last := sorted[q.Limit-1]
+	return Page{
+		Records: sorted[:q.Limit],
+		Next:    EncodeCursor(Cursor{SortBy: q.SortBy, Desc: q.Desc, Id: last.Id, Data: q.cursorData(last)}),
+	}
+}
+
+func (q Query) cursorData(record Record) string {
+	if q.SortBy == SORT_BY_DATA {
+		return record.Data
+	}
+	return ""
+}
+
+// matcher is the in process equivalent of the data conditions of filter
+func (q Query) matcher() func(record Record) bool {
+	var search *regexp.Regexp
+	if q.Search != "" {
+		search = regexp.MustCompile("(?i)" + regexp.QuoteMeta(q.Search))
+	}
+	terms := db.TextTerms(q.Text)
+
+	return func(record Record) bool {
+		if q.Data != nil && record.Data != *q.Data {
+			return false
+		}
+		if q.Prefix != "" && !strings.HasPrefix(record.Data, q.Prefix) {
+			return false
+		}
+		if search != nil && !search.MatchString(record.Data) {
+			return false
+		}
+		if len(terms) != 0 && !containsAny(db.TextTerms(record.Data), terms) {
+			return false
+		}
+		return true
+	}
+}
+
+func (q Query) filter() bson.M {
+	conditions := bson.A{}
+
+	if q.After != nil {
+		operator := "$gt"
+		if q.Desc {
+			operator = "$lt"
+		}
+		if q.SortBy == SORT_BY_DATA {
+			conditions = append(conditions, bson.M{"$or": bson.A{
+				bson.M{"data": bson.M{operator: q.After.Data}},
+				bson.M{"data": q.After.Data, "_id": bson.M{operator: q.After.Id}},
+			}})
+		} else {
+			conditions = append(conditions, bson.M{"_id": bson.M{operator: q.After.Id}})
+		}
+	}
+	if q.Data != nil {
+		conditions = append(conditions, bson.M{"data": *q.Data})
+	}
+	if q.Prefix != "" {
+		conditions = append(conditions, bson.M{"data": bson.M{"$regex": "^" + regexp.QuoteMeta(q.Prefix)}})
+	}
+	if q.Search != "" {
+		conditions = append(conditions, bson.M{"data": bson.M{"$regex": regexp.QuoteMeta(q.Search), "$options": "i"}})
+	}
+	if terms := db.TextTerms(q.Text); len(terms) != 0 {
+		conditions = append(conditions, bson.M{"$text": bson.M{"$search": strings.Join(terms, " ")}})
+	}
+
+	if len(conditions) == 0 {
+		return bson.M{}
+	}
+	return bson.M{"$and": conditions}
+}
+
+func (q Query) sort() bson.D {
+	direction := 1
+	if q.Desc {
+		direction = -1
+	}
+	if q.SortBy == SORT_BY_DATA {
+		return bson.D{{Key: "data", Value: direction}, {Key: "_id", Value: direction}}
+	}
+	return bson.D{{Key: "_id", Value: direction}}
+}
+
+func containsAny(words []string, terms []string) bool {
+	for _, word := range words {
+		for _, term := range terms {
+			if word == term {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -2,89 +2,312 @@ package records
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"sync"
+	"time"
 
 	"github.com/ArtemVoronov/artforintrovert-test/internal/services/db"
-	"github.com/ArtemVoronov/artforintrovert-test/internal/utils"
+	"github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 const (
-	RECORDS_COLLECTION_NAME = "records"
+	RECORDS_COLLECTION_NAME    = "records"
+	TOMBSTONES_COLLECTION_NAME = "records_tombstones"
 )
 
 type Record struct {
 	Id   primitive.ObjectID `json:"id" bson:"_id" binding:"required"`
 	Data string             `json:"data" bson:"data"  binding:"required"`
+	// Version is incremented on every write, the API exposes it as the ETag
+	Version int64 `json:"-" bson:"version"`
+	// DeletedAt is set while the record is in the trash
+	DeletedAt *time.Time `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
+	// Tenant owns the record, see TenantOf
+	Tenant string `json:"-" bson:"tenant,omitempty"`
 }
 
+// serverFields are kept by Replace
+var serverFields = map[string]bool{"_id": true, VERSION_FIELD: true, TENANT_FIELD: true, UPDATED_AT_FIELD: true, DELETED_AT_FIELD: true}
+
+var ErrTextSearchDisabled = errors.New("text search is disabled")
+
+// ErrVersionMismatch means that the record has been changed since the version the write is conditioned on
+var ErrVersionMismatch = errors.New("record version does not match")
+
 type RecordsService interface {
 	ShutDown()
-	Insert(document interface{}) (*primitive.ObjectID, error)
-	Upsert(id primitive.ObjectID, document interface{}) (*primitive.ObjectID, error)
-	Delete(id primitive.ObjectID) error
-	GetAllRecords() ([]Record, error)
+	Insert(ctx context.Context, document interface{}) (*Record, error)
+	Upsert(ctx context.Context, id primitive.ObjectID, document interface{}) (*Record, bool, error)
+	Delete(ctx context.Context, id primitive.ObjectID, versions []int64) (*Record, error)
+	Replace(ctx context.Context, id primitive.ObjectID, document interface{}, versions []int64) (*Record, error)
+	Update(ctx context.Context, id primitive.ObjectID, document interface{}, versions []int64) (*Record, error)
+	GetById(ctx context.Context, id primitive.ObjectID) (*Record, error)
+	GetByIds(ctx context.Context, ids []primitive.ObjectID) ([]Record, error)
+	Bulk(ctx context.Context, operations []BulkOperation, ordered bool) (*BulkResult, error)
+	Batch(ctx context.Context, operations []BatchOperation, atomic bool) (*BatchResult, error)
+	GetAll(ctx context.Context) ([]Record, error)
+	Find(ctx context.Context, q Query) (Page, error)
+	FindTrash(ctx context.Context, q Query) (Page, error)
+	Restore(ctx context.Context, id primitive.ObjectID) (*Record, error)
+	Purge(ctx context.Context, before time.Time) (int, error)
+	Validate(q Query) error
+	LastChange(ctx context.Context) (time.Time, error)
+	GetChanges(ctx context.Context, since time.Time) (Changes, error)
+	Watch(ctx context.Context, resumeToken bson.Raw) (db.ChangeStream, error)
+	ResumeToken(ctx context.Context, instance string) (bson.Raw, error)
+	SaveResumeToken(ctx context.Context, instance string, token bson.Raw) error
+	WithAudit(audit Audit) RecordsService
+	WithTenant(tenant string) RecordsService
+	GetHistory(ctx context.Context, id primitive.ObjectID, before int64, limit int) ([]HistoryEntry, error)
+	Revert(ctx context.Context, id primitive.ObjectID, version int64, versions []int64) (*Record, error)
+}
+
+// ChangeEvent is a change stream event of the records collection
+type ChangeEvent struct {
+	OperationType string `bson:"operationType"`
+	DocumentKey   struct {
+		Id primitive.ObjectID `bson:"_id"`
+	} `bson:"documentKey"`
+	FullDocument *Record `bson:"fullDocument"`
 }
+
 type Service struct {
-	dbName string
+	db           db.MongoService
+	dbName       string
+	textSearch   bool
+	tombstoneTTL time.Duration
+	bulkMaxSize  int
+	audit        Audit
+	// tenant is empty for the service over the records of all tenants
+	tenant string
+	log    *logrus.Entry
 }
 
-var once sync.Once
-var instance *Service
+func CreateService(db db.MongoService, logger *logrus.Entry, config Config) *Service {
+	return &Service{
+		db:           db,
+		log:          logger,
+		dbName:       config.DBName,
+		textSearch:   config.TextSearch,
+		tombstoneTTL: config.TombstoneTTL,
+		bulkMaxSize:  config.BulkMaxSize,
+	}
+}
 
-func Instance() *Service {
-	once.Do(func() {
-		if instance == nil {
-			instance = createService()
-		}
+// Setup prepares the collection indexes
+func (s *Service) Setup(ctx context.Context) error {
+	err := s.db.CreateIndex(ctx, s.dbName, RECORDS_COLLECTION_NAME, mongo.IndexModel{
+		Keys: bson.D{{Key: UPDATED_AT_FIELD, Value: 1}},
+	})
+	if err != nil {
+		return err
+	}
+	err = s.db.CreateIndex(ctx, s.dbName, RECORDS_COLLECTION_NAME, mongo.IndexModel{
+		Keys:    bson.D{{Key: DELETED_AT_FIELD, Value: 1}},
+		Options: options.Index().SetSparse(true),
+	})
+	if err != nil {
+		return err
+	}
+	err = s.db.CreateIndex(ctx, s.dbName, TOMBSTONES_COLLECTION_NAME, mongo.IndexModel{
+		Keys:    bson.D{{Key: DELETED_AT_FIELD, Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(int32(s.tombstoneTTL / time.Second)),
+	})
+	if err != nil {
+		return err
+	}
+
+	err = s.db.CreateIndex(ctx, s.dbName, RECORDS_COLLECTION_NAME, mongo.IndexModel{
+		Keys: bson.D{{Key: TENANT_FIELD, Value: 1}},
 	})
-	return instance
+	if err != nil {
+		return err
+	}
+
+	err = s.db.CreateIndex(ctx, s.dbName, HISTORY_COLLECTION_NAME, mongo.IndexModel{
+		Keys: bson.D{{Key: "recordId", Value: 1}, {Key: "version", Value: -1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	if !s.textSearch {
+		return nil
+	}
+	index := mongo.IndexModel{
+		Keys:    bson.D{{Key: "data", Value: "text"}},
+		Options: options.Index().SetDefaultLanguage("none"),
+	}
+	return s.db.CreateIndex(ctx, s.dbName, RECORDS_COLLECTION_NAME, index)
 }
 
 func (s *Service) ShutDown() {
 }
 
-func (s *Service) Insert(document interface{}) (*primitive.ObjectID, error) {
-	return db.Instance().Insert(s.dbName, RECORDS_COLLECTION_NAME, document)
-}
+// Insert creates the record. The id is generated here, so the insert is an upsert and the database sets updatedAt
+func (s *Service) Insert(ctx context.Context, document interface{}) (*Record, error) {
+	ctx, span := s.span(ctx, "Insert")
+	defer span.End()
 
-func (s *Service) Upsert(id primitive.ObjectID, document interface{}) (*primitive.ObjectID, error) {
-	return db.Instance().Upsert(s.dbName, RECORDS_COLLECTION_NAME, id, document)
+	var result Record
+	filter := bson.M{"_id": primitive.NewObjectID()}
+	err := s.db.FindOneAndUpdate(ctx, s.dbName, RECORDS_COLLECTION_NAME, filter, s.owned(track(bson.M{"$set": document})), true, &result)
+	if err != nil {
+		return nil, err
+	}
+	s.remember(ctx, s.historyEntry(HISTORY_CREATE, nil, &result))
+	return &result, nil
 }
 
-func (s *Service) Delete(id primitive.ObjectID) error {
-	return db.Instance().Delete(s.dbName, RECORDS_COLLECTION_NAME, id)
+// Upsert updates the record or creates it if there is no record with such id, reports whether the record has been created.
+// A record in the trash is created again with the same id. Returns db.ErrDuplicateKey if the id is taken by a record of another tenant
+func (s *Service) Upsert(ctx context.Context, id primitive.ObjectID, document interface{}) (*Record, bool, error) {
+	ctx, span := s.span(ctx, "Upsert")
+	defer span.End()
+
+	result, err := s.Update(ctx, id, document, nil)
+	if !errors.Is(err, db.ErrNotFound) {
+		return result, false, err
+	}
+
+	var created Record
+	update := s.owned(track(bson.M{"$set": document, "$unset": bson.M{DELETED_AT_FIELD: ""}}))
+	err = s.db.FindOneAndUpdate(ctx, s.dbName, RECORDS_COLLECTION_NAME, bson.M{"_id": id}, update, true, &created)
+	if err != nil {
+		return nil, false, err
+	}
+	s.remember(ctx, s.historyEntry(HISTORY_CREATE, nil, &created))
+	return &created, true, nil
 }
 
-func (s *Service) GetAll() ([]Record, error) {
-	var result []Record = make([]Record, 0)
+// Delete moves the record to the trash and returns it, the purge removes it permanently after the retention period.
+// Returns db.ErrNotFound if there is no record with such id, or ErrVersionMismatch if the record does not match versions
+func (s *Service) Delete(ctx context.Context, id primitive.ObjectID, versions []int64) (*Record, error) {
+	ctx, span := s.span(ctx, "Delete")
+	defer span.End()
 
-	collection := db.Instance().GetCollection(s.dbName, RECORDS_COLLECTION_NAME)
+	before, after, err := s.modify(ctx, id, versions, live, trash())
+	if err != nil {
+		return nil, err
+	}
+	s.remember(ctx, s.historyEntry(HISTORY_DELETE, before, after))
+	return after, nil
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), db.Instance().GetQueryTimeout())
-	defer cancel()
+// Replace overwrites the whole record, the fields missing in the document are removed except the server maintained ones.
+// Returns db.ErrNotFound if there is no record with such id, or ErrVersionMismatch if the record does not match versions
+func (s *Service) Replace(ctx context.Context, id primitive.ObjectID, document interface{}, versions []int64) (*Record, error) {
+	ctx, span := s.span(ctx, "Replace")
+	defer span.End()
 
-	cursor, err := collection.Find(ctx, bson.D{})
+	var fields bson.M
+	err := decode(document, &fields)
 	if err != nil {
-		return result, fmt.Errorf("unable to get all documents. Error: %v", err)
+		return nil, err
+	}
+	before, after, err := s.modifyWith(ctx, id, versions, live, func(current bson.M) bson.M {
+		return replacement(current, fields)
+	})
+	if err != nil {
+		return nil, err
 	}
-	defer cursor.Close(ctx)
+	s.remember(ctx, s.historyEntry(HISTORY_UPDATE, before, after))
+	return after, nil
+}
 
-	for cursor.Next(ctx) {
-		var document Record
-		err := cursor.Decode(&document)
-		if err != nil {
-			return result, fmt.Errorf("unable to get all documents. Error: %v", err)
+// replacement sets the fields and unsets the other fields of the current document
+func replacement(current bson.M, fields bson.M) bson.M {
+	update := bson.M{"$set": fields}
+	unset := bson.M{}
+	for field := range current {
+		if _, ok := fields[field]; ok || serverFields[field] {
+			continue
 		}
-		result = append(result, document)
+		unset[field] = ""
+	}
+	if len(unset) != 0 {
+		update["$unset"] = unset
+	}
+	return update
+}
+
+// Update sets only the fields of document. Returns db.ErrNotFound if there is no record with such id,
+// or ErrVersionMismatch if the record does not match versions
+func (s *Service) Update(ctx context.Context, id primitive.ObjectID, document interface{}, versions []int64) (*Record, error) {
+	ctx, span := s.span(ctx, "Update")
+	defer span.End()
+
+	before, after, err := s.modify(ctx, id, versions, live, bson.M{"$set": document})
+	if err != nil {
+		return nil, err
+	}
+	s.remember(ctx, s.historyEntry(HISTORY_UPDATE, before, after))
+	return after, nil
+}
+
+// GetById returns db.ErrNotFound if there is no record with such id
+func (s *Service) GetById(ctx context.Context, id primitive.ObjectID) (*Record, error) {
+	ctx, span := s.span(ctx, "GetById")
+	defer span.End()
+
+	var result Record
+	err := s.db.FindOne(ctx, s.dbName, RECORDS_COLLECTION_NAME, live(bson.M{"_id": id}), &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (s *Service) GetAll(ctx context.Context) ([]Record, error) {
+	ctx, span := s.span(ctx, "GetAll")
+	defer span.End()
+
+	var result []Record = make([]Record, 0)
+
+	err := s.db.Find(ctx, s.dbName, RECORDS_COLLECTION_NAME, live(bson.M{}), db.FindOptions{}, &result)
+	if err != nil {
+		return result, fmt.Errorf("unable to get all documents. Error: %v", err)
 	}
 	return result, nil
 }
 
-func createService() *Service {
-	return &Service{
-		dbName: utils.EnvVarDefault("DATABASE_NAME", "testdb"),
+// Validate checks that the query is supported by the service configuration
+func (s *Service) Validate(q Query) error {
+	if q.Text != "" && !s.textSearch {
+		return ErrTextSearchDisabled
+	}
+	return nil
+}
+
+// Find returns one page of records queried from the database
+func (s *Service) Find(ctx context.Context, q Query) (Page, error) {
+	ctx, span := s.span(ctx, "Find")
+	defer span.End()
+
+	return s.find(ctx, live(q.filter()), q)
+}
+
+func (s *Service) find(ctx context.Context, filter bson.M, q Query) (Page, error) {
+	var result []Record = make([]Record, 0)
+
+	err := s.Validate(q)
+	if err != nil {
+		return Page{}, err
 	}
+
+	opts := db.FindOptions{Sort: q.sort(), Limit: int64(q.Limit + 1)}
+	err = s.db.Find(ctx, s.dbName, RECORDS_COLLECTION_NAME, filter, opts, &result)
+	if err != nil {
+		return Page{}, fmt.Errorf("unable to find documents. Error: %v", err)
+	}
+	return q.page(result), nil
+}
+
+// Watch opens a change stream over records. A nil token starts from now
+func (s *Service) Watch(ctx context.Context, resumeToken bson.Raw) (db.ChangeStream, error) {
+	return s.db.Watch(ctx, s.dbName, RECORDS_COLLECTION_NAME, resumeToken)
 }
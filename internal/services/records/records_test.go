@@ -0,0 +1,280 @@
+package records_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ArtemVoronov/artforintrovert-test/internal/logging"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/db"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/records"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/utils"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func CreateTestService(t *testing.T) *records.Service {
+	config := db.Config{
+		Driver:         utils.EnvVarDefault("DATABASE_DRIVER", db.DRIVER_MEMORY),
+		ConnectionURL:  db.ConnectionURL(),
+		ConnectTimeout: 5 * time.Second,
+		QueryTimeout:   5 * time.Second,
+	}
+	dbService, err := db.CreateService(logging.Default("db"), config)
+	if err != nil {
+		t.Fatalf("unable to setup db service: %v", err)
+	}
+	t.Cleanup(dbService.ShutDown)
+	for _, collection := range []string{records.RECORDS_COLLECTION_NAME, records.TOMBSTONES_COLLECTION_NAME, records.HISTORY_COLLECTION_NAME, records.SYNC_COLLECTION_NAME} {
+		err = dbService.Drop(context.Background(), db.DBName(), collection)
+		assert.Nil(t, err)
+	}
+	return records.CreateService(dbService, logging.Default("records"), records.Config{DBName: db.DBName(), TombstoneTTL: time.Hour, BulkMaxSize: 100})
+}
+
+func TestInsert(t *testing.T) {
+	service := CreateTestService(t)
+
+	created, err := service.Insert(context.Background(), bson.M{"data": "exponent"})
+
+	assert.Nil(t, err)
+	assert.False(t, created.Id.IsZero())
+	assert.Equal(t, "exponent", created.Data)
+	assert.Equal(t, int64(1), created.Version)
+	assert.Equal(t, records.DEFAULT_TENANT, created.Tenant)
+
+	found, err := service.GetById(context.Background(), created.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, created, found)
+}
+
+func TestUpsert(t *testing.T) {
+	t.Run("Created", func(t *testing.T) {
+		service := CreateTestService(t)
+		id := primitive.NewObjectID()
+
+		result, created, err := service.Upsert(context.Background(), id, bson.M{"data": "exponent"})
+
+		assert.Nil(t, err)
+		assert.True(t, created)
+		assert.Equal(t, id, result.Id)
+		assert.Equal(t, int64(1), result.Version)
+	})
+	t.Run("Updated", func(t *testing.T) {
+		service := CreateTestService(t)
+		existing, err := service.Insert(context.Background(), bson.M{"data": "exponent"})
+		assert.Nil(t, err)
+
+		result, created, err := service.Upsert(context.Background(), existing.Id, bson.M{"data": "pi"})
+
+		assert.Nil(t, err)
+		assert.False(t, created)
+		assert.Equal(t, "pi", result.Data)
+		assert.Equal(t, existing.Version+1, result.Version)
+	})
+	t.Run("CreatedAgainFromTrash", func(t *testing.T) {
+		service := CreateTestService(t)
+		existing, err := service.Insert(context.Background(), bson.M{"data": "exponent"})
+		assert.Nil(t, err)
+		_, err = service.Delete(context.Background(), existing.Id, nil)
+		assert.Nil(t, err)
+
+		result, created, err := service.Upsert(context.Background(), existing.Id, bson.M{"data": "pi"})
+
+		assert.Nil(t, err)
+		assert.True(t, created)
+		assert.Nil(t, result.DeletedAt)
+		assert.Equal(t, "pi", result.Data)
+	})
+	t.Run("IdOfAnotherTenant", func(t *testing.T) {
+		service := CreateTestService(t)
+		existing, err := service.WithTenant("acme").Insert(context.Background(), bson.M{"data": "exponent"})
+		assert.Nil(t, err)
+
+		_, _, err = service.WithTenant("globex").Upsert(context.Background(), existing.Id, bson.M{"data": "pi"})
+
+		assert.ErrorIs(t, err, db.ErrDuplicateKey)
+		found, err := service.GetById(context.Background(), existing.Id)
+		assert.Nil(t, err)
+		assert.Equal(t, "exponent", found.Data)
+	})
+}
+
+func TestNotFound(t *testing.T) {
+	service := CreateTestService(t)
+	id := primitive.NewObjectID()
+	ctx := context.Background()
+
+	_, err := service.GetById(ctx, id)
+	assert.ErrorIs(t, err, db.ErrNotFound)
+	_, err = service.Update(ctx, id, bson.M{"data": "pi"}, nil)
+	assert.ErrorIs(t, err, db.ErrNotFound)
+	_, err = service.Replace(ctx, id, bson.M{"data": "pi"}, nil)
+	assert.ErrorIs(t, err, db.ErrNotFound)
+	_, err = service.Delete(ctx, id, nil)
+	assert.ErrorIs(t, err, db.ErrNotFound)
+	_, err = service.Restore(ctx, id)
+	assert.ErrorIs(t, err, db.ErrNotFound)
+}
+
+func TestVersionMismatch(t *testing.T) {
+	service := CreateTestService(t)
+	existing, err := service.Insert(context.Background(), bson.M{"data": "exponent"})
+	assert.Nil(t, err)
+
+	_, err = service.Update(context.Background(), existing.Id, bson.M{"data": "pi"}, []int64{existing.Version + 1})
+	assert.ErrorIs(t, err, records.ErrVersionMismatch)
+	_, err = service.Delete(context.Background(), existing.Id, []int64{existing.Version + 1})
+	assert.ErrorIs(t, err, records.ErrVersionMismatch)
+
+	updated, err := service.Update(context.Background(), existing.Id, bson.M{"data": "pi"}, []int64{existing.Version})
+	assert.Nil(t, err)
+	assert.Equal(t, "pi", updated.Data)
+}
+
+func TestTrash(t *testing.T) {
+	service := CreateTestService(t)
+	existing, err := service.Insert(context.Background(), bson.M{"data": "exponent"})
+	assert.Nil(t, err)
+
+	_, err = service.Delete(context.Background(), existing.Id, nil)
+	assert.Nil(t, err)
+	_, err = service.GetById(context.Background(), existing.Id)
+	assert.ErrorIs(t, err, db.ErrNotFound)
+	_, err = service.Delete(context.Background(), existing.Id, nil)
+	assert.ErrorIs(t, err, db.ErrNotFound)
+
+	restored, err := service.Restore(context.Background(), existing.Id)
+	assert.Nil(t, err)
+	assert.Nil(t, restored.DeletedAt)
+	assert.Equal(t, "exponent", restored.Data)
+}
+
+func TestTenantIsolation(t *testing.T) {
+	service := CreateTestService(t)
+	acme, globex := service.WithTenant("acme"), service.WithTenant("globex")
+	existing, err := acme.Insert(context.Background(), bson.M{"data": "exponent"})
+	assert.Nil(t, err)
+	assert.Equal(t, "acme", existing.Tenant)
+
+	_, err = globex.GetById(context.Background(), existing.Id)
+	assert.ErrorIs(t, err, db.ErrNotFound)
+	_, err = globex.Update(context.Background(), existing.Id, bson.M{"data": "pi"}, nil)
+	assert.ErrorIs(t, err, db.ErrNotFound)
+	_, err = globex.Delete(context.Background(), existing.Id, nil)
+	assert.ErrorIs(t, err, db.ErrNotFound)
+
+	all, err := globex.GetAll(context.Background())
+	assert.Nil(t, err)
+	assert.Empty(t, all)
+	found, err := acme.GetById(context.Background(), existing.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, "exponent", found.Data)
+}
+
+func TestPaginate(t *testing.T) {
+	all := make([]records.Record, 0)
+	for _, data := range []string{"b", "a", "c", "a", "b"} {
+		all = append(all, records.Record{Id: primitive.NewObjectID(), Data: data})
+	}
+	records.SortOf(records.SORT_BY_DATA, all)
+
+	for _, desc := range []bool{false, true} {
+		q := records.Query{Limit: 2, SortBy: records.SORT_BY_DATA, Desc: desc}
+		result := make([]records.Record, 0)
+		for {
+			page := records.Paginate(all, q)
+			result = append(result, page.Records...)
+			if page.Next == "" {
+				break
+			}
+			cursor, err := records.DecodeCursor(page.Next)
+			assert.Nil(t, err)
+			assert.Equal(t, desc, cursor.Desc)
+			q.After = cursor
+		}
+
+		assert.Len(t, result, len(all))
+		for i := range result {
+			expected := all[i]
+			if desc {
+				expected = all[len(all)-1-i]
+			}
+			assert.Equal(t, expected, result[i])
+		}
+	}
+}
+
+func TestResumeToken(t *testing.T) {
+	service := CreateTestService(t)
+	ctx := context.Background()
+	assert.Nil(t, service.SaveResumeToken(ctx, "first", nil))
+
+	token, err := service.ResumeToken(ctx, "first")
+	assert.Nil(t, err)
+	assert.Nil(t, token)
+
+	for _, seq := range []int64{1, 2} {
+		expected, err := bson.Marshal(bson.M{"_data": seq})
+		assert.Nil(t, err)
+		assert.Nil(t, service.SaveResumeToken(ctx, "first", expected))
+
+		token, err = service.ResumeToken(ctx, "first")
+		assert.Nil(t, err)
+		assert.Equal(t, bson.Raw(expected), token)
+	}
+
+	other, err := bson.Marshal(bson.M{"_data": 3})
+	assert.Nil(t, err)
+	assert.Nil(t, service.SaveResumeToken(ctx, "second", other))
+	token, err = service.ResumeToken(ctx, "second")
+	assert.Nil(t, err)
+	assert.Equal(t, bson.Raw(other), token)
+
+	assert.Nil(t, service.SaveResumeToken(ctx, "first", nil))
+	token, err = service.ResumeToken(ctx, "first")
+	assert.Nil(t, err)
+	assert.Nil(t, token)
+	token, err = service.ResumeToken(ctx, "second")
+	assert.Nil(t, err)
+	assert.Equal(t, bson.Raw(other), token)
+}
+
+func TestTenantIsolationOfWrites(t *testing.T) {
+	ctx := context.Background()
+	service := CreateTestService(t)
+	existing, err := service.WithTenant("acme").Insert(ctx, bson.M{"data": "exponent"})
+	assert.Nil(t, err)
+	_, err = service.WithTenant("acme").Delete(ctx, existing.Id, nil)
+	assert.Nil(t, err)
+	_, err = service.WithTenant("acme").Restore(ctx, existing.Id)
+	assert.Nil(t, err)
+	globex := service.WithTenant("globex")
+	data := "pi"
+
+	_, err = globex.Replace(ctx, existing.Id, bson.M{"data": data}, nil)
+	assert.ErrorIs(t, err, db.ErrNotFound)
+	_, err = globex.Revert(ctx, existing.Id, existing.Version, nil)
+	assert.ErrorIs(t, err, records.ErrVersionNotInHistory)
+	_, _, err = globex.Upsert(ctx, existing.Id, bson.M{"data": data})
+	assert.ErrorIs(t, err, db.ErrDuplicateKey)
+
+	bulk, err := globex.Bulk(ctx, []records.BulkOperation{
+		{Type: records.BULK_UPDATE, Id: existing.Id, Data: &data},
+		{Type: records.BULK_DELETE, Id: existing.Id},
+	}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, records.BULK_STATUS_FAILED, bulk.Results[0].Status)
+
+	_, err = globex.Batch(ctx, []records.BatchOperation{{Type: records.BATCH_REPLACE, Id: existing.Id, Data: &data}}, false)
+	assert.Nil(t, err)
+	_, err = globex.Batch(ctx, []records.BatchOperation{{Type: records.BATCH_DELETE, Id: existing.Id}}, false)
+	assert.Nil(t, err)
+
+	found, err := service.WithTenant("acme").GetById(ctx, existing.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, "exponent", found.Data)
+	assert.Equal(t, "acme", found.Tenant)
+	assert.Equal(t, existing.Version+2, found.Version)
+}
@@ -0,0 +1,53 @@
+package records
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/db"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	SYNC_COLLECTION_NAME = "records_sync"
+	CHANGE_STREAM_SYNC   = "changestream"
+)
+
+type syncState struct {
+	Name        string   `bson:"name"`
+	Instance    string   `bson:"instance"`
+	ResumeToken bson.Raw `bson:"resumeToken,omitempty"`
+}
+
+// ResumeToken returns the change stream resume token stored by SaveResumeToken for the app instance, nil if there is none
+func (s *Service) ResumeToken(ctx context.Context, instance string) (bson.Raw, error) {
+	var state syncState
+	err := s.db.FindOne(ctx, s.dbName, SYNC_COLLECTION_NAME, syncFilter(instance), &state)
+	if errors.Is(err, db.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to get resume token. Error: %v", err)
+	}
+	return state.ResumeToken, nil
+}
+
+// SaveResumeToken stores the change stream resume token of the app instance, the nil token removes the stored one.
+// Every instance has its own token, since the instances apply the events at their own pace
+func (s *Service) SaveResumeToken(ctx context.Context, instance string, token bson.Raw) error {
+	update := bson.M{"$set": bson.M{"resumeToken": token}}
+	if token == nil {
+		update = bson.M{"$unset": bson.M{"resumeToken": ""}}
+	}
+	var state syncState
+	err := s.db.FindOneAndUpdate(ctx, s.dbName, SYNC_COLLECTION_NAME, syncFilter(instance), update, true, &state)
+	if err != nil {
+		return fmt.Errorf("unable to save resume token. Error: %v", err)
+	}
+	return nil
+}
+
+func syncFilter(instance string) bson.M {
+	return bson.M{"name": CHANGE_STREAM_SYNC, "instance": instance}
+}
@@ -0,0 +1,39 @@
+package records
+
+import (
+	"time"
+
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/db"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/utils"
+)
+
+type Config struct {
+	DBName     string
+	TextSearch bool
+	// TombstoneTTL is how long deletes are kept for incremental sync
+	TombstoneTTL time.Duration
+	// BulkMaxSize is the maximum number of operations in one bulk
+	BulkMaxSize int
+}
+
+func LoadConfig() Config {
+	return Config{
+		DBName:       db.DBName(),
+		TextSearch:   textSearchEnabled(),
+		TombstoneTTL: tombstoneTTL(),
+		BulkMaxSize:  bulkMaxSize(),
+	}
+}
+
+func textSearchEnabled() bool {
+	return utils.EnvVarDefault("RECORDS_TEXT_SEARCH_ENABLED", "false") == "true"
+}
+
+func tombstoneTTL() time.Duration {
+	value := utils.EnvVarIntDefault("RECORDS_TOMBSTONE_TTL_IN_SECONDS", "86400")
+	return time.Duration(value) * time.Second
+}
+
+func bulkMaxSize() int {
+	return utils.EnvVarIntDefault("RECORDS_BULK_MAX_OPERATIONS", "1000")
+}
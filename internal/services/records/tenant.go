@@ -0,0 +1,50 @@
+package records
+
+import (
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/db"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	TENANT_FIELD = "tenant"
+	// DEFAULT_TENANT owns the records of the requests without a tenant and the records written before the tenancy
+	DEFAULT_TENANT = "default"
+)
+
+// WithTenant returns the service seeing and writing only the records of the tenant. Every query of the returned
+// service, including the history ones, is limited to the tenant by db.Scope
+func (s *Service) WithTenant(tenant string) RecordsService {
+	if tenant == "" {
+		tenant = DEFAULT_TENANT
+	}
+	result := s.with(db.Scope(s.db, tenantCondition(tenant)))
+	result.tenant = tenant
+	return result
+}
+
+// TenantOf returns the tenant owning the record
+func TenantOf(record Record) string {
+	if record.Tenant == "" {
+		return DEFAULT_TENANT
+	}
+	return record.Tenant
+}
+
+// tenantCondition selects the documents of the tenant. The documents without the tenant field belong to the default one
+func tenantCondition(tenant string) bson.M {
+	if tenant == DEFAULT_TENANT {
+		return bson.M{TENANT_FIELD: bson.M{"$in": bson.A{DEFAULT_TENANT, nil}}}
+	}
+	return bson.M{TENANT_FIELD: tenant}
+}
+
+// owned adds setting the tenant of the created record to the update. The service without a tenant creates
+// the records of the default one
+func (s *Service) owned(update bson.M) bson.M {
+	tenant := s.tenant
+	if tenant == "" {
+		tenant = DEFAULT_TENANT
+	}
+	update["$setOnInsert"] = bson.M{TENANT_FIELD: tenant}
+	return update
+}
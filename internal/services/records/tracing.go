@@ -0,0 +1,17 @@
+package records
+
+import (
+	"context"
+
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const TENANT_ATTRIBUTE = "records.tenant"
+
+// span starts the span of the method named as records.Service.Insert, so it is not confused with the span of the
+// command to the collection of records. The queries get the returned context to be children of the span
+func (s *Service) span(ctx context.Context, method string) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "records.Service."+method, attribute.String(TENANT_ATTRIBUTE, s.tenant))
+}
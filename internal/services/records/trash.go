@@ -0,0 +1,94 @@
+package records
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// PURGE_BATCH_SIZE is how many expired records are read at once by the purge
+	PURGE_BATCH_SIZE = 1000
+)
+
+// live adds the condition excluding the records in the trash to the filter
+func live(filter bson.M) bson.M {
+	filter[DELETED_AT_FIELD] = bson.M{"$exists": false}
+	return filter
+}
+
+// trashed adds the condition selecting only the records in the trash to the filter
+func trashed(filter bson.M) bson.M {
+	filter[DELETED_AT_FIELD] = bson.M{"$exists": true}
+	return filter
+}
+
+// trash is the update moving the record to the trash. It is a write as any other, so caches see it as a change
+func trash() bson.M {
+	return bson.M{"$currentDate": bson.M{DELETED_AT_FIELD: true}}
+}
+
+// FindTrash returns one page of the records in the trash, the same query as for Find
+func (s *Service) FindTrash(ctx context.Context, q Query) (Page, error) {
+	ctx, span := s.span(ctx, "FindTrash")
+	defer span.End()
+
+	return s.find(ctx, trashed(q.filter()), q)
+}
+
+// Restore takes the record out of the trash. Returns db.ErrNotFound if there is no such record in the trash
+func (s *Service) Restore(ctx context.Context, id primitive.ObjectID) (*Record, error) {
+	ctx, span := s.span(ctx, "Restore")
+	defer span.End()
+
+	before, after, err := s.modify(ctx, id, nil, trashed, bson.M{"$unset": bson.M{DELETED_AT_FIELD: ""}})
+	if err != nil {
+		return nil, err
+	}
+	s.remember(ctx, s.historyEntry(HISTORY_RESTORE, before, after))
+	return after, nil
+}
+
+// Purge permanently removes the records moved to the trash before the moment, returns how many have been removed.
+// The records restored meanwhile are kept, every delete checks the moment again. The history of the records is kept
+func (s *Service) Purge(ctx context.Context, before time.Time) (int, error) {
+	ctx, span := s.span(ctx, "Purge")
+	defer span.End()
+
+	purged := make([]primitive.ObjectID, 0)
+	defer func() {
+		if len(purged) != 0 {
+			s.bury(ctx, purged...)
+		}
+	}()
+
+	for {
+		var expired []Record = make([]Record, 0)
+		filter := bson.M{DELETED_AT_FIELD: bson.M{"$lt": before}}
+		opts := db.FindOptions{Sort: bson.D{{Key: DELETED_AT_FIELD, Value: 1}}, Limit: PURGE_BATCH_SIZE}
+		err := s.db.Find(ctx, s.dbName, RECORDS_COLLECTION_NAME, filter, opts, &expired)
+		if err != nil {
+			return len(purged), fmt.Errorf("unable to find expired records. Error: %v", err)
+		}
+
+		for _, record := range expired {
+			err = s.db.DeleteOne(ctx, s.dbName, RECORDS_COLLECTION_NAME, bson.M{"_id": record.Id, DELETED_AT_FIELD: bson.M{"$lt": before}})
+			if errors.Is(err, db.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return len(purged), fmt.Errorf("unable to purge record '%v'. Error: %v", record.Id.Hex(), err)
+			}
+			purged = append(purged, record.Id)
+		}
+
+		if len(expired) < PURGE_BATCH_SIZE {
+			return len(purged), nil
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package tracing
+
+import (
+	"github.com/ArtemVoronov/artforintrovert-test/internal/utils"
+)
+
+const (
+	EXPORTER_NONE   = "none"
+	EXPORTER_STDOUT = "stdout"
+	EXPORTER_OTLP   = "otlp"
+)
+
+type Config struct {
+	// Exporter is where the spans are sent: none disables the tracing, stdout prints them, otlp sends them to a collector
+	Exporter string
+	// ServiceName is the service.name resource attribute of the spans
+	ServiceName string
+	// OTLPEndpoint is the host and port of the OTLP/HTTP receiver
+	OTLPEndpoint string
+	// OTLPInsecure sends the spans over plain HTTP instead of HTTPS
+	OTLPInsecure bool
+	// SamplePercent is the share of the traces started here which are recorded, the sampling decision of the caller wins
+	SamplePercent int
+}
+
+func LoadConfig() Config {
+	return Config{
+		Exporter:      utils.EnvVarDefault("TRACING_EXPORTER", EXPORTER_NONE),
+		ServiceName:   utils.EnvVarDefault("TRACING_SERVICE_NAME", "records"),
+		OTLPEndpoint:  utils.EnvVarDefault("TRACING_OTLP_ENDPOINT", "localhost:4318"),
+		OTLPInsecure:  utils.EnvVarDefault("TRACING_OTLP_INSECURE", "false") == "true",
+		SamplePercent: utils.EnvVarIntDefault("TRACING_SAMPLE_PERCENT", "100"),
+	}
+}
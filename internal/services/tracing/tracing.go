@@ -0,0 +1,121 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TRACER_NAME is the instrumentation name of the spans started by the services of the app
+const TRACER_NAME = "github.com/ArtemVoronov/artforintrovert-test"
+
+const SHUTDOWN_TIMEOUT = 5 * time.Second
+
+// Service owns the tracer provider. It is installed as the global one, so the spans of the mongo command monitor
+// and of the records service are exported by it as well
+type Service struct {
+	serviceName string
+	// provider is nil when the tracing is disabled
+	provider *sdktrace.TracerProvider
+	log      *logrus.Entry
+}
+
+func CreateService(logger *logrus.Entry, config Config) (*Service, error) {
+	if config.SamplePercent < 0 || config.SamplePercent > 100 {
+		return nil, fmt.Errorf("unable to setup tracing: sample percent %v is out of 0..100", config.SamplePercent)
+	}
+	exporter, err := createExporter(config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to setup tracing: %v", err)
+	}
+	return WithExporter(logger, config, exporter), nil
+}
+
+// WithExporter returns the service sending the spans to the exporter, nil exporter disables the tracing
+func WithExporter(logger *logrus.Entry, config Config, exporter sdktrace.SpanExporter) *Service {
+	if exporter == nil {
+		return &Service{serviceName: config.ServiceName, log: logger}
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(float64(config.SamplePercent)/100))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(config.ServiceName))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	// the failed exports are not returned to anyone, e.g. the ones to an unreachable collector
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		logger.WithError(err).Warn("tracing failure")
+	}))
+	return &Service{serviceName: config.ServiceName, provider: provider, log: logger}
+}
+
+func createExporter(config Config) (sdktrace.SpanExporter, error) {
+	switch config.Exporter {
+	case EXPORTER_NONE:
+		return nil, nil
+	case EXPORTER_STDOUT:
+		return stdouttrace.New()
+	case EXPORTER_OTLP:
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(config.OTLPEndpoint)}
+		if config.OTLPInsecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		// the client connects lazily, an unreachable collector does not prevent the start
+		return otlptracehttp.New(context.Background(), opts...)
+	}
+	return nil, fmt.Errorf("unknown exporter: %v", config.Exporter)
+}
+
+// Enabled tells whether the spans are exported
+func (s *Service) Enabled() bool {
+	return s.provider != nil
+}
+
+// Middleware starts the server span of the request named by its route. The span is in the context of the request,
+// so the handlers pass it on to the services. The trace of the caller is continued if the request carries it
+func (s *Service) Middleware() gin.HandlerFunc {
+	return otelgin.Middleware(s.serviceName, otelgin.WithTracerProvider(s.provider))
+}
+
+// Flush exports the ended spans without waiting for the batch to fill
+func (s *Service) Flush() error {
+	if s.provider == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), SHUTDOWN_TIMEOUT)
+	defer cancel()
+	return s.provider.ForceFlush(ctx)
+}
+
+// ShutDown exports the pending spans and stops the exporter
+func (s *Service) ShutDown() {
+	if s.provider == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), SHUTDOWN_TIMEOUT)
+	defer cancel()
+	err := s.provider.Shutdown(ctx)
+	if err != nil {
+		s.log.WithError(err).Error("unable to export pending spans")
+	}
+}
+
+// Start starts the span as a child of the span of the context by the global tracer provider, which does nothing
+// while the tracing is disabled
+func Start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(TRACER_NAME).Start(ctx, name, trace.WithAttributes(attributes...))
+}
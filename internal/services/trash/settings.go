@@ -0,0 +1,31 @@
+package trash
+
+import (
+	"time"
+
+	"github.com/ArtemVoronov/artforintrovert-test/internal/utils"
+)
+
+type Config struct {
+	// Retention is how long deleted records stay in the trash before the purge
+	Retention time.Duration
+	// PurgeInterval is how often the purge runs
+	PurgeInterval time.Duration
+}
+
+func LoadConfig() Config {
+	return Config{
+		Retention:     retention(),
+		PurgeInterval: purgeInterval(),
+	}
+}
+
+func retention() time.Duration {
+	value := utils.EnvVarIntDefault("TRASH_RETENTION_IN_SECONDS", "2592000")
+	return time.Duration(value) * time.Second
+}
+
+func purgeInterval() time.Duration {
+	value := utils.EnvVarIntDefault("TRASH_PURGE_INTERVAL_IN_SECONDS", "3600")
+	return time.Duration(value) * time.Second
+}
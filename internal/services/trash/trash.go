@@ -0,0 +1,66 @@
+package trash
+
+import (
+	"context"
+	"time"
+
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/records"
+	"github.com/sirupsen/logrus"
+)
+
+// Service purges the records which have stayed in the trash longer than the retention period. Every instance
+// of the application runs its own purge, purging the same records twice is harmless
+type Service struct {
+	records       records.RecordsService
+	quit          chan struct{}
+	retention     time.Duration
+	purgeInterval time.Duration
+	log           *logrus.Entry
+}
+
+func CreateService(recordsService records.RecordsService, logger *logrus.Entry, config Config) *Service {
+	return &Service{
+		records:       recordsService,
+		log:           logger,
+		quit:          make(chan struct{}),
+		retention:     config.Retention,
+		purgeInterval: config.PurgeInterval,
+	}
+}
+
+// Start runs the purge right away and then every purge interval. ShutDown cancels the running purge
+func (s *Service) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-s.quit
+		cancel()
+	}()
+
+	go func() {
+		for {
+			err := s.Purge(ctx)
+			if err != nil {
+				s.log.WithError(err).Error("purge trash error")
+			}
+			select {
+			case <-s.quit:
+				s.log.Info("purge trash stopped")
+				return
+			case <-time.After(s.purgeInterval):
+			}
+		}
+	}()
+}
+
+func (s *Service) ShutDown() {
+	close(s.quit)
+}
+
+// Purge removes the records moved to the trash earlier than the retention period ago
+func (s *Service) Purge(ctx context.Context) error {
+	purged, err := s.records.Purge(ctx, time.Now().Add(-s.retention))
+	if purged != 0 {
+		s.log.WithField("purged", purged).Info("purged records from the trash")
+	}
+	return err
+}
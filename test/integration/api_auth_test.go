@@ -0,0 +1,297 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ArtemVoronov/artforintrovert-test/internal/api"
+	recordsApiV2 "github.com/ArtemVoronov/artforintrovert-test/internal/api/rest/v2/records"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/auth"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	TEST_API_KEY    = "test-api-key"
+	TEST_JWT_SECRET = "test-jwt-secret"
+)
+
+func HashApiKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+func WriteTempFile(t *testing.T, name string, content []byte) string {
+	file := path.Join(t.TempDir(), name)
+	err := os.WriteFile(file, content, 0600)
+	assert.Nil(t, err)
+	return file
+}
+
+func SetupAuthRouter(t *testing.T, config auth.Config) *gin.Engine {
+	authService, err := auth.CreateService(config)
+	assert.Nil(t, err)
+
+	r := gin.New()
+	recordsHandlerV2 := recordsApiV2.CreateHandler(recordsService, cacheService)
+	group := r.Group("/v2", authService.Middleware())
+	group.GET("/records/", authService.Require(auth.ROLE_READER), recordsHandlerV2.GetRecords)
+	group.POST("/records/", authService.Require(auth.ROLE_WRITER), recordsHandlerV2.CreateRecord)
+	group.GET("/records/:id/history", authService.Require(auth.ROLE_READER), recordsHandlerV2.GetHistory)
+	group.GET("/records/trash", authService.Require(auth.ROLE_ADMIN), recordsHandlerV2.GetTrash)
+	return r
+}
+
+func DoAuthRequest(r *gin.Engine, method string, url string, body string, headers map[string]string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+type TestClaims struct {
+	jwt.RegisteredClaims
+	Roles []string `json:"roles,omitempty"`
+}
+
+func SignToken(t *testing.T, method jwt.SigningMethod, key interface{}, kid string, claims jwt.Claims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	assert.Nil(t, err)
+	return signed
+}
+
+func Bearer(token string) map[string]string {
+	return map[string]string{"Authorization": "Bearer " + token}
+}
+
+func ValidClaims(subject string, roles ...string) TestClaims {
+	return TestClaims{RegisteredClaims: jwt.RegisteredClaims{Subject: subject, ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}, Roles: roles}
+}
+
+func TestApiAuth(t *testing.T) {
+	t.Run("Disabled", RunWithRecreateDB(func(t *testing.T) {
+		r := SetupAuthRouter(t, auth.Config{})
+
+		w := DoAuthRequest(r, http.MethodGet, "/v2/records/", "", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}))
+	t.Run("MissedCredentials", RunWithRecreateDB(func(t *testing.T) {
+		r := SetupAuthRouter(t, auth.Config{Methods: []string{auth.METHOD_API_KEY}, APIKeys: []string{"ci:" + HashApiKey(TEST_API_KEY)}, APIKeyRoles: []string{"ci:writer"}})
+
+		w := DoAuthRequest(r, http.MethodGet, "/v2/records/", "", nil)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, "\""+api.ERROR_MISSED_CREDENTIALS+"\"", w.Body.String())
+		assert.Equal(t, "Bearer", w.Header().Get("WWW-Authenticate"))
+	}))
+	t.Run("ApiKey", RunWithRecreateDB(func(t *testing.T) {
+		r := SetupAuthRouter(t, auth.Config{Methods: []string{auth.METHOD_API_KEY}, APIKeys: []string{"ci:" + HashApiKey(TEST_API_KEY)}, APIKeyRoles: []string{"ci:writer"}})
+
+		w := DoAuthRequest(r, http.MethodPost, "/v2/records/", "{\"data\": \"exponent\"}", map[string]string{auth.API_KEY_HEADER: TEST_API_KEY})
+		assert.Equal(t, http.StatusCreated, w.Code)
+		created, err := ToRecord(w.Body.String())
+		assert.Nil(t, err)
+
+		w = DoAuthRequest(r, http.MethodGet, "/v2/records/"+created.Id.Hex()+"/history", "", map[string]string{auth.API_KEY_HEADER: TEST_API_KEY})
+		assert.Equal(t, http.StatusOK, w.Code)
+		history := ParseHistory(t, w.Body.String())
+		assert.Equal(t, 1, len(history))
+		assert.Equal(t, "ci", history[0].Actor)
+
+		w = DoAuthRequest(r, http.MethodGet, "/v2/records/", "", map[string]string{auth.API_KEY_HEADER: "wrong"})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, "\""+api.ERROR_INVALID_CREDENTIALS+"\"", w.Body.String())
+	}))
+	t.Run("HS256", RunWithRecreateDB(func(t *testing.T) {
+		keyFile := WriteTempFile(t, "secret", []byte(TEST_JWT_SECRET+"\n"))
+		r := SetupAuthRouter(t, auth.Config{Methods: []string{auth.METHOD_JWT}, JWTAlgorithm: auth.ALGORITHM_HS256, JWTKeyFile: keyFile})
+
+		token := SignToken(t, jwt.SigningMethodHS256, []byte(TEST_JWT_SECRET), "", ValidClaims("alice", auth.ROLE_READER))
+		w := DoAuthRequest(r, http.MethodGet, "/v2/records/", "", Bearer(token))
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		token = SignToken(t, jwt.SigningMethodHS256, []byte("other-secret"), "", ValidClaims("alice", auth.ROLE_READER))
+		w = DoAuthRequest(r, http.MethodGet, "/v2/records/", "", Bearer(token))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		expired := ValidClaims("alice", auth.ROLE_READER)
+		expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+		token = SignToken(t, jwt.SigningMethodHS256, []byte(TEST_JWT_SECRET), "", expired)
+		w = DoAuthRequest(r, http.MethodGet, "/v2/records/", "", Bearer(token))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, "\""+api.ERROR_INVALID_CREDENTIALS+"\"", w.Body.String())
+	}))
+	t.Run("RS256KeyFile", RunWithRecreateDB(func(t *testing.T) {
+		private, err := rsa.GenerateKey(rand.Reader, 2048)
+		assert.Nil(t, err)
+		public, err := x509.MarshalPKIXPublicKey(&private.PublicKey)
+		assert.Nil(t, err)
+		keyFile := WriteTempFile(t, "public.pem", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public}))
+		r := SetupAuthRouter(t, auth.Config{Methods: []string{auth.METHOD_JWT}, JWTAlgorithm: auth.ALGORITHM_RS256, JWTKeyFile: keyFile, JWTIssuer: "issuer"})
+
+		claims := ValidClaims("alice", auth.ROLE_READER)
+		claims.Issuer = "issuer"
+		w := DoAuthRequest(r, http.MethodGet, "/v2/records/", "", Bearer(SignToken(t, jwt.SigningMethodRS256, private, "", claims)))
+		assert.Equal(t, http.StatusOK, w.Code)
+		// the key file has no kid, so the kid of the token does not matter
+		w = DoAuthRequest(r, http.MethodGet, "/v2/records/", "", Bearer(SignToken(t, jwt.SigningMethodRS256, private, "key-1", claims)))
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		claims.Issuer = "other"
+		w = DoAuthRequest(r, http.MethodGet, "/v2/records/", "", Bearer(SignToken(t, jwt.SigningMethodRS256, private, "", claims)))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		// the token signed with the HS256 and the public key as the secret must not pass
+		w = DoAuthRequest(r, http.MethodGet, "/v2/records/", "", Bearer(SignToken(t, jwt.SigningMethodHS256, public, "", ValidClaims("alice", auth.ROLE_READER))))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}))
+	t.Run("RS256JWKS", RunWithRecreateDB(func(t *testing.T) {
+		private, err := rsa.GenerateKey(rand.Reader, 2048)
+		assert.Nil(t, err)
+		n := base64.RawURLEncoding.EncodeToString(private.N.Bytes())
+		e := base64.RawURLEncoding.EncodeToString(big.NewInt(int64(private.E)).Bytes())
+		jwksFile := WriteTempFile(t, "jwks.json", []byte("{\"keys\": [{\"kty\": \"RSA\", \"kid\": \"key-1\", \"alg\": \"RS256\", \"n\": \""+n+"\", \"e\": \""+e+"\"}]}"))
+		r := SetupAuthRouter(t, auth.Config{Methods: []string{auth.METHOD_JWT}, JWTAlgorithm: auth.ALGORITHM_RS256, JWTJWKSFile: jwksFile})
+
+		w := DoAuthRequest(r, http.MethodGet, "/v2/records/", "", Bearer(SignToken(t, jwt.SigningMethodRS256, private, "key-1", ValidClaims("alice", auth.ROLE_READER))))
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		w = DoAuthRequest(r, http.MethodGet, "/v2/records/", "", Bearer(SignToken(t, jwt.SigningMethodRS256, private, "key-2", ValidClaims("alice", auth.ROLE_READER))))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}))
+	t.Run("MethodsInOrder", RunWithRecreateDB(func(t *testing.T) {
+		keyFile := WriteTempFile(t, "secret", []byte(TEST_JWT_SECRET))
+		r := SetupAuthRouter(t, auth.Config{
+			Methods:      []string{auth.METHOD_API_KEY, auth.METHOD_JWT},
+			APIKeys:      []string{"ci:" + HashApiKey(TEST_API_KEY)},
+			APIKeyRoles:  []string{"ci:reader"},
+			JWTAlgorithm: auth.ALGORITHM_HS256,
+			JWTKeyFile:   keyFile,
+		})
+
+		w := DoAuthRequest(r, http.MethodGet, "/v2/records/", "", map[string]string{auth.API_KEY_HEADER: TEST_API_KEY})
+		assert.Equal(t, http.StatusOK, w.Code)
+		w = DoAuthRequest(r, http.MethodGet, "/v2/records/", "", Bearer(SignToken(t, jwt.SigningMethodHS256, []byte(TEST_JWT_SECRET), "", ValidClaims("alice", auth.ROLE_READER))))
+		assert.Equal(t, http.StatusOK, w.Code)
+	}))
+	t.Run("InvalidConfig", func(t *testing.T) {
+		_, err := auth.CreateService(auth.Config{Methods: []string{"password"}})
+		assert.NotNil(t, err)
+		_, err = auth.CreateService(auth.Config{Methods: []string{auth.METHOD_API_KEY}, APIKeys: []string{"ci:not-a-hash"}})
+		assert.NotNil(t, err)
+		_, err = auth.CreateService(auth.Config{Methods: []string{auth.METHOD_JWT}, JWTAlgorithm: auth.ALGORITHM_HS256})
+		assert.NotNil(t, err)
+	})
+}
+
+func TestApiAuthorization(t *testing.T) {
+	config := auth.Config{
+		Methods:      []string{auth.METHOD_API_KEY},
+		APIKeys:      []string{"viewer:" + HashApiKey("viewer-key"), "editor:" + HashApiKey("editor-key"), "root:" + HashApiKey("root-key"), "nobody:" + HashApiKey("nobody-key")},
+		APIKeyRoles:  []string{"viewer:reader", "editor:writer", "root:admin"},
+		JWTAlgorithm: auth.ALGORITHM_HS256,
+	}
+	key := func(key string) map[string]string {
+		return map[string]string{auth.API_KEY_HEADER: key}
+	}
+
+	t.Run("Reader", RunWithRecreateDB(func(t *testing.T) {
+		r := SetupAuthRouter(t, config)
+
+		w := DoAuthRequest(r, http.MethodGet, "/v2/records/", "", key("viewer-key"))
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		w = DoAuthRequest(r, http.MethodPost, "/v2/records/", "{\"data\": \"exponent\"}", key("viewer-key"))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Equal(t, "{\"errors\":[{\"Field\":\"role\",\"Msg\":\""+fmt.Sprintf(api.ERROR_FORBIDDEN, auth.ROLE_WRITER)+"\"}]}", w.Body.String())
+		page := ParsePage(t, testHttpClient.Do(http.MethodGet, "/v2/records/", "").Body.String())
+		assert.Equal(t, 0, len(page.Records))
+	}))
+	t.Run("Writer", RunWithRecreateDB(func(t *testing.T) {
+		r := SetupAuthRouter(t, config)
+
+		w := DoAuthRequest(r, http.MethodPost, "/v2/records/", "{\"data\": \"exponent\"}", key("editor-key"))
+		assert.Equal(t, http.StatusCreated, w.Code)
+		w = DoAuthRequest(r, http.MethodGet, "/v2/records/", "", key("editor-key"))
+		assert.Equal(t, http.StatusOK, w.Code)
+		w = DoAuthRequest(r, http.MethodGet, "/v2/records/trash", "", key("editor-key"))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	}))
+	t.Run("Admin", RunWithRecreateDB(func(t *testing.T) {
+		r := SetupAuthRouter(t, config)
+
+		w := DoAuthRequest(r, http.MethodPost, "/v2/records/", "{\"data\": \"exponent\"}", key("root-key"))
+		assert.Equal(t, http.StatusCreated, w.Code)
+		w = DoAuthRequest(r, http.MethodGet, "/v2/records/trash", "", key("root-key"))
+		assert.Equal(t, http.StatusOK, w.Code)
+	}))
+	t.Run("WithoutRoles", RunWithRecreateDB(func(t *testing.T) {
+		r := SetupAuthRouter(t, config)
+
+		w := DoAuthRequest(r, http.MethodGet, "/v2/records/", "", key("nobody-key"))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	}))
+	t.Run("DefaultRole", RunWithRecreateDB(func(t *testing.T) {
+		withDefault := config
+		withDefault.DefaultRole = auth.ROLE_READER
+		r := SetupAuthRouter(t, withDefault)
+
+		w := DoAuthRequest(r, http.MethodGet, "/v2/records/", "", key("nobody-key"))
+		assert.Equal(t, http.StatusOK, w.Code)
+		w = DoAuthRequest(r, http.MethodPost, "/v2/records/", "{\"data\": \"exponent\"}", key("nobody-key"))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	}))
+	t.Run("JWTRoleMapping", RunWithRecreateDB(func(t *testing.T) {
+		keyFile := WriteTempFile(t, "secret", []byte(TEST_JWT_SECRET))
+		r := SetupAuthRouter(t, auth.Config{
+			Methods:        []string{auth.METHOD_JWT},
+			JWTAlgorithm:   auth.ALGORITHM_HS256,
+			JWTKeyFile:     keyFile,
+			JWTRoleMapping: []string{"records-editors:writer"},
+		})
+
+		token := SignToken(t, jwt.SigningMethodHS256, []byte(TEST_JWT_SECRET), "", ValidClaims("alice", "records-editors"))
+		w := DoAuthRequest(r, http.MethodPost, "/v2/records/", "{\"data\": \"exponent\"}", Bearer(token))
+		assert.Equal(t, http.StatusCreated, w.Code)
+
+		// the role names are not taken as they are with the mapping
+		token = SignToken(t, jwt.SigningMethodHS256, []byte(TEST_JWT_SECRET), "", ValidClaims("bob", auth.ROLE_ADMIN))
+		w = DoAuthRequest(r, http.MethodGet, "/v2/records/", "", Bearer(token))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	}))
+	t.Run("InvalidConfig", func(t *testing.T) {
+		invalid := config
+		invalid.APIKeyRoles = []string{"viewer:owner"}
+		_, err := auth.CreateService(invalid)
+		assert.NotNil(t, err)
+
+		invalid = config
+		invalid.DefaultRole = "owner"
+		_, err = auth.CreateService(invalid)
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,76 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	COMPRESSION_RECORDS_COUNT = 50
+)
+
+func Decompress(t *testing.T, encoding string, body []byte) string {
+	var reader io.Reader
+	var err error
+	switch encoding {
+	case "gzip":
+		reader, err = gzip.NewReader(bytes.NewReader(body))
+	case "deflate":
+		reader, err = zlib.NewReader(bytes.NewReader(body))
+	case "zstd":
+		var decoder *zstd.Decoder
+		decoder, err = zstd.NewReader(bytes.NewReader(body))
+		if err == nil {
+			defer decoder.Close()
+			reader = decoder
+		}
+	default:
+		return string(body)
+	}
+	assert.Nil(t, err)
+	result, err := io.ReadAll(reader)
+	assert.Nil(t, err)
+	return string(result)
+}
+
+func TestApiCompression(t *testing.T) {
+	t.Run("RecordsSnapshot", RunWithRecreateDB(func(t *testing.T) {
+		CreateRecordsV2(t, COMPRESSION_RECORDS_COUNT)
+		plain := testHttpClient.Do(http.MethodGet, "/records/", "")
+		assert.Equal(t, "", plain.Header().Get("Content-Encoding"))
+		assert.Equal(t, "Accept-Encoding", plain.Header().Get("Vary"))
+
+		for _, encoding := range []string{"gzip", "deflate", "zstd"} {
+			w := testHttpClient.DoWithHeaders(http.MethodGet, "/records/", "", map[string]string{"Accept-Encoding": encoding})
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, encoding, w.Header().Get("Content-Encoding"))
+			assert.Equal(t, plain.Header().Get("ETag"), w.Header().Get("ETag"))
+			assert.Equal(t, plain.Body.String(), Decompress(t, encoding, w.Body.Bytes()))
+		}
+	}))
+	t.Run("Page", RunWithRecreateDB(func(t *testing.T) {
+		CreateRecordsV2(t, COMPRESSION_RECORDS_COUNT)
+		plain := testHttpClient.Do(http.MethodGet, "/v2/records/", "")
+
+		w := testHttpClient.DoWithHeaders(http.MethodGet, "/v2/records/", "", map[string]string{"Accept-Encoding": "gzip;q=0.5, zstd;q=0, deflate"})
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "deflate", w.Header().Get("Content-Encoding"))
+		assert.Equal(t, plain.Body.String(), Decompress(t, "deflate", w.Body.Bytes()))
+	}))
+	t.Run("SmallResponse", RunWithRecreateDB(func(t *testing.T) {
+		w := testHttpClient.DoWithHeaders(http.MethodGet, "/records/", "", map[string]string{"Accept-Encoding": "gzip"})
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "", w.Header().Get("Content-Encoding"))
+		assert.Equal(t, "[]", w.Body.String())
+	}))
+}
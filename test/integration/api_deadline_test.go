@@ -0,0 +1,172 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ArtemVoronov/artforintrovert-test/internal/api"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/api/deadline"
+	recordsApiV2 "github.com/ArtemVoronov/artforintrovert-test/internal/api/rest/v2/records"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/logging"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/db"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/records"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// SlowDB is the db service whose writes last until their contexts are done
+type SlowDB struct {
+	db.MongoService
+	err chan error
+}
+
+func (s *SlowDB) FindOneAndUpdate(ctx context.Context, dbName string, collectionName string, filter interface{}, update interface{}, upsert bool, result interface{}) error {
+	<-ctx.Done()
+	s.err <- ctx.Err()
+	return ctx.Err()
+}
+
+// HangUpDB is the db service whose callers go away right after their writes
+type HangUpDB struct {
+	db.MongoService
+	cancel context.CancelFunc
+}
+
+func (s *HangUpDB) FindOneAndUpdate(ctx context.Context, dbName string, collectionName string, filter interface{}, update interface{}, upsert bool, result interface{}) error {
+	err := s.MongoService.FindOneAndUpdate(ctx, dbName, collectionName, filter, update, upsert, result)
+	s.cancel()
+	return err
+}
+
+// LateTxDB is the db service whose transactions let the first writes through and make the rest last until their contexts are done
+type LateTxDB struct {
+	db.MongoService
+	passed int
+}
+
+func (s *LateTxDB) Tx(ctx context.Context, f db.QueryFuncVoid) func() error {
+	return s.MongoService.Tx(ctx, func(tx db.MongoService) error {
+		return f(&LateDB{tx, s.passed})
+	})
+}
+
+type LateDB struct {
+	db.MongoService
+	passed int
+}
+
+func (s *LateDB) FindOneAndUpdate(ctx context.Context, dbName string, collectionName string, filter interface{}, update interface{}, upsert bool, result interface{}) error {
+	if s.passed > 0 {
+		s.passed--
+		return s.MongoService.FindOneAndUpdate(ctx, dbName, collectionName, filter, update, upsert, result)
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func SetupDeadlineRouter(dbService db.MongoService, max time.Duration) *gin.Engine {
+	recordsHandlerV2 := recordsApiV2.CreateHandler(records.CreateService(dbService, logging.Default("records"), records.Config{DBName: db.DBName(), BulkMaxSize: BULK_RECORDS_COUNT}), cacheService)
+
+	r := gin.New()
+	r.Use(deadline.Middleware(max))
+	r.POST("/v2/records/", recordsHandlerV2.CreateRecord)
+	r.POST("/v2/records/batch", recordsHandlerV2.BatchRecords)
+	return r
+}
+
+func TestApiDeadline(t *testing.T) {
+	t.Run("RequestTimeout", func(t *testing.T) {
+		slow := &SlowDB{dbService, make(chan error, 1)}
+		r := SetupDeadlineRouter(slow, time.Minute)
+
+		started := time.Now()
+		w := DoAuthRequest(r, http.MethodPost, "/v2/records/", "{\"data\": \"exponent\"}", map[string]string{deadline.TIMEOUT_HEADER: "50"})
+
+		assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+		assert.Equal(t, "\""+api.ERROR_REQUEST_TIMEOUT+"\"", w.Body.String())
+		assert.Less(t, time.Since(started), 10*time.Second)
+		assert.ErrorIs(t, <-slow.err, context.DeadlineExceeded)
+	})
+	t.Run("CappedByServer", func(t *testing.T) {
+		slow := &SlowDB{dbService, make(chan error, 1)}
+		r := SetupDeadlineRouter(slow, 50*time.Millisecond)
+
+		started := time.Now()
+		w := DoAuthRequest(r, http.MethodPost, "/v2/records/", "{\"data\": \"exponent\"}", map[string]string{deadline.TIMEOUT_HEADER: "3600000"})
+
+		assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+		assert.Less(t, time.Since(started), 10*time.Second)
+		assert.ErrorIs(t, <-slow.err, context.DeadlineExceeded)
+	})
+	t.Run("InvalidTimeout", func(t *testing.T) {
+		r := SetupDeadlineRouter(dbService, time.Minute)
+		for _, value := range []string{"soon", "0", "-100", "1.5"} {
+			w := DoAuthRequest(r, http.MethodPost, "/v2/records/", "{\"data\": \"exponent\"}", map[string]string{deadline.TIMEOUT_HEADER: value})
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Equal(t, "\""+api.ERROR_INVALID_REQUEST_TIMEOUT+"\"", w.Body.String())
+		}
+	})
+	t.Run("ClientGone", func(t *testing.T) {
+		slow := &SlowDB{dbService, make(chan error, 1)}
+		r := SetupDeadlineRouter(slow, time.Minute)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		req, _ := http.NewRequestWithContext(ctx, http.MethodPost, "/v2/records/", strings.NewReader("{\"data\": \"exponent\"}"))
+		w := httptest.NewRecorder()
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			cancel()
+		}()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, deadline.STATUS_CLIENT_CLOSED_REQUEST, w.Code)
+		assert.ErrorIs(t, <-slow.err, context.Canceled)
+	})
+	t.Run("HistoryOutlivesClient", RunWithRecreateDB(func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		service := records.CreateService(&HangUpDB{dbService, cancel}, logging.Default("records"), records.Config{DBName: db.DBName()})
+
+		created, err := service.Insert(ctx, bson.M{"data": "exponent"})
+		assert.Nil(t, err)
+		assert.ErrorIs(t, ctx.Err(), context.Canceled)
+
+		history, err := recordsService.GetHistory(context.Background(), created.Id, 0, records.MAX_PAGE_LIMIT)
+		assert.Nil(t, err)
+		assert.Len(t, history, 1)
+	}))
+	t.Run("ExpiresInsideTx", RunWithRecreateDB(func(t *testing.T) {
+		SkipWithoutTransactions(t)
+		first, err := recordsService.Insert(context.Background(), bson.M{"data": "exponent"})
+		assert.Nil(t, err)
+		second, err := recordsService.Insert(context.Background(), bson.M{"data": "pi"})
+		assert.Nil(t, err)
+		r := SetupDeadlineRouter(&LateTxDB{dbService, 1}, time.Minute)
+
+		body := CreateBatchBody(true,
+			"{\"op\": \"replace\", \"id\": \""+first.Id.Hex()+"\", \"data\": \"e\", \"version\": 1}",
+			"{\"op\": \"replace\", \"id\": \""+second.Id.Hex()+"\", \"data\": \"3.14\", \"version\": 1}")
+		started := time.Now()
+		w := DoAuthRequest(r, http.MethodPost, "/v2/records/batch", body, map[string]string{deadline.TIMEOUT_HEADER: "50", "Content-Type": "application/json"})
+
+		assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+		assert.Less(t, time.Since(started), 10*time.Second)
+		for _, expected := range []*records.Record{first, second} {
+			found, err := recordsService.GetById(context.Background(), expected.Id)
+			assert.Nil(t, err)
+			assert.Equal(t, expected, found)
+		}
+	}))
+	t.Run("WithinDeadline", RunWithRecreateDB(func(t *testing.T) {
+		r := SetupDeadlineRouter(dbService, time.Minute)
+		w := DoAuthRequest(r, http.MethodPost, "/v2/records/", "{\"data\": \"exponent\"}", map[string]string{deadline.TIMEOUT_HEADER: "10000"})
+		assert.Equal(t, http.StatusCreated, w.Code)
+	}))
+}
@@ -0,0 +1,123 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	healthApi "github.com/ArtemVoronov/artforintrovert-test/internal/api/rest/health"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/cache"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/db"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/health"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// UnreachableDB is the db service whose deployment does not answer the pings
+type UnreachableDB struct {
+	db.MongoService
+}
+
+func (s *UnreachableDB) Ping(ctx context.Context) error {
+	return errors.New("server selection timeout")
+}
+
+func SetupHealthRouter(dbService db.MongoService, cacheStats func() cache.Stats) *gin.Engine {
+	healthService := health.CreateService(dbService, cacheStats, health.Config{DBTimeout: time.Second, MaxCacheStaleness: time.Minute})
+	healthHandler := healthApi.CreateHandler(healthService)
+
+	r := gin.New()
+	r.GET("/healthz", healthHandler.Live)
+	r.GET("/readyz", healthHandler.Ready)
+	return r
+}
+
+func ParseHealthReport(t *testing.T, body string) health.Report {
+	var report health.Report
+	err := json.Unmarshal([]byte(body), &report)
+	assert.Nil(t, err)
+	return report
+}
+
+func TestApiHealth(t *testing.T) {
+	synced := func(lastSync time.Time, live bool) func() cache.Stats {
+		return func() cache.Stats {
+			return cache.Stats{LastSync: lastSync, Live: live}
+		}
+	}
+
+	t.Run("Live", func(t *testing.T) {
+		r := SetupHealthRouter(&UnreachableDB{dbService}, synced(time.Time{}, false))
+
+		w := DoAuthRequest(r, http.MethodGet, "/healthz", "", nil)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "{\"status\":\"up\"}", w.Body.String())
+	})
+	t.Run("Ready", RunWithRecreateDB(func(t *testing.T) {
+		r := SetupHealthRouter(dbService, cacheService.Stats)
+
+		w := DoAuthRequest(r, http.MethodGet, "/readyz", "", nil)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		report := ParseHealthReport(t, w.Body.String())
+		assert.Equal(t, health.STATUS_UP, report.Status)
+		assert.Equal(t, health.STATUS_UP, report.Dependencies.Mongo.Status)
+		assert.Equal(t, "", report.Dependencies.Mongo.Error)
+		assert.Equal(t, health.STATUS_UP, report.Dependencies.Cache.Status)
+		assert.True(t, report.Dependencies.Cache.Loaded)
+		assert.NotNil(t, report.Dependencies.Cache.LastSync)
+		assert.Equal(t, float64(60), report.Dependencies.Cache.MaxStalenessSeconds)
+	}))
+	t.Run("MongoDown", func(t *testing.T) {
+		r := SetupHealthRouter(&UnreachableDB{dbService}, synced(time.Now(), false))
+
+		w := DoAuthRequest(r, http.MethodGet, "/readyz", "", nil)
+
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		report := ParseHealthReport(t, w.Body.String())
+		assert.Equal(t, health.STATUS_DOWN, report.Status)
+		assert.Equal(t, health.STATUS_DOWN, report.Dependencies.Mongo.Status)
+		assert.Equal(t, "server selection timeout", report.Dependencies.Mongo.Error)
+		assert.Equal(t, health.STATUS_UP, report.Dependencies.Cache.Status)
+	})
+	t.Run("CacheNeverLoaded", func(t *testing.T) {
+		r := SetupHealthRouter(dbService, synced(time.Time{}, false))
+
+		w := DoAuthRequest(r, http.MethodGet, "/readyz", "", nil)
+
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		report := ParseHealthReport(t, w.Body.String())
+		assert.Equal(t, health.STATUS_DOWN, report.Dependencies.Cache.Status)
+		assert.False(t, report.Dependencies.Cache.Loaded)
+		assert.Nil(t, report.Dependencies.Cache.LastSync)
+	})
+	t.Run("CacheStale", func(t *testing.T) {
+		r := SetupHealthRouter(dbService, synced(time.Now().Add(-time.Hour), false))
+
+		w := DoAuthRequest(r, http.MethodGet, "/readyz", "", nil)
+
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		report := ParseHealthReport(t, w.Body.String())
+		assert.Equal(t, health.STATUS_DOWN, report.Dependencies.Cache.Status)
+		assert.True(t, report.Dependencies.Cache.Loaded)
+		assert.True(t, report.Dependencies.Cache.StalenessSeconds >= 3600)
+	})
+	t.Run("CacheLive", func(t *testing.T) {
+		// the change stream keeps the cache current, the time of its start is not the staleness
+		r := SetupHealthRouter(dbService, synced(time.Now().Add(-time.Hour), true))
+
+		w := DoAuthRequest(r, http.MethodGet, "/readyz", "", nil)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		report := ParseHealthReport(t, w.Body.String())
+		assert.True(t, report.Dependencies.Cache.Live)
+		assert.Equal(t, float64(0), report.Dependencies.Cache.StalenessSeconds)
+	})
+}
@@ -0,0 +1,177 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	recordsApiV2 "github.com/ArtemVoronov/artforintrovert-test/internal/api/rest/v2/records"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/logging"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/auth"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/db"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/records"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// NoHistoryDB is the db service failing the writes of the records history
+type NoHistoryDB struct {
+	db.MongoService
+}
+
+func (s *NoHistoryDB) BulkWrite(ctx context.Context, dbName string, collectionName string, models []mongo.WriteModel, ordered bool) (*db.BulkResult, error) {
+	if collectionName == records.HISTORY_COLLECTION_NAME {
+		return nil, errors.New("history is unavailable")
+	}
+	return s.MongoService.BulkWrite(ctx, dbName, collectionName, models, ordered)
+}
+
+func SetupLoggingRouter(out *bytes.Buffer) *gin.Engine {
+	logger := logrus.New()
+	logger.SetOutput(out)
+	logger.SetFormatter(&logrus.JSONFormatter{})
+
+	r := gin.New()
+	r.Use(logging.Middleware(logger))
+	recordsHandlerV2 := recordsApiV2.CreateHandler(recordsService, cacheService)
+	r.POST("/v2/records/", recordsHandlerV2.CreateRecord)
+	r.GET("/v2/records/:id/history", recordsHandlerV2.GetHistory)
+	r.GET("/failing", func(c *gin.Context) {
+		logging.Of(c).Error("unable to do the thing")
+		c.Status(http.StatusInternalServerError)
+	})
+	return r
+}
+
+func ParseLogLines(t *testing.T, out *bytes.Buffer) []map[string]interface{} {
+	lines := make([]map[string]interface{}, 0)
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var fields map[string]interface{}
+		err := json.Unmarshal([]byte(line), &fields)
+		assert.Nil(t, err)
+		lines = append(lines, fields)
+	}
+	return lines
+}
+
+func TestApiLogging(t *testing.T) {
+	t.Run("GeneratesRequestId", RunWithRecreateDB(func(t *testing.T) {
+		var out bytes.Buffer
+		r := SetupLoggingRouter(&out)
+
+		first := DoAuthRequest(r, http.MethodGet, "/failing", "", nil).Header().Get(logging.REQUEST_ID_HEADER)
+		second := DoAuthRequest(r, http.MethodGet, "/failing", "", nil).Header().Get(logging.REQUEST_ID_HEADER)
+
+		assert.Equal(t, 32, len(first))
+		assert.Equal(t, 32, len(second))
+		assert.NotEqual(t, first, second)
+	}))
+	t.Run("AcceptsRequestId", RunWithRecreateDB(func(t *testing.T) {
+		var out bytes.Buffer
+		r := SetupLoggingRouter(&out)
+
+		w := DoAuthRequest(r, http.MethodGet, "/failing", "", map[string]string{logging.REQUEST_ID_HEADER: "request-1"})
+		assert.Equal(t, "request-1", w.Header().Get(logging.REQUEST_ID_HEADER))
+
+		// the ids with unprintable characters or too long are replaced
+		w = DoAuthRequest(r, http.MethodGet, "/failing", "", map[string]string{logging.REQUEST_ID_HEADER: "request 2"})
+		assert.NotEqual(t, "request 2", w.Header().Get(logging.REQUEST_ID_HEADER))
+		w = DoAuthRequest(r, http.MethodGet, "/failing", "", map[string]string{logging.REQUEST_ID_HEADER: strings.Repeat("a", logging.MAX_REQUEST_ID_LENGTH+1)})
+		assert.Equal(t, 32, len(w.Header().Get(logging.REQUEST_ID_HEADER)))
+	}))
+	t.Run("LinesHaveRequestId", RunWithRecreateDB(func(t *testing.T) {
+		var out bytes.Buffer
+		r := SetupLoggingRouter(&out)
+
+		DoAuthRequest(r, http.MethodGet, "/failing", "", map[string]string{logging.REQUEST_ID_HEADER: "request-1"})
+
+		lines := ParseLogLines(t, &out)
+		assert.Equal(t, 2, len(lines))
+		assert.Equal(t, "unable to do the thing", lines[0]["msg"])
+		assert.Equal(t, "error", lines[0]["level"])
+		assert.Equal(t, "request-1", lines[0][logging.REQUEST_ID_FIELD])
+
+		access := lines[1]
+		assert.Equal(t, "request", access["msg"])
+		assert.Equal(t, "error", access["level"])
+		assert.Equal(t, "request-1", access[logging.REQUEST_ID_FIELD])
+		assert.Equal(t, "api", access[logging.COMPONENT_FIELD])
+		assert.Equal(t, http.MethodGet, access["method"])
+		assert.Equal(t, "/failing", access["route"])
+		assert.Equal(t, float64(http.StatusInternalServerError), access["status"])
+		assert.NotNil(t, access["latency_ms"])
+	}))
+	t.Run("HistoryHasGeneratedRequestId", RunWithRecreateDB(func(t *testing.T) {
+		var out bytes.Buffer
+		r := SetupLoggingRouter(&out)
+
+		w := DoAuthRequest(r, http.MethodPost, "/v2/records/", "{\"data\": \"exponent\"}", nil)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		id := w.Header().Get(logging.REQUEST_ID_HEADER)
+		created, err := ToRecord(w.Body.String())
+		assert.Nil(t, err)
+
+		w = DoAuthRequest(r, http.MethodGet, "/v2/records/"+created.Id.Hex()+"/history", "", nil)
+		history := ParseHistory(t, w.Body.String())
+		assert.Equal(t, 1, len(history))
+		assert.Equal(t, id, history[0].RequestId)
+
+		lines := ParseLogLines(t, &out)
+		assert.Equal(t, "info", lines[0]["level"])
+		assert.Equal(t, id, lines[0][logging.REQUEST_ID_FIELD])
+	}))
+	t.Run("InvalidCredentialsAreWarnings", RunWithRecreateDB(func(t *testing.T) {
+		var out bytes.Buffer
+		r := SetupLoggingRouter(&out)
+		authService, err := auth.CreateService(auth.Config{Methods: []string{auth.METHOD_API_KEY}, APIKeys: []string{"ci:" + HashApiKey(TEST_API_KEY)}, APIKeyRoles: []string{"ci:writer"}})
+		assert.Nil(t, err)
+		r.GET("/protected", authService.Middleware(), func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+
+		w := DoAuthRequest(r, http.MethodGet, "/protected", "", map[string]string{auth.API_KEY_HEADER: "wrong"})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		lines := ParseLogLines(t, &out)
+		assert.Equal(t, 2, len(lines))
+		assert.Equal(t, "request with invalid credentials", lines[0]["msg"])
+		assert.Equal(t, "warning", lines[0]["level"])
+	}))
+	t.Run("ServiceLinesHaveRequestId", RunWithRecreateDB(func(t *testing.T) {
+		var out bytes.Buffer
+		logger := logrus.New()
+		logger.SetOutput(&out)
+		logger.SetFormatter(&logrus.JSONFormatter{})
+		service := records.CreateService(&NoHistoryDB{dbService}, logging.Component(logger, "records"), records.Config{DBName: db.DBName()})
+		r := gin.New()
+		r.Use(logging.Middleware(logger))
+		r.POST("/v2/records/", recordsApiV2.CreateHandler(service, cacheService).CreateRecord)
+
+		w := DoAuthRequest(r, http.MethodPost, "/v2/records/", "{\"data\": \"exponent\"}", map[string]string{logging.REQUEST_ID_HEADER: "request-1"})
+		assert.Equal(t, http.StatusCreated, w.Code)
+
+		lines := ParseLogLines(t, &out)
+		assert.Equal(t, 2, len(lines))
+		assert.Equal(t, "unable to write history of records", lines[0]["msg"])
+		assert.Equal(t, "records", lines[0][logging.COMPONENT_FIELD])
+		assert.Equal(t, "request-1", lines[0][logging.REQUEST_ID_FIELD])
+	}))
+	t.Run("InvalidConfig", func(t *testing.T) {
+		_, err := logging.Create(logging.Config{Level: "verbose", Format: logging.FORMAT_JSON})
+		assert.NotNil(t, err)
+		_, err = logging.Create(logging.Config{Level: "info", Format: "xml"})
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,98 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	recordsApiV2 "github.com/ArtemVoronov/artforintrovert-test/internal/api/rest/v2/records"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/logging"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/cache"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/db"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/metrics"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/records"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func SetupMetricsRouter(metricsService *metrics.Service) *gin.Engine {
+	observed := records.CreateService(db.Observe(dbService, metricsService), logging.Default("records"), records.Config{DBName: db.DBName(), TombstoneTTL: time.Hour, BulkMaxSize: BULK_RECORDS_COUNT})
+
+	r := gin.New()
+	r.Use(metricsService.Middleware())
+	r.GET(metricsService.Path(), metricsService.Handler())
+	recordsHandlerV2 := recordsApiV2.CreateHandler(observed, cacheService)
+	r.GET("/v2/records/:id", recordsHandlerV2.GetRecord)
+	r.POST("/v2/records/", recordsHandlerV2.CreateRecord)
+	r.PATCH("/v2/records/:id", recordsHandlerV2.PatchRecord)
+	return r
+}
+
+func ScrapeMetrics(t *testing.T, r *gin.Engine) string {
+	w := DoAuthRequest(r, http.MethodGet, "/metrics", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	return w.Body.String()
+}
+
+func TestApiMetrics(t *testing.T) {
+	t.Run("Requests", RunWithRecreateDB(func(t *testing.T) {
+		metricsService := metrics.CreateService(metrics.Config{Path: "/metrics"})
+		r := SetupMetricsRouter(metricsService)
+
+		w := DoAuthRequest(r, http.MethodPost, "/v2/records/", "{\"data\": \"exponent\"}", nil)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		created, err := ToRecord(w.Body.String())
+		assert.Nil(t, err)
+		DoAuthRequest(r, http.MethodGet, "/v2/records/"+created.Id.Hex(), "", nil)
+		DoAuthRequest(r, http.MethodGet, "/v2/records/"+created.Id.Hex(), "", nil)
+		DoAuthRequest(r, http.MethodGet, "/unknown/path", "", nil)
+
+		body := ScrapeMetrics(t, r)
+		assert.Contains(t, body, "records_http_requests_total{method=\"POST\",route=\"/v2/records/\",status=\"201\"} 1")
+		assert.Contains(t, body, "records_http_requests_total{method=\"GET\",route=\"/v2/records/:id\",status=\"200\"} 2")
+		assert.Contains(t, body, "records_http_requests_total{method=\"GET\",route=\""+metrics.UNMATCHED_ROUTE+"\",status=\"404\"} 1")
+		assert.Contains(t, body, "records_http_request_duration_seconds_count{method=\"POST\",route=\"/v2/records/\",status=\"201\"} 1")
+	}))
+	t.Run("Queries", RunWithRecreateDB(func(t *testing.T) {
+		metricsService := metrics.CreateService(metrics.Config{Path: "/metrics"})
+		r := SetupMetricsRouter(metricsService)
+
+		w := DoAuthRequest(r, http.MethodPost, "/v2/records/", "{\"data\": \"exponent\"}", nil)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		// the empty patch reads the record, a missing one is not a failure
+		w = DoAuthRequest(r, http.MethodPatch, "/v2/records/62ffcac90074ec24bbb5810e", "{}", nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		body := ScrapeMetrics(t, r)
+		assert.Contains(t, body, "records_mongo_query_duration_seconds_count{collection=\"records\",operation=\"find_one_and_update\"} 1")
+		assert.Contains(t, body, "records_mongo_query_duration_seconds_count{collection=\"records\",operation=\"find_one\"} 1")
+		assert.NotContains(t, body, "records_mongo_query_errors_total{")
+	}))
+	t.Run("Cache", RunWithRecreateDB(func(t *testing.T) {
+		metricsService := metrics.CreateService(metrics.Config{Path: "/metrics"})
+		metricsService.RegisterCache(func() cache.Stats {
+			return cache.Stats{Records: 3, SnapshotBytes: 120, LastSync: time.Unix(1660000000, 0), SyncDelay: 4 * time.Second, SyncFailures: 2}
+		})
+		r := SetupMetricsRouter(metricsService)
+
+		body := ScrapeMetrics(t, r)
+		assert.Contains(t, body, "records_cache_records 3\n")
+		assert.Contains(t, body, "records_cache_snapshot_bytes 120\n")
+		assert.Contains(t, body, "records_cache_last_sync_timestamp_seconds 1.66e+09\n")
+		assert.Contains(t, body, "records_cache_sync_delay_seconds 4\n")
+		assert.Contains(t, body, "records_cache_sync_failures 2\n")
+	}))
+	t.Run("CacheStats", RunWithRecreateDB(func(t *testing.T) {
+		testHttpClient.CreateRecordV2("exponent")
+		testHttpClient.Do(http.MethodGet, "/records/", "")
+
+		stats := cacheService.Stats()
+		assert.Equal(t, 1, stats.Records)
+		assert.True(t, stats.SnapshotBytes > len("[]"))
+		assert.False(t, stats.LastSync.IsZero())
+		assert.Equal(t, 0, stats.SyncFailures)
+	}))
+}
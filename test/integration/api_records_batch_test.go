@@ -0,0 +1,254 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ArtemVoronov/artforintrovert-test/internal/api"
+	recordsApiV2 "github.com/ArtemVoronov/artforintrovert-test/internal/api/rest/v2/records"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/logging"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/db"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/records"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// StandaloneDB imitates a deployment without transactions
+type StandaloneDB struct {
+	db.MongoService
+}
+
+func (StandaloneDB) SupportsTransactions(ctx context.Context) (bool, error) {
+	return false, nil
+}
+
+func (StandaloneDB) Tx(ctx context.Context, f db.QueryFuncVoid) func() error {
+	return func() error {
+		return db.ErrTransactionsUnsupported
+	}
+}
+
+func ToBatchResult(t *testing.T, body string) recordsApiV2.BatchResultDTO {
+	var result recordsApiV2.BatchResultDTO
+	err := json.Unmarshal([]byte(body), &result)
+	assert.Nil(t, err)
+	return result
+}
+
+func SkipWithoutTransactions(t *testing.T) {
+	supported, err := dbService.SupportsTransactions(context.Background())
+	assert.Nil(t, err)
+	if !supported {
+		t.Skip("the database deployment does not support transactions")
+	}
+}
+
+func CreateBatchBody(atomic bool, operations ...string) string {
+	if atomic {
+		return "{\"atomic\": true, \"operations\": [" + strings.Join(operations, ",") + "]}"
+	}
+	return "{\"operations\": [" + strings.Join(operations, ",") + "]}"
+}
+
+func TestApiRecordsBatch(t *testing.T) {
+	t.Run("AtomicCommits", RunWithRecreateDB(func(t *testing.T) {
+		SkipWithoutTransactions(t)
+		first, err := ToRecord(testHttpClient.CreateRecordV2("exponent").Body.String())
+		assert.Nil(t, err)
+		second, err := ToRecord(testHttpClient.CreateRecordV2("pi").Body.String())
+		assert.Nil(t, err)
+
+		body := CreateBatchBody(true,
+			"{\"op\": \"replace\", \"id\": \""+first.Id.Hex()+"\", \"data\": \"e\", \"version\": 1}",
+			"{\"op\": \"delete\", \"id\": \""+second.Id.Hex()+"\"}",
+		)
+		w := testHttpClient.Do(http.MethodPost, "/v2/records/batch", body)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		result := ToBatchResult(t, w.Body.String())
+		assert.False(t, result.RolledBack)
+		assert.Equal(t, records.BATCH_STATUS_REPLACED, result.Results[0].Status)
+		assert.Equal(t, records.BULK_STATUS_DELETED, result.Results[1].Status)
+
+		_, body, err = testHttpClient.GetAllRecords()
+		assert.Nil(t, err)
+		all, err := ToRecords(body)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(all))
+		assert.Equal(t, "e", all[0].Data)
+	}))
+	t.Run("AtomicRollsBack", RunWithRecreateDB(func(t *testing.T) {
+		SkipWithoutTransactions(t)
+		created, err := ToRecord(testHttpClient.CreateRecordV2("exponent").Body.String())
+		assert.Nil(t, err)
+
+		body := CreateBatchBody(true,
+			"{\"op\": \"replace\", \"id\": \""+created.Id.Hex()+"\", \"data\": \"e\"}",
+			"{\"op\": \"delete\", \"id\": \""+NOT_EXISTED_RECORD_ID+"\"}",
+			"{\"op\": \"delete\", \"id\": \""+created.Id.Hex()+"\"}",
+		)
+		w := testHttpClient.Do(http.MethodPost, "/v2/records/batch", body)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		result := ToBatchResult(t, w.Body.String())
+		assert.True(t, result.RolledBack)
+		assert.Equal(t, records.BATCH_STATUS_ROLLED_BACK, result.Results[0].Status)
+		assert.Equal(t, records.BULK_STATUS_FAILED, result.Results[1].Status)
+		assert.NotEmpty(t, result.Results[1].Error)
+		assert.Equal(t, records.BULK_STATUS_SKIPPED, result.Results[2].Status)
+
+		record, err := recordsService.GetById(context.Background(), created.Id)
+		assert.Nil(t, err)
+		assert.Equal(t, "exponent", record.Data)
+		assert.Equal(t, int64(1), record.Version)
+		_, body, err = testHttpClient.GetAllRecords()
+		assert.Nil(t, err)
+		all, err := ToRecords(body)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(all))
+		assert.Equal(t, "exponent", all[0].Data)
+	}))
+	t.Run("AtomicRollsBackOnVersionMismatch", RunWithRecreateDB(func(t *testing.T) {
+		SkipWithoutTransactions(t)
+		first, err := ToRecord(testHttpClient.CreateRecordV2("exponent").Body.String())
+		assert.Nil(t, err)
+		second, err := ToRecord(testHttpClient.CreateRecordV2("pi").Body.String())
+		assert.Nil(t, err)
+
+		body := CreateBatchBody(true,
+			"{\"op\": \"delete\", \"id\": \""+first.Id.Hex()+"\"}",
+			"{\"op\": \"replace\", \"id\": \""+second.Id.Hex()+"\", \"data\": \"e\", \"version\": 7}",
+		)
+		w := testHttpClient.Do(http.MethodPost, "/v2/records/batch", body)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		result := ToBatchResult(t, w.Body.String())
+		assert.Equal(t, records.BATCH_STATUS_ROLLED_BACK, result.Results[0].Status)
+		assert.Equal(t, records.BULK_STATUS_FAILED, result.Results[1].Status)
+		_, err = recordsService.GetById(context.Background(), first.Id)
+		assert.Nil(t, err)
+	}))
+	t.Run("AtomicInvalidOperation", RunWithRecreateDB(func(t *testing.T) {
+		SkipWithoutTransactions(t)
+		created, err := ToRecord(testHttpClient.CreateRecordV2("exponent").Body.String())
+		assert.Nil(t, err)
+
+		body := CreateBatchBody(true,
+			"{\"op\": \"delete\", \"id\": \""+created.Id.Hex()+"\"}",
+			"{\"op\": \"replace\", \"id\": \""+created.Id.Hex()+"\"}",
+		)
+		w := testHttpClient.Do(http.MethodPost, "/v2/records/batch", body)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		result := ToBatchResult(t, w.Body.String())
+		assert.Equal(t, records.BULK_STATUS_SKIPPED, result.Results[0].Status)
+		assert.Equal(t, records.BULK_STATUS_FAILED, result.Results[1].Status)
+		_, err = recordsService.GetById(context.Background(), created.Id)
+		assert.Nil(t, err)
+	}))
+	t.Run("NonAtomicAppliesSucceeded", RunWithRecreateDB(func(t *testing.T) {
+		created, err := ToRecord(testHttpClient.CreateRecordV2("exponent").Body.String())
+		assert.Nil(t, err)
+
+		body := CreateBatchBody(false,
+			"{\"op\": \"replace\", \"id\": \""+created.Id.Hex()+"\", \"data\": \"e\"}",
+			"{\"op\": \"delete\", \"id\": \""+NOT_EXISTED_RECORD_ID+"\"}",
+		)
+		w := testHttpClient.Do(http.MethodPost, "/v2/records/batch", body)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		result := ToBatchResult(t, w.Body.String())
+		assert.False(t, result.RolledBack)
+		assert.Equal(t, records.BATCH_STATUS_REPLACED, result.Results[0].Status)
+		assert.Equal(t, records.BULK_STATUS_FAILED, result.Results[1].Status)
+
+		_, body, err = testHttpClient.GetAllRecords()
+		assert.Nil(t, err)
+		all, err := ToRecords(body)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(all))
+		assert.Equal(t, "e", all[0].Data)
+	}))
+	t.Run("AtomicUnsupported", RunWithRecreateDB(func(t *testing.T) {
+		standaloneRecords := records.CreateService(StandaloneDB{dbService}, logging.Default("records"), records.Config{DBName: db.DBName(), BulkMaxSize: BULK_RECORDS_COUNT})
+		r := gin.New()
+		r.POST("/v2/records/batch", recordsApiV2.CreateHandler(standaloneRecords, cacheService).BatchRecords)
+		created, err := ToRecord(testHttpClient.CreateRecordV2("exponent").Body.String())
+		assert.Nil(t, err)
+
+		w := httptest.NewRecorder()
+		body := CreateBatchBody(true, "{\"op\": \"delete\", \"id\": \""+created.Id.Hex()+"\"}")
+		req, _ := http.NewRequest(http.MethodPost, "/v2/records/batch", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, "\""+api.ERROR_TRANSACTIONS_UNSUPPORTED+"\"", w.Body.String())
+		_, err = recordsService.GetById(context.Background(), created.Id)
+		assert.Nil(t, err)
+	}))
+	t.Run("Empty", RunWithRecreateDB(func(t *testing.T) {
+		w := testHttpClient.Do(http.MethodPost, "/v2/records/batch", CreateBatchBody(true))
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "\""+api.ERROR_BULK_EMPTY+"\"", w.Body.String())
+	}))
+}
+
+func TestTx(t *testing.T) {
+	t.Run("RetriesOnWriteConflict", RunWithRecreateDB(func(t *testing.T) {
+		SkipWithoutTransactions(t)
+		created, err := recordsService.Insert(context.Background(), bson.M{"data": "exponent"})
+		assert.Nil(t, err)
+		filter := bson.M{"_id": created.Id}
+
+		attempts := 0
+		err = dbService.Tx(context.Background(), func(tx db.MongoService) error {
+			attempts++
+			var record records.Record
+			err := tx.FindOne(context.Background(), db.DBName(), records.RECORDS_COLLECTION_NAME, filter, &record)
+			if err != nil {
+				return err
+			}
+			if attempts == 1 {
+				// the concurrent write lands after the transaction has read the record
+				err = dbService.UpdateOne(context.Background(), db.DBName(), records.RECORDS_COLLECTION_NAME, filter, bson.M{"$set": bson.M{"data": "pi"}})
+				if err != nil {
+					return err
+				}
+			}
+			return tx.UpdateOne(context.Background(), db.DBName(), records.RECORDS_COLLECTION_NAME, filter, bson.M{"$set": bson.M{"data": record.Data + "!"}})
+		})()
+
+		assert.Nil(t, err)
+		assert.Equal(t, 2, attempts)
+		record, err := recordsService.GetById(context.Background(), created.Id)
+		assert.Nil(t, err)
+		assert.Equal(t, "pi!", record.Data)
+	}))
+	t.Run("DiscardsWritesOnError", RunWithRecreateDB(func(t *testing.T) {
+		SkipWithoutTransactions(t)
+		id := primitive.NewObjectID()
+
+		err := dbService.Tx(context.Background(), func(tx db.MongoService) error {
+			_, err := tx.Insert(context.Background(), db.DBName(), records.RECORDS_COLLECTION_NAME, bson.M{"_id": id, "data": "exponent"})
+			if err != nil {
+				return err
+			}
+			return db.ErrNotFound
+		})()
+
+		assert.ErrorIs(t, err, db.ErrNotFound)
+		_, err = recordsService.GetById(context.Background(), id)
+		assert.ErrorIs(t, err, db.ErrNotFound)
+	}))
+}
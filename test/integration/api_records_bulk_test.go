@@ -0,0 +1,118 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ArtemVoronov/artforintrovert-test/internal/api"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/records"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	BULK_RECORDS_COUNT = 1000
+)
+
+func ToBulkResults(t *testing.T, body string) []records.BulkOperationResult {
+	var result struct {
+		Results []records.BulkOperationResult `json:"results"`
+	}
+	err := json.Unmarshal([]byte(body), &result)
+	assert.Nil(t, err)
+	return result.Results
+}
+
+func TestApiRecordsBulk(t *testing.T) {
+	t.Run("Create", RunWithRecreateDB(func(t *testing.T) {
+		operations := make([]string, BULK_RECORDS_COUNT)
+		for i := range operations {
+			operations[i] = "{\"op\": \"create\", \"data\": \"data-" + strconv.Itoa(i) + "\"}"
+		}
+
+		w := testHttpClient.Do(http.MethodPost, "/v2/records/bulk", "{\"operations\": ["+strings.Join(operations, ",")+"]}")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		results := ToBulkResults(t, w.Body.String())
+		assert.Equal(t, BULK_RECORDS_COUNT, len(results))
+		for _, result := range results {
+			assert.Equal(t, records.BULK_STATUS_CREATED, result.Status)
+			assert.NotNil(t, result.Id)
+		}
+		_, body, err := testHttpClient.GetAllRecords()
+		assert.Nil(t, err)
+		all, err := ToRecords(body)
+		assert.Nil(t, err)
+		assert.Equal(t, BULK_RECORDS_COUNT, len(all))
+	}))
+	t.Run("Mixed", RunWithRecreateDB(func(t *testing.T) {
+		created, err := ToRecord(testHttpClient.CreateRecordV2("exponent").Body.String())
+		assert.Nil(t, err)
+		id := created.Id.Hex()
+
+		body := "{\"operations\": [" +
+			"{\"op\": \"update\", \"id\": \"" + id + "\", \"data\": \"pi\"}," +
+			"{\"op\": \"update\", \"id\": \"" + NOT_EXISTED_RECORD_ID + "\", \"data\": \"e\"}," +
+			"{\"op\": \"delete\", \"id\": \"" + id + "\"}" +
+			"]}"
+		w := testHttpClient.Do(http.MethodPost, "/v2/records/bulk", body)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		results := ToBulkResults(t, w.Body.String())
+		assert.Equal(t, 3, len(results))
+		assert.Equal(t, records.BULK_STATUS_UPDATED, results[0].Status)
+		assert.Equal(t, records.BULK_STATUS_CREATED, results[1].Status)
+		assert.Equal(t, NOT_EXISTED_RECORD_ID, results[1].Id.Hex())
+		assert.Equal(t, records.BULK_STATUS_DELETED, results[2].Status)
+
+		_, body, err = testHttpClient.GetAllRecords()
+		assert.Nil(t, err)
+		all, err := ToRecords(body)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(all))
+		assert.Equal(t, "e", all[0].Data)
+	}))
+	t.Run("OrderedStopsAtFailure", RunWithRecreateDB(func(t *testing.T) {
+		body := "{\"operations\": [{\"op\": \"create\", \"data\": \"pi\"}, {\"op\": \"rename\"}, {\"op\": \"create\", \"data\": \"e\"}]}"
+		w := testHttpClient.Do(http.MethodPost, "/v2/records/bulk", body)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		results := ToBulkResults(t, w.Body.String())
+		assert.Equal(t, records.BULK_STATUS_CREATED, results[0].Status)
+		assert.Equal(t, records.BULK_STATUS_FAILED, results[1].Status)
+		assert.NotEmpty(t, results[1].Error)
+		assert.Equal(t, records.BULK_STATUS_SKIPPED, results[2].Status)
+	}))
+	t.Run("UnorderedContinuesAfterFailure", RunWithRecreateDB(func(t *testing.T) {
+		body := "{\"ordered\": false, \"operations\": [{\"op\": \"create\", \"data\": \"pi\"}, {\"op\": \"delete\"}, {\"op\": \"create\", \"data\": \"e\"}]}"
+		w := testHttpClient.Do(http.MethodPost, "/v2/records/bulk", body)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		results := ToBulkResults(t, w.Body.String())
+		assert.Equal(t, records.BULK_STATUS_CREATED, results[0].Status)
+		assert.Equal(t, records.BULK_STATUS_FAILED, results[1].Status)
+		assert.Equal(t, records.BULK_STATUS_CREATED, results[2].Status)
+	}))
+	t.Run("TooLarge", RunWithRecreateDB(func(t *testing.T) {
+		operations := make([]string, BULK_RECORDS_COUNT+1)
+		for i := range operations {
+			operations[i] = "{\"op\": \"create\", \"data\": \"pi\"}"
+		}
+
+		w := testHttpClient.Do(http.MethodPost, "/v2/records/bulk", "{\"operations\": ["+strings.Join(operations, ",")+"]}")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "\""+api.ERROR_BULK_TOO_LARGE+"\"", w.Body.String())
+	}))
+	t.Run("Empty", RunWithRecreateDB(func(t *testing.T) {
+		w := testHttpClient.Do(http.MethodPost, "/v2/records/bulk", "{\"operations\": []}")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "\""+api.ERROR_BULK_EMPTY+"\"", w.Body.String())
+	}))
+}
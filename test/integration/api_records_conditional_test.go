@@ -0,0 +1,57 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApiRecordsConditionalGet(t *testing.T) {
+	t.Run("IfNoneMatch", RunWithRecreateDB(func(t *testing.T) {
+		testHttpClient.UpsertRecord(nil, "exponent")
+
+		w := testHttpClient.Do(http.MethodGet, "/records/", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		etag := w.Header().Get("ETag")
+		assert.NotEmpty(t, etag)
+
+		w = testHttpClient.DoWithHeaders(http.MethodGet, "/records/", "", map[string]string{"If-None-Match": etag})
+		assert.Equal(t, http.StatusNotModified, w.Code)
+		assert.Equal(t, "", w.Body.String())
+
+		testHttpClient.UpsertRecord(nil, "pi")
+
+		w = testHttpClient.DoWithHeaders(http.MethodGet, "/records/", "", map[string]string{"If-None-Match": etag})
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NotEqual(t, etag, w.Header().Get("ETag"))
+		records, err := ToRecords(w.Body.String())
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(records))
+	}))
+	t.Run("ReloadWithoutChangesKeepsETag", RunWithRecreateDB(func(t *testing.T) {
+		testHttpClient.UpsertRecord(nil, "exponent")
+		etag := testHttpClient.Do(http.MethodGet, "/records/", "").Header().Get("ETag")
+
+		err := cacheService.Refresh(context.Background())
+		assert.Nil(t, err)
+
+		w := testHttpClient.DoWithHeaders(http.MethodGet, "/records/", "", map[string]string{"If-None-Match": etag})
+		assert.Equal(t, http.StatusNotModified, w.Code)
+	}))
+	t.Run("IfModifiedSince", RunWithRecreateDB(func(t *testing.T) {
+		w := testHttpClient.Do(http.MethodGet, "/records/", "")
+		modified := w.Header().Get("Last-Modified")
+		assert.NotEmpty(t, modified)
+
+		w = testHttpClient.DoWithHeaders(http.MethodGet, "/records/", "", map[string]string{"If-Modified-Since": modified})
+		assert.Equal(t, http.StatusNotModified, w.Code)
+
+		w = testHttpClient.DoWithHeaders(http.MethodGet, "/records/", "", map[string]string{"If-Modified-Since": "Mon, 01 Jan 2001 00:00:00 GMT"})
+		assert.Equal(t, http.StatusOK, w.Code)
+	}))
+}
@@ -0,0 +1,113 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/records"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var filterTestData = []string{"Pi number", "pi", "Exponent", "exp(1) is the exponent", "Planck constant", "PI.2"}
+
+func CreateFilterTestRecords(t *testing.T) {
+	for _, data := range filterTestData {
+		w := testHttpClient.CreateRecordV2(data)
+		assert.Equal(t, http.StatusCreated, w.Code)
+	}
+}
+
+func FilterRecordsData(t *testing.T, params url.Values) []string {
+	w := testHttpClient.Do(http.MethodGet, "/records/?"+params.Encode(), "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	page, err := ToPage(w.Body.String())
+	assert.Nil(t, err)
+
+	result := make([]string, 0)
+	for _, record := range page.Records {
+		result = append(result, record.Data)
+	}
+	return result
+}
+
+func TestApiRecordFilter(t *testing.T) {
+	t.Run("Exact", RunWithRecreateDB(func(t *testing.T) {
+		CreateFilterTestRecords(t)
+
+		result := FilterRecordsData(t, url.Values{"data": {"pi"}})
+		assert.Equal(t, []string{"pi"}, result)
+	}))
+	t.Run("Prefix", RunWithRecreateDB(func(t *testing.T) {
+		CreateFilterTestRecords(t)
+
+		result := FilterRecordsData(t, url.Values{"prefix": {"P"}, "sort": {"data"}})
+		assert.Equal(t, []string{"PI.2", "Pi number", "Planck constant"}, result)
+	}))
+	t.Run("Search", RunWithRecreateDB(func(t *testing.T) {
+		CreateFilterTestRecords(t)
+
+		result := FilterRecordsData(t, url.Values{"search": {"pi."}, "sort": {"data"}})
+		assert.Equal(t, []string{"PI.2"}, result)
+
+		result = FilterRecordsData(t, url.Values{"search": {"EXPONENT"}, "sort": {"data"}})
+		assert.Equal(t, []string{"Exponent", "exp(1) is the exponent"}, result)
+	}))
+	t.Run("Text", RunWithRecreateDB(func(t *testing.T) {
+		CreateFilterTestRecords(t)
+
+		result := FilterRecordsData(t, url.Values{"text": {"pi planck"}, "sort": {"data"}})
+		assert.Equal(t, []string{"PI.2", "Pi number", "Planck constant", "pi"}, result)
+	}))
+	t.Run("CacheAndDatabaseAreIdentical", RunWithRecreateDB(func(t *testing.T) {
+		ctx := context.Background()
+		for _, data := range []string{"Pi number", "pi", "pi", "a.b", "a+b", "(x)", "Ωmega", "ωMEGA", "under_score", "exp(1) is the exponent"} {
+			_, err := recordsService.Insert(ctx, bson.M{"data": data})
+			assert.Nil(t, err)
+		}
+		trashed, err := recordsService.Insert(ctx, bson.M{"data": "pi"})
+		assert.Nil(t, err)
+		_, err = recordsService.Delete(ctx, trashed.Id, nil)
+		assert.Nil(t, err)
+		_, err = recordsService.WithTenant("beta").Insert(ctx, bson.M{"data": "pi"})
+		assert.Nil(t, err)
+		assert.Nil(t, cacheService.Refresh(ctx))
+
+		data, missing := "pi", "tau"
+		queries := []records.Query{
+			{SortBy: records.SORT_BY_ID},
+			{SortBy: records.SORT_BY_DATA, Desc: true},
+			{SortBy: records.SORT_BY_ID, Data: &data},
+			{SortBy: records.SORT_BY_DATA, Data: &missing},
+			{SortBy: records.SORT_BY_DATA, Prefix: "a."},
+			{SortBy: records.SORT_BY_DATA, Prefix: "(x"},
+			{SortBy: records.SORT_BY_DATA, Search: "A+B"},
+			{SortBy: records.SORT_BY_DATA, Search: "_"},
+			{SortBy: records.SORT_BY_DATA, Desc: true, Search: "ωmega"},
+			{SortBy: records.SORT_BY_ID, Desc: true, Text: "exponent pi"},
+			// tenant names are not indexed for the text search
+			{SortBy: records.SORT_BY_ID, Text: records.DEFAULT_TENANT},
+			{SortBy: records.SORT_BY_ID, Text: "beta"},
+		}
+		for _, q := range queries {
+			q.Limit = 2
+			for {
+				fromCache, err := cacheService.Find(ctx, records.DEFAULT_TENANT, q)
+				assert.Nil(t, err)
+				fromDatabase, err := recordsService.WithTenant(records.DEFAULT_TENANT).Find(ctx, q)
+				assert.Nil(t, err)
+				assert.Equal(t, fromDatabase, fromCache, "query %+v", q)
+				if fromCache.Next == "" {
+					break
+				}
+				q.After, err = records.DecodeCursor(fromCache.Next)
+				assert.Nil(t, err)
+			}
+		}
+	}))
+}
@@ -0,0 +1,179 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ArtemVoronov/artforintrovert-test/internal/api"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/api/audit"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/records"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func ParseHistory(t *testing.T, body string) []records.HistoryEntry {
+	var history []records.HistoryEntry
+	err := json.Unmarshal([]byte(body), &history)
+	assert.Nil(t, err)
+	return history
+}
+
+func TestApiRecordsHistory(t *testing.T) {
+	t.Run("WritesAreTraced", RunWithRecreateDB(func(t *testing.T) {
+		created, err := ToRecord(testHttpClient.CreateRecordV2("exponent").Body.String())
+		assert.Nil(t, err)
+		location := "/v2/records/" + created.Id.Hex()
+
+		w := testHttpClient.DoWithHeaders(http.MethodPut, location, "{\"data\": \"pi\"}", map[string]string{audit.REQUEST_ID_HEADER: "request-2"})
+		assert.Equal(t, http.StatusOK, w.Code)
+		testHttpClient.Do(http.MethodDelete, location, "")
+		testHttpClient.Do(http.MethodPost, "/v2/records/trash/"+created.Id.Hex()+"/restore", "")
+
+		w = testHttpClient.Do(http.MethodGet, location+"/history", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		history := ParseHistory(t, w.Body.String())
+		assert.Equal(t, 4, len(history))
+		operations := make([]string, 0, len(history))
+		for i, entry := range history {
+			operations = append(operations, entry.Operation)
+			assert.Equal(t, int64(len(history)-i), entry.Version)
+			assert.Equal(t, created.Id, entry.RecordId)
+			assert.Equal(t, audit.ANONYMOUS_ACTOR, entry.Actor)
+		}
+		assert.Equal(t, []string{records.HISTORY_RESTORE, records.HISTORY_DELETE, records.HISTORY_UPDATE, records.HISTORY_CREATE}, operations)
+
+		update := history[2]
+		assert.Equal(t, "exponent", *update.OldData)
+		assert.Equal(t, "pi", *update.NewData)
+		assert.Equal(t, "request-2", update.RequestId)
+		assert.Nil(t, history[1].NewData)
+		assert.Nil(t, history[0].OldData)
+		assert.Nil(t, history[3].OldData)
+	}))
+	t.Run("LimitAndBefore", RunWithRecreateDB(func(t *testing.T) {
+		created, err := ToRecord(testHttpClient.CreateRecordV2("exponent").Body.String())
+		assert.Nil(t, err)
+		location := "/v2/records/" + created.Id.Hex()
+		testHttpClient.Do(http.MethodPut, location, "{\"data\": \"pi\"}")
+		testHttpClient.Do(http.MethodPut, location, "{\"data\": \"e\"}")
+
+		history := ParseHistory(t, testHttpClient.Do(http.MethodGet, location+"/history?limit=1&before=3", "").Body.String())
+		assert.Equal(t, 1, len(history))
+		assert.Equal(t, int64(2), history[0].Version)
+
+		w := testHttpClient.Do(http.MethodGet, location+"/history?limit=0", "")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "\""+api.ERROR_INVALID_LIMIT+"\"", w.Body.String())
+		w = testHttpClient.Do(http.MethodGet, location+"/history?before=abc", "")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "\""+api.ERROR_INVALID_HISTORY_BEFORE+"\"", w.Body.String())
+	}))
+	t.Run("BulkWritesAreTraced", RunWithRecreateDB(func(t *testing.T) {
+		created, err := ToRecord(testHttpClient.CreateRecordV2("exponent").Body.String())
+		assert.Nil(t, err)
+
+		w := testHttpClient.Do(http.MethodPost, "/v2/records/bulk", "{\"operations\": [{\"op\": \"update\", \"id\": \""+created.Id.Hex()+"\", \"data\": \"pi\"}]}")
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		history := ParseHistory(t, testHttpClient.Do(http.MethodGet, "/v2/records/"+created.Id.Hex()+"/history", "").Body.String())
+		assert.Equal(t, 2, len(history))
+		assert.Equal(t, records.HISTORY_UPDATE, history[0].Operation)
+		assert.Equal(t, "exponent", *history[0].OldData)
+		assert.Equal(t, "pi", *history[0].NewData)
+	}))
+}
+
+func TestApiRecordsRevert(t *testing.T) {
+	t.Run("Revert", RunWithRecreateDB(func(t *testing.T) {
+		created, err := ToRecord(testHttpClient.CreateRecordV2("exponent").Body.String())
+		assert.Nil(t, err)
+		location := "/v2/records/" + created.Id.Hex()
+		testHttpClient.Do(http.MethodPut, location, "{\"data\": \"pi\"}")
+
+		w := testHttpClient.Do(http.MethodPost, location+"/revert", "{\"version\": 1}")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "\"3\"", w.Header().Get("ETag"))
+		reverted, err := ToRecord(w.Body.String())
+		assert.Nil(t, err)
+		assert.Equal(t, "exponent", reverted.Data)
+		code, body, err := testHttpClient.GetRecord(created.Id.Hex())
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, code)
+		record, err := ToRecord(body)
+		assert.Nil(t, err)
+		assert.Equal(t, "exponent", record.Data)
+
+		history := ParseHistory(t, testHttpClient.Do(http.MethodGet, location+"/history", "").Body.String())
+		assert.Equal(t, records.HISTORY_REVERT, history[0].Operation)
+		assert.Equal(t, int64(1), *history[0].RevertedTo)
+		assert.Equal(t, "pi", *history[0].OldData)
+	}))
+	t.Run("AfterPurgeAndRecreate", RunWithRecreateDB(func(t *testing.T) {
+		ctx := context.Background()
+		purged, err := recordsService.Insert(ctx, bson.M{"data": "exponent"})
+		assert.Nil(t, err)
+		_, err = recordsService.Delete(ctx, purged.Id, nil)
+		assert.Nil(t, err)
+		_, err = recordsService.Purge(ctx, time.Now().Add(time.Second))
+		assert.Nil(t, err)
+		// the record created again with the same id starts from the version 1 as well
+		recreated, created, err := recordsService.Upsert(ctx, purged.Id, bson.M{"data": "pi"})
+		assert.Nil(t, err)
+		assert.True(t, created)
+		assert.Equal(t, int64(1), recreated.Version)
+		location := "/v2/records/" + purged.Id.Hex()
+		testHttpClient.Do(http.MethodPut, location, "{\"data\": \"e\"}")
+
+		w := testHttpClient.Do(http.MethodPost, location+"/revert", "{\"version\": 1}")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		reverted, err := ToRecord(w.Body.String())
+		assert.Nil(t, err)
+		assert.Equal(t, "pi", reverted.Data)
+	}))
+	t.Run("IfMatch", RunWithRecreateDB(func(t *testing.T) {
+		created, err := ToRecord(testHttpClient.CreateRecordV2("exponent").Body.String())
+		assert.Nil(t, err)
+		location := "/v2/records/" + created.Id.Hex()
+		testHttpClient.Do(http.MethodPut, location, "{\"data\": \"pi\"}")
+
+		w := testHttpClient.DoWithHeaders(http.MethodPost, location+"/revert", "{\"version\": 1}", map[string]string{"If-Match": "\"1\""})
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+		w = testHttpClient.DoWithHeaders(http.MethodPost, location+"/revert", "{\"version\": 1}", map[string]string{"If-Match": "\"2\""})
+		assert.Equal(t, http.StatusOK, w.Code)
+	}))
+	t.Run("VersionNotInHistory", RunWithRecreateDB(func(t *testing.T) {
+		created, err := ToRecord(testHttpClient.CreateRecordV2("exponent").Body.String())
+		assert.Nil(t, err)
+
+		w := testHttpClient.Do(http.MethodPost, "/v2/records/"+created.Id.Hex()+"/revert", "{\"version\": 7}")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, "\""+api.ERROR_VERSION_NOT_IN_HISTORY+"\"", w.Body.String())
+	}))
+	t.Run("VersionWithoutData", RunWithRecreateDB(func(t *testing.T) {
+		created, err := ToRecord(testHttpClient.CreateRecordV2("exponent").Body.String())
+		assert.Nil(t, err)
+		location := "/v2/records/" + created.Id.Hex()
+		testHttpClient.Do(http.MethodDelete, location, "")
+		testHttpClient.Do(http.MethodPost, "/v2/records/trash/"+created.Id.Hex()+"/restore", "")
+
+		w := testHttpClient.Do(http.MethodPost, location+"/revert", "{\"version\": 2}")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "\""+api.ERROR_VERSION_WITHOUT_DATA+"\"", w.Body.String())
+	}))
+	t.Run("InvalidVersion", RunWithRecreateDB(func(t *testing.T) {
+		created, err := ToRecord(testHttpClient.CreateRecordV2("exponent").Body.String())
+		assert.Nil(t, err)
+
+		w := testHttpClient.Do(http.MethodPost, "/v2/records/"+created.Id.Hex()+"/revert", "{\"version\": 0}")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	}))
+}
@@ -0,0 +1,126 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/ArtemVoronov/artforintrovert-test/internal/api"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/records"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	PAGINATION_RECORDS_COUNT = 25
+)
+
+func ToPage(body string) (records.Page, error) {
+	page := records.Page{}
+	err := json.Unmarshal([]byte(body), &page)
+	return page, err
+}
+
+func CreateRecordsV2(t *testing.T, count int) {
+	for i := 0; i < count; i++ {
+		w := testHttpClient.CreateRecordV2("data-" + strconv.Itoa(count-i))
+		assert.Equal(t, http.StatusCreated, w.Code)
+	}
+}
+
+func FetchAllPages(t *testing.T, url string) []records.Record {
+	result := make([]records.Record, 0)
+	next := ""
+	for {
+		pageUrl := url
+		if next != "" {
+			pageUrl += "&after=" + next
+		}
+		w := testHttpClient.Do(http.MethodGet, pageUrl, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		page, err := ToPage(w.Body.String())
+		assert.Nil(t, err)
+		result = append(result, page.Records...)
+		if page.Next == "" {
+			return result
+		}
+		next = page.Next
+	}
+}
+
+func TestApiRecordPagination(t *testing.T) {
+	t.Run("SortById", RunWithRecreateDB(func(t *testing.T) {
+		CreateRecordsV2(t, PAGINATION_RECORDS_COUNT)
+
+		result := FetchAllPages(t, "/records/?limit=10")
+		assert.Equal(t, PAGINATION_RECORDS_COUNT, len(result))
+		for i := 1; i < len(result); i++ {
+			assert.True(t, result[i-1].Id.Hex() < result[i].Id.Hex())
+		}
+	}))
+	t.Run("SortByDataDesc", RunWithRecreateDB(func(t *testing.T) {
+		CreateRecordsV2(t, PAGINATION_RECORDS_COUNT)
+
+		result := FetchAllPages(t, "/records/?limit=7&sort=-data")
+		assert.Equal(t, PAGINATION_RECORDS_COUNT, len(result))
+		for i := 1; i < len(result); i++ {
+			assert.True(t, result[i-1].Data >= result[i].Data)
+		}
+	}))
+	t.Run("CacheAndDatabaseAreIdentical", RunWithRecreateDB(func(t *testing.T) {
+		CreateRecordsV2(t, PAGINATION_RECORDS_COUNT)
+		prefix := "data-1"
+
+		queries := []records.Query{
+			{Limit: 10, SortBy: records.SORT_BY_DATA},
+			{Limit: 10, SortBy: records.SORT_BY_DATA, Desc: true},
+			{Limit: 7, SortBy: records.SORT_BY_ID, Desc: true},
+			{Limit: 3, SortBy: records.SORT_BY_ID, Prefix: prefix},
+			{Limit: 4, SortBy: records.SORT_BY_DATA, Desc: true, Search: "A-2"},
+		}
+		for _, q := range queries {
+			for {
+				fromCache, err := cacheService.Find(context.Background(), records.DEFAULT_TENANT, q)
+				assert.Nil(t, err)
+				fromDatabase, err := recordsService.Find(context.Background(), q)
+				assert.Nil(t, err)
+				assert.Equal(t, fromDatabase, fromCache)
+				if fromCache.Next == "" {
+					break
+				}
+				q.After, err = records.DecodeCursor(fromCache.Next)
+				assert.Nil(t, err)
+				assert.Equal(t, q.Desc, q.After.Desc)
+			}
+		}
+	}))
+	t.Run("CursorOfOtherDirection", RunWithRecreateDB(func(t *testing.T) {
+		CreateRecordsV2(t, 3)
+
+		w := testHttpClient.Do(http.MethodGet, "/records/?limit=1&sort=-data", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		page, err := ToPage(w.Body.String())
+		assert.Nil(t, err)
+
+		w = testHttpClient.Do(http.MethodGet, "/records/?limit=1&sort=data&after="+page.Next, "")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "\""+api.ERROR_INVALID_CURSOR+"\"", w.Body.String())
+	}))
+	t.Run("InvalidParams", RunWithRecreateDB(func(t *testing.T) {
+		w := testHttpClient.Do(http.MethodGet, "/records/?limit=0", "")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "\""+api.ERROR_INVALID_LIMIT+"\"", w.Body.String())
+
+		w = testHttpClient.Do(http.MethodGet, "/records/?sort=name", "")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "\""+api.ERROR_INVALID_SORT+"\"", w.Body.String())
+
+		w = testHttpClient.Do(http.MethodGet, "/records/?after=123", "")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "\""+api.ERROR_INVALID_CURSOR+"\"", w.Body.String())
+	}))
+}
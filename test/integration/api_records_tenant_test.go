@@ -0,0 +1,205 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/ArtemVoronov/artforintrovert-test/internal/api"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/api/tenant"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/auth"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/records"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func Tenant(name string) map[string]string {
+	return map[string]string{tenant.TENANT_HEADER: name}
+}
+
+func CreateTenantRecord(t *testing.T, name string, data string) records.Record {
+	w := testHttpClient.DoWithHeaders(http.MethodPost, "/v2/records/", "{\"data\": \""+data+"\"}", Tenant(name))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	created, err := ToRecord(w.Body.String())
+	assert.Nil(t, err)
+	return created
+}
+
+func TestApiRecordsTenant(t *testing.T) {
+	t.Run("RecordsAreIsolated", RunWithRecreateDB(func(t *testing.T) {
+		alpha := CreateTenantRecord(t, "alpha", "exponent")
+		beta := CreateTenantRecord(t, "beta", "logarithm")
+		created, err := ToRecord(testHttpClient.CreateRecordV2("integral").Body.String())
+		assert.Nil(t, err)
+
+		page := ParsePage(t, testHttpClient.DoWithHeaders(http.MethodGet, "/v2/records/", "", Tenant("alpha")).Body.String())
+		assert.Equal(t, 1, len(page.Records))
+		assert.Equal(t, alpha.Id, page.Records[0].Id)
+		page = ParsePage(t, testHttpClient.DoWithHeaders(http.MethodGet, "/v2/records/", "", Tenant("beta")).Body.String())
+		assert.Equal(t, 1, len(page.Records))
+		assert.Equal(t, beta.Id, page.Records[0].Id)
+		page = ParsePage(t, testHttpClient.Do(http.MethodGet, "/v2/records/", "").Body.String())
+		assert.Equal(t, 1, len(page.Records))
+		assert.Equal(t, created.Id, page.Records[0].Id)
+
+		w := testHttpClient.DoWithHeaders(http.MethodGet, "/records/", "", Tenant("alpha"))
+		assert.Equal(t, http.StatusOK, w.Code)
+		all, err := ToRecords(w.Body.String())
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(all))
+		assert.Equal(t, alpha.Id, all[0].Id)
+		w = testHttpClient.DoWithHeaders(http.MethodGet, "/records/", "", Tenant(records.DEFAULT_TENANT))
+		all, err = ToRecords(w.Body.String())
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(all))
+		assert.Equal(t, created.Id, all[0].Id)
+	}))
+	t.Run("OtherTenantRecordIsNotFound", RunWithRecreateDB(func(t *testing.T) {
+		alpha := CreateTenantRecord(t, "alpha", "exponent")
+		id := alpha.Id.Hex()
+
+		w := testHttpClient.DoWithHeaders(http.MethodGet, "/v2/records/"+id, "", Tenant("beta"))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		w = testHttpClient.Do(http.MethodGet, "/records/"+id, "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		w = testHttpClient.DoWithHeaders(http.MethodPatch, "/v2/records/"+id, "{\"data\": \"logarithm\"}", Tenant("beta"))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		w = testHttpClient.DoWithHeaders(http.MethodPut, "/v2/records/"+id, "{\"data\": \"logarithm\"}", Tenant("beta"))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		w = testHttpClient.DoWithHeaders(http.MethodDelete, "/v2/records/"+id, "", Tenant("beta"))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		w = testHttpClient.DoWithHeaders(http.MethodGet, "/v2/records/"+id+"/history", "", Tenant("beta"))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, 0, len(ParseHistory(t, w.Body.String())))
+
+		w = testHttpClient.DoWithHeaders(http.MethodGet, "/v2/records/"+id, "", Tenant("alpha"))
+		assert.Equal(t, http.StatusOK, w.Code)
+		record, err := ToRecord(w.Body.String())
+		assert.Nil(t, err)
+		assert.Equal(t, "exponent", record.Data)
+	}))
+	t.Run("IdTakenByOtherTenant", RunWithRecreateDB(func(t *testing.T) {
+		alpha := CreateTenantRecord(t, "alpha", "exponent")
+
+		body, err := CreateRecordBody(alpha.Id.Hex(), "logarithm")
+		assert.Nil(t, err)
+		w := testHttpClient.DoWithHeaders(http.MethodPut, "/records/", body, Tenant("beta"))
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, "\""+api.ERROR_ID_TAKEN+"\"", w.Body.String())
+
+		w = testHttpClient.DoWithHeaders(http.MethodGet, "/v2/records/"+alpha.Id.Hex(), "", Tenant("alpha"))
+		record, err := ToRecord(w.Body.String())
+		assert.Nil(t, err)
+		assert.Equal(t, "exponent", record.Data)
+	}))
+	t.Run("TrashIsIsolated", RunWithRecreateDB(func(t *testing.T) {
+		alpha := CreateTenantRecord(t, "alpha", "exponent")
+		id := alpha.Id.Hex()
+		w := testHttpClient.DoWithHeaders(http.MethodDelete, "/v2/records/"+id, "", Tenant("alpha"))
+		assert.Equal(t, http.StatusNoContent, w.Code)
+
+		page := ParsePage(t, testHttpClient.DoWithHeaders(http.MethodGet, "/v2/records/trash", "", Tenant("beta")).Body.String())
+		assert.Equal(t, 0, len(page.Records))
+		w = testHttpClient.DoWithHeaders(http.MethodPost, "/v2/records/trash/"+id+"/restore", "", Tenant("beta"))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		w = testHttpClient.DoWithHeaders(http.MethodPost, "/v2/records/trash/"+id+"/restore", "", Tenant("alpha"))
+		assert.Equal(t, http.StatusOK, w.Code)
+		page = ParsePage(t, testHttpClient.DoWithHeaders(http.MethodGet, "/v2/records/", "", Tenant("alpha")).Body.String())
+		assert.Equal(t, 1, len(page.Records))
+		page = ParsePage(t, testHttpClient.DoWithHeaders(http.MethodGet, "/v2/records/", "", Tenant("beta")).Body.String())
+		assert.Equal(t, 0, len(page.Records))
+	}))
+	t.Run("BulkIsIsolated", RunWithRecreateDB(func(t *testing.T) {
+		alpha := CreateTenantRecord(t, "alpha", "exponent")
+
+		body := "{\"operations\": [{\"op\": \"delete\", \"id\": \"" + alpha.Id.Hex() + "\"}, {\"op\": \"create\", \"data\": \"logarithm\"}]}"
+		w := testHttpClient.DoWithHeaders(http.MethodPost, "/v2/records/bulk", body, Tenant("beta"))
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		page := ParsePage(t, testHttpClient.DoWithHeaders(http.MethodGet, "/v2/records/", "", Tenant("alpha")).Body.String())
+		assert.Equal(t, 1, len(page.Records))
+		assert.Equal(t, alpha.Id, page.Records[0].Id)
+		page = ParsePage(t, testHttpClient.DoWithHeaders(http.MethodGet, "/v2/records/", "", Tenant("beta")).Body.String())
+		assert.Equal(t, 1, len(page.Records))
+		assert.Equal(t, "logarithm", page.Records[0].Data)
+	}))
+}
+
+func TestApiAuthTenant(t *testing.T) {
+	config := auth.Config{
+		Methods:       []string{auth.METHOD_API_KEY},
+		APIKeys:       []string{"alpha:" + HashApiKey("alpha-key"), "root:" + HashApiKey("root-key"), "editor:" + HashApiKey("editor-key")},
+		APIKeyRoles:   []string{"alpha:writer", "root:admin", "editor:writer"},
+		APIKeyTenants: []string{"alpha:alpha"},
+		JWTAlgorithm:  auth.ALGORITHM_HS256,
+	}
+	headers := func(key string, name string) map[string]string {
+		result := map[string]string{auth.API_KEY_HEADER: key}
+		if name != "" {
+			result[tenant.TENANT_HEADER] = name
+		}
+		return result
+	}
+
+	t.Run("PrincipalTenant", RunWithRecreateDB(func(t *testing.T) {
+		r := SetupAuthRouter(t, config)
+
+		w := DoAuthRequest(r, http.MethodPost, "/v2/records/", "{\"data\": \"exponent\"}", headers("alpha-key", ""))
+		assert.Equal(t, http.StatusCreated, w.Code)
+		w = DoAuthRequest(r, http.MethodGet, "/v2/records/", "", headers("alpha-key", "alpha"))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, 1, len(ParsePage(t, w.Body.String()).Records))
+
+		page := ParsePage(t, testHttpClient.DoWithHeaders(http.MethodGet, "/v2/records/", "", Tenant("alpha")).Body.String())
+		assert.Equal(t, 1, len(page.Records))
+		page = ParsePage(t, testHttpClient.Do(http.MethodGet, "/v2/records/", "").Body.String())
+		assert.Equal(t, 0, len(page.Records))
+	}))
+	t.Run("HeaderOfOtherTenant", RunWithRecreateDB(func(t *testing.T) {
+		r := SetupAuthRouter(t, config)
+
+		w := DoAuthRequest(r, http.MethodGet, "/v2/records/", "", headers("alpha-key", "beta"))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Equal(t, "{\"errors\":[{\"Field\":\"tenant\",\"Msg\":\""+api.ERROR_TENANT_FORBIDDEN+"\"}]}", w.Body.String())
+
+		// only the admins without a tenant may choose one
+		w = DoAuthRequest(r, http.MethodGet, "/v2/records/", "", headers("editor-key", "beta"))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	}))
+	t.Run("AdminChoosesTenant", RunWithRecreateDB(func(t *testing.T) {
+		r := SetupAuthRouter(t, config)
+		CreateTenantRecord(t, "beta", "exponent")
+
+		w := DoAuthRequest(r, http.MethodGet, "/v2/records/", "", headers("root-key", "beta"))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, 1, len(ParsePage(t, w.Body.String()).Records))
+		w = DoAuthRequest(r, http.MethodGet, "/v2/records/", "", headers("root-key", ""))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, 0, len(ParsePage(t, w.Body.String()).Records))
+	}))
+	t.Run("JWTTenantClaim", RunWithRecreateDB(func(t *testing.T) {
+		keyFile := WriteTempFile(t, "secret", []byte(TEST_JWT_SECRET))
+		r := SetupAuthRouter(t, auth.Config{
+			Methods:        []string{auth.METHOD_JWT},
+			JWTAlgorithm:   auth.ALGORITHM_HS256,
+			JWTKeyFile:     keyFile,
+			JWTTenantClaim: "team",
+		})
+		CreateTenantRecord(t, "beta", "exponent")
+
+		claims := jwt.MapClaims{"sub": "alice", "roles": []string{auth.ROLE_READER}, "team": "beta"}
+		token := SignToken(t, jwt.SigningMethodHS256, []byte(TEST_JWT_SECRET), "", claims)
+		w := DoAuthRequest(r, http.MethodGet, "/v2/records/", "", Bearer(token))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, 1, len(ParsePage(t, w.Body.String()).Records))
+	}))
+	t.Run("InvalidConfig", func(t *testing.T) {
+		invalid := config
+		invalid.APIKeyTenants = []string{"alpha"}
+		_, err := auth.CreateService(invalid)
+		assert.NotNil(t, err)
+	})
+}
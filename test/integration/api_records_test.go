@@ -4,10 +4,10 @@
 package integration
 
 import (
+	"context"
 	"net/http"
 	"sync"
 	"testing"
-	"time"
 
 	"github.com/ArtemVoronov/artforintrovert-test/internal/api"
 	"github.com/stretchr/testify/assert"
@@ -15,7 +15,6 @@ import (
 
 const (
 	GOROUTINES_LIMIT = 10000
-	DELAY_BETWEEN_OP = 5
 )
 
 var (
@@ -35,6 +34,37 @@ func TestApiRecordGetAll(t *testing.T) {
 		assert.Equal(t, "[]", body)
 	}))
 }
+func TestApiRecordGet(t *testing.T) {
+	t.Run("BasicCase", RunWithRecreateDB(func(t *testing.T) {
+		_, body, _ := testHttpClient.UpsertRecord(nil, "exponent")
+		id := ToId(body)
+
+		httpStatusCode, body, err := testHttpClient.GetRecord(id)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, httpStatusCode)
+		assert.Equal(t, "{\"id\":\""+id+"\",\"data\":\"exponent\"}", body)
+
+		err = cacheService.Refresh(context.Background())
+		assert.Nil(t, err)
+
+		httpStatusCode, body, err = testHttpClient.GetRecord(id)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, httpStatusCode)
+		assert.Equal(t, "{\"id\":\""+id+"\",\"data\":\"exponent\"}", body)
+	}))
+	t.Run("NotFound", RunWithRecreateDB(func(t *testing.T) {
+		httpStatusCode, body, err := testHttpClient.GetRecord("62ffcac20074ec24bbb5810d")
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusNotFound, httpStatusCode)
+		assert.Equal(t, "\""+api.ERROR_NOT_FOUND+"\"", body)
+	}))
+	t.Run("InvalidId", RunWithRecreateDB(func(t *testing.T) {
+		httpStatusCode, body, err := testHttpClient.GetRecord("123")
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusBadRequest, httpStatusCode)
+		assert.Equal(t, "\""+api.ERROR_INVALID_ID+"\"", body)
+	}))
+}
 func TestApiRecordInsert(t *testing.T) {
 	t.Run("BasicCase", RunWithRecreateDB(func(t *testing.T) {
 		httpStatusCode, body, err := testHttpClient.UpsertRecord(nil, "exponent")
@@ -58,7 +88,6 @@ func TestApiRecordInsert(t *testing.T) {
 		}
 
 		wg.Wait()
-		time.Sleep(DELAY_BETWEEN_OP * time.Second)
 		httpStatusCode, body, err := testHttpClient.GetAllRecords()
 		assert.Nil(t, err)
 		assert.Equal(t, http.StatusOK, httpStatusCode)
@@ -116,7 +145,6 @@ func TestApiRecordUpdate(t *testing.T) {
 		}
 
 		wg.Wait()
-		time.Sleep(DELAY_BETWEEN_OP * time.Second)
 		assert.Equal(t, GOROUTINES_LIMIT, len(ids))
 
 		wg.Add(len(ids))
@@ -133,7 +161,6 @@ func TestApiRecordUpdate(t *testing.T) {
 		}
 
 		wg.Wait()
-		time.Sleep(DELAY_BETWEEN_OP * time.Second)
 
 		httpStatusCode, body, err := testHttpClient.GetAllRecords()
 		assert.Nil(t, err)
@@ -158,8 +185,6 @@ func TestApiRecordDelete(t *testing.T) {
 		assert.Equal(t, http.StatusOK, httpStatusCode)
 		assert.Equal(t, "\"Done\"", body)
 
-		time.Sleep(DELAY_BETWEEN_OP * time.Second)
-
 		httpStatusCode, body, err = testHttpClient.GetAllRecords()
 		assert.Nil(t, err)
 		assert.Equal(t, http.StatusOK, httpStatusCode)
@@ -200,7 +225,6 @@ func TestApiRecordDelete(t *testing.T) {
 		}
 
 		wg.Wait()
-		time.Sleep(DELAY_BETWEEN_OP * time.Second)
 		assert.Equal(t, GOROUTINES_LIMIT, len(ids))
 
 		wg.Add(len(ids))
@@ -217,7 +241,6 @@ func TestApiRecordDelete(t *testing.T) {
 		}
 
 		wg.Wait()
-		time.Sleep(DELAY_BETWEEN_OP * time.Second)
 
 		httpStatusCode, body, err := testHttpClient.GetAllRecords()
 		assert.Nil(t, err)
@@ -0,0 +1,157 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ArtemVoronov/artforintrovert-test/internal/logging"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/db"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/records"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/trash"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func ParsePage(t *testing.T, body string) records.Page {
+	var page records.Page
+	err := json.Unmarshal([]byte(body), &page)
+	assert.Nil(t, err)
+	return page
+}
+
+func TestApiRecordsTrash(t *testing.T) {
+	t.Run("DeleteMovesToTrash", RunWithRecreateDB(func(t *testing.T) {
+		created, err := ToRecord(testHttpClient.CreateRecordV2("exponent").Body.String())
+		assert.Nil(t, err)
+		id := created.Id.Hex()
+
+		w := testHttpClient.Do(http.MethodDelete, "/v2/records/"+id, "")
+		assert.Equal(t, http.StatusNoContent, w.Code)
+
+		w = testHttpClient.Do(http.MethodGet, "/v2/records/"+id, "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		page := ParsePage(t, testHttpClient.Do(http.MethodGet, "/v2/records/", "").Body.String())
+		assert.Equal(t, 0, len(page.Records))
+		w = testHttpClient.Do(http.MethodDelete, "/v2/records/"+id, "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		w = testHttpClient.Do(http.MethodGet, "/v2/records/trash", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		page = ParsePage(t, w.Body.String())
+		assert.Equal(t, 1, len(page.Records))
+		assert.Equal(t, created.Id, page.Records[0].Id)
+		assert.Equal(t, "exponent", page.Records[0].Data)
+		assert.NotNil(t, page.Records[0].DeletedAt)
+	}))
+	t.Run("Restore", RunWithRecreateDB(func(t *testing.T) {
+		created, err := ToRecord(testHttpClient.CreateRecordV2("exponent").Body.String())
+		assert.Nil(t, err)
+		id := created.Id.Hex()
+		testHttpClient.Do(http.MethodDelete, "/v2/records/"+id, "")
+
+		w := testHttpClient.Do(http.MethodPost, "/v2/records/trash/"+id+"/restore", "")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "\"3\"", w.Header().Get("ETag"))
+		restored, err := ToRecord(w.Body.String())
+		assert.Nil(t, err)
+		assert.Equal(t, "exponent", restored.Data)
+		assert.Nil(t, restored.DeletedAt)
+		w = testHttpClient.Do(http.MethodGet, "/v2/records/"+id, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		_, body, err := testHttpClient.GetAllRecords()
+		assert.Nil(t, err)
+		all, err := ToRecords(body)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(all))
+		page := ParsePage(t, testHttpClient.Do(http.MethodGet, "/v2/records/trash", "").Body.String())
+		assert.Equal(t, 0, len(page.Records))
+	}))
+	t.Run("RestoreNotInTrash", RunWithRecreateDB(func(t *testing.T) {
+		created, err := ToRecord(testHttpClient.CreateRecordV2("exponent").Body.String())
+		assert.Nil(t, err)
+
+		w := testHttpClient.Do(http.MethodPost, "/v2/records/trash/"+created.Id.Hex()+"/restore", "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		w = testHttpClient.Do(http.MethodPost, "/v2/records/trash/"+NOT_EXISTED_RECORD_ID+"/restore", "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	}))
+	t.Run("UpsertRecreatesDeleted", RunWithRecreateDB(func(t *testing.T) {
+		created, err := ToRecord(testHttpClient.CreateRecordV2("exponent").Body.String())
+		assert.Nil(t, err)
+		id := created.Id.Hex()
+		testHttpClient.Do(http.MethodDelete, "/v2/records/"+id, "")
+
+		code, _, err := testHttpClient.UpsertRecord(id, "pi")
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusCreated, code)
+
+		code, body, err := testHttpClient.GetRecord(id)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, code)
+		record, err := ToRecord(body)
+		assert.Nil(t, err)
+		assert.Equal(t, "pi", record.Data)
+		page := ParsePage(t, testHttpClient.Do(http.MethodGet, "/v2/records/trash", "").Body.String())
+		assert.Equal(t, 0, len(page.Records))
+	}))
+	t.Run("BulkDeleteMovesToTrash", RunWithRecreateDB(func(t *testing.T) {
+		created, err := ToRecord(testHttpClient.CreateRecordV2("exponent").Body.String())
+		assert.Nil(t, err)
+
+		w := testHttpClient.Do(http.MethodPost, "/v2/records/bulk", "{\"operations\": [{\"op\": \"delete\", \"id\": \""+created.Id.Hex()+"\"}]}")
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		page := ParsePage(t, testHttpClient.Do(http.MethodGet, "/v2/records/trash", "").Body.String())
+		assert.Equal(t, 1, len(page.Records))
+		_, err = recordsService.GetById(context.Background(), created.Id)
+		assert.ErrorIs(t, err, db.ErrNotFound)
+	}))
+}
+
+func TestTrashPurge(t *testing.T) {
+	t.Run("KeepsRecentlyDeleted", RunWithRecreateDB(func(t *testing.T) {
+		record, err := recordsService.Insert(context.Background(), bson.M{"data": "exponent"})
+		assert.Nil(t, err)
+		_, err = recordsService.Delete(context.Background(), record.Id, nil)
+		assert.Nil(t, err)
+
+		err = trash.CreateService(recordsService, logging.Default("trash"), trash.Config{Retention: time.Hour, PurgeInterval: time.Hour}).Purge(context.Background())
+		assert.Nil(t, err)
+
+		_, err = recordsService.Restore(context.Background(), record.Id)
+		assert.Nil(t, err)
+	}))
+	t.Run("RemovesExpired", RunWithRecreateDB(func(t *testing.T) {
+		record, err := recordsService.Insert(context.Background(), bson.M{"data": "exponent"})
+		assert.Nil(t, err)
+		alive, err := recordsService.Insert(context.Background(), bson.M{"data": "pi"})
+		assert.Nil(t, err)
+		_, err = recordsService.Delete(context.Background(), record.Id, nil)
+		assert.Nil(t, err)
+		time.Sleep(10 * time.Millisecond)
+
+		err = trash.CreateService(recordsService, logging.Default("trash"), trash.Config{Retention: 0, PurgeInterval: time.Hour}).Purge(context.Background())
+		assert.Nil(t, err)
+
+		_, err = recordsService.Restore(context.Background(), record.Id)
+		assert.ErrorIs(t, err, db.ErrNotFound)
+		page, err := recordsService.FindTrash(context.Background(), records.Query{Limit: records.MAX_PAGE_LIMIT, SortBy: records.SORT_BY_ID})
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(page.Records))
+		_, err = recordsService.GetById(context.Background(), alive.Id)
+		assert.Nil(t, err)
+
+		changes, err := recordsService.GetChanges(context.Background(), time.Time{})
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(changes.Updated))
+		assert.Equal(t, 1, len(changes.Deleted))
+		assert.Equal(t, record.Id, changes.Deleted[0])
+	}))
+}
@@ -0,0 +1,137 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/ArtemVoronov/artforintrovert-test/internal/api"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/db"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/records"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	NOT_EXISTED_RECORD_ID = "62ffcac20074ec24bbb5810d"
+)
+
+func TestApiRecordV2Create(t *testing.T) {
+	t.Run("BasicCase", RunWithRecreateDB(func(t *testing.T) {
+		w := testHttpClient.CreateRecordV2("exponent")
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		record, err := ToRecord(w.Body.String())
+		assert.Nil(t, err)
+		assert.Equal(t, "exponent", record.Data)
+		assert.Equal(t, "/v2/records/"+record.Id.Hex(), w.Header().Get("Location"))
+	}))
+	t.Run("MissedData", RunWithRecreateDB(func(t *testing.T) {
+		w := testHttpClient.CreateRecordV2(nil)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, ERROR_RECORD_DATA_IS_REQUIRED, w.Body.String())
+	}))
+}
+
+func TestApiRecordV2Get(t *testing.T) {
+	t.Run("BasicCase", RunWithRecreateDB(func(t *testing.T) {
+		location := testHttpClient.CreateRecordV2("exponent").Header().Get("Location")
+
+		w := testHttpClient.Do(http.MethodGet, location, "")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		record, err := ToRecord(w.Body.String())
+		assert.Nil(t, err)
+		assert.Equal(t, "exponent", record.Data)
+	}))
+	t.Run("NotFound", RunWithRecreateDB(func(t *testing.T) {
+		w := testHttpClient.Do(http.MethodGet, "/v2/records/"+NOT_EXISTED_RECORD_ID, "")
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, "\""+api.ERROR_NOT_FOUND+"\"", w.Body.String())
+	}))
+	t.Run("InvalidId", RunWithRecreateDB(func(t *testing.T) {
+		w := testHttpClient.Do(http.MethodGet, "/v2/records/123", "")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "\""+api.ERROR_INVALID_ID+"\"", w.Body.String())
+	}))
+}
+
+func TestApiRecordV2Update(t *testing.T) {
+	t.Run("Replace", RunWithRecreateDB(func(t *testing.T) {
+		location := testHttpClient.CreateRecordV2("exponent").Header().Get("Location")
+
+		w := testHttpClient.Do(http.MethodPut, location, "{\"data\": \"pi\"}")
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		record, err := ToRecord(testHttpClient.Do(http.MethodGet, location, "").Body.String())
+		assert.Nil(t, err)
+		assert.Equal(t, "pi", record.Data)
+	}))
+	t.Run("ReplaceRemovesMissingFields", RunWithRecreateDB(func(t *testing.T) {
+		w := testHttpClient.CreateRecordV2("exponent")
+		record, err := ToRecord(w.Body.String())
+		assert.Nil(t, err)
+		location := w.Header().Get("Location")
+		filter := bson.M{"_id": record.Id}
+		err = dbService.UpdateOne(context.Background(), db.DBName(), records.RECORDS_COLLECTION_NAME, filter, bson.M{"$set": bson.M{"note": "irrational"}})
+		assert.Nil(t, err)
+
+		w = testHttpClient.Do(http.MethodPatch, location, "{\"data\": \"e\"}")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var document bson.M
+		assert.Nil(t, dbService.FindOne(context.Background(), db.DBName(), records.RECORDS_COLLECTION_NAME, filter, &document))
+		assert.Equal(t, "irrational", document["note"])
+
+		w = testHttpClient.Do(http.MethodPut, location, "{\"data\": \"pi\"}")
+		assert.Equal(t, http.StatusOK, w.Code)
+		document = nil
+		assert.Nil(t, dbService.FindOne(context.Background(), db.DBName(), records.RECORDS_COLLECTION_NAME, filter, &document))
+		assert.NotContains(t, document, "note")
+		assert.Equal(t, "pi", document["data"])
+		assert.Equal(t, records.DEFAULT_TENANT, document[records.TENANT_FIELD])
+		assert.EqualValues(t, 3, document[records.VERSION_FIELD])
+	}))
+	t.Run("Patch", RunWithRecreateDB(func(t *testing.T) {
+		location := testHttpClient.CreateRecordV2("exponent").Header().Get("Location")
+
+		w := testHttpClient.Do(http.MethodPatch, location, "{}")
+		assert.Equal(t, http.StatusOK, w.Code)
+		record, err := ToRecord(w.Body.String())
+		assert.Nil(t, err)
+		assert.Equal(t, "exponent", record.Data)
+
+		w = testHttpClient.Do(http.MethodPatch, location, "{\"data\": \"pi\"}")
+		assert.Equal(t, http.StatusOK, w.Code)
+		record, err = ToRecord(w.Body.String())
+		assert.Nil(t, err)
+		assert.Equal(t, "pi", record.Data)
+	}))
+	t.Run("NotFound", RunWithRecreateDB(func(t *testing.T) {
+		w := testHttpClient.Do(http.MethodPut, "/v2/records/"+NOT_EXISTED_RECORD_ID, "{\"data\": \"pi\"}")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		w = testHttpClient.Do(http.MethodPatch, "/v2/records/"+NOT_EXISTED_RECORD_ID, "{\"data\": \"pi\"}")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	}))
+}
+
+func TestApiRecordV2Delete(t *testing.T) {
+	t.Run("BasicCase", RunWithRecreateDB(func(t *testing.T) {
+		location := testHttpClient.CreateRecordV2("exponent").Header().Get("Location")
+
+		w := testHttpClient.Do(http.MethodDelete, location, "")
+		assert.Equal(t, http.StatusNoContent, w.Code)
+
+		w = testHttpClient.Do(http.MethodGet, location, "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		w = testHttpClient.Do(http.MethodDelete, location, "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	}))
+}
@@ -0,0 +1,82 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/ArtemVoronov/artforintrovert-test/internal/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApiRecordVersions(t *testing.T) {
+	t.Run("ETagChangesOnUpdate", RunWithRecreateDB(func(t *testing.T) {
+		created := testHttpClient.CreateRecordV2("exponent")
+		location := created.Header().Get("Location")
+		assert.Equal(t, "\"1\"", created.Header().Get("ETag"))
+
+		w := testHttpClient.Do(http.MethodPut, location, "{\"data\": \"pi\"}")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "\"2\"", w.Header().Get("ETag"))
+
+		w = testHttpClient.Do(http.MethodGet, location, "")
+		assert.Equal(t, "\"2\"", w.Header().Get("ETag"))
+	}))
+	t.Run("ConflictingReplace", RunWithRecreateDB(func(t *testing.T) {
+		created := testHttpClient.CreateRecordV2("exponent")
+		location := created.Header().Get("Location")
+		etag := created.Header().Get("ETag")
+
+		w := testHttpClient.DoWithHeaders(http.MethodPut, location, "{\"data\": \"pi\"}", map[string]string{"If-Match": etag})
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		w = testHttpClient.DoWithHeaders(http.MethodPut, location, "{\"data\": \"e\"}", map[string]string{"If-Match": etag})
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+		assert.Equal(t, "\""+api.ERROR_PRECONDITION_FAILED+"\"", w.Body.String())
+
+		record, err := ToRecord(testHttpClient.Do(http.MethodGet, location, "").Body.String())
+		assert.Nil(t, err)
+		assert.Equal(t, "pi", record.Data)
+	}))
+	t.Run("ConflictingPatchAndDelete", RunWithRecreateDB(func(t *testing.T) {
+		created := testHttpClient.CreateRecordV2("exponent")
+		location := created.Header().Get("Location")
+		stale := map[string]string{"If-Match": "\"0\""}
+
+		w := testHttpClient.DoWithHeaders(http.MethodPatch, location, "{\"data\": \"pi\"}", stale)
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+		w = testHttpClient.DoWithHeaders(http.MethodPatch, location, "{}", stale)
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+		w = testHttpClient.DoWithHeaders(http.MethodDelete, location, "", stale)
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+		w = testHttpClient.DoWithHeaders(http.MethodDelete, location, "", map[string]string{"If-Match": created.Header().Get("ETag")})
+		assert.Equal(t, http.StatusNoContent, w.Code)
+	}))
+	t.Run("MissingRecordDoesNotMatch", RunWithRecreateDB(func(t *testing.T) {
+		w := testHttpClient.DoWithHeaders(http.MethodPut, "/v2/records/"+NOT_EXISTED_RECORD_ID, "{\"data\": \"pi\"}", map[string]string{"If-Match": "*"})
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	}))
+	t.Run("V1ConditionalUpsert", RunWithRecreateDB(func(t *testing.T) {
+		code, body, err := testHttpClient.UpsertRecord(nil, "exponent")
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusCreated, code)
+		id := ToId(body)
+		update := "{\"id\": \"" + id + "\", \"data\": \"pi\"}"
+
+		w := testHttpClient.DoWithHeaders(http.MethodPut, "/records/", update, map[string]string{"If-Match": "\"1\""})
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "\"2\"", w.Header().Get("ETag"))
+
+		w = testHttpClient.DoWithHeaders(http.MethodPut, "/records/", update, map[string]string{"If-Match": "\"1\""})
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+		w = testHttpClient.DoWithHeaders(http.MethodDelete, "/records/", "{\"id\": \""+id+"\"}", map[string]string{"If-Match": "\"1\""})
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+		w = testHttpClient.DoWithHeaders(http.MethodPut, "/records/", "{\"id\": \""+NOT_EXISTED_RECORD_ID+"\", \"data\": \"pi\"}", map[string]string{"If-Match": "*"})
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	}))
+}
@@ -0,0 +1,143 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"net/http"
+	"testing"
+
+	recordsApi "github.com/ArtemVoronov/artforintrovert-test/internal/api/rest/v1/records"
+	recordsApiV2 "github.com/ArtemVoronov/artforintrovert-test/internal/api/rest/v2/records"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/logging"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/cache"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/records"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/tracing"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const TEST_TRACE_ID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+func SetupTracingRouter(recordsCache cache.CacheService) (*gin.Engine, *tracing.Service, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	tracingService := tracing.WithExporter(logging.Default("tracing"), tracing.Config{ServiceName: "records", SamplePercent: 100}, exporter)
+
+	r := gin.New()
+	r.Use(tracingService.Middleware())
+	recordsHandler := recordsApi.CreateHandler(recordsService, recordsCache)
+	recordsHandlerV2 := recordsApiV2.CreateHandler(recordsService, recordsCache)
+	r.GET("/records/", recordsHandler.GetRecords)
+	r.POST("/v2/records/", recordsHandlerV2.CreateRecord)
+	r.POST("/v2/records/batch", recordsHandlerV2.BatchRecords)
+	r.PUT("/v2/records/:id", recordsHandlerV2.ReplaceRecord)
+	return r, tracingService, exporter
+}
+
+// ExportedSpans returns the spans exported so far by their names
+func ExportedSpans(t *testing.T, tracingService *tracing.Service, exporter *tracetest.InMemoryExporter) map[string]tracetest.SpanStub {
+	err := tracingService.Flush()
+	assert.Nil(t, err)
+	result := make(map[string]tracetest.SpanStub)
+	for _, span := range exporter.GetSpans() {
+		result[span.Name] = span
+	}
+	return result
+}
+
+func AssertChildOf(t *testing.T, parent tracetest.SpanStub, child tracetest.SpanStub) {
+	assert.True(t, parent.SpanContext.IsValid())
+	assert.Equal(t, parent.SpanContext.TraceID(), child.SpanContext.TraceID())
+	assert.Equal(t, parent.SpanContext.SpanID(), child.Parent.SpanID())
+}
+
+func TestApiTracing(t *testing.T) {
+	t.Run("RequestSpans", RunWithRecreateDB(func(t *testing.T) {
+		r, tracingService, exporter := SetupTracingRouter(cacheService)
+
+		w := DoAuthRequest(r, http.MethodPost, "/v2/records/", "{\"data\": \"exponent\"}", nil)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		created, err := ToRecord(w.Body.String())
+		assert.Nil(t, err)
+		w = DoAuthRequest(r, http.MethodPut, "/v2/records/"+created.Id.Hex(), "{\"data\": \"e\"}", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		spans := ExportedSpans(t, tracingService, exporter)
+		request, ok := spans["/v2/records/:id"]
+		assert.True(t, ok)
+		assert.Equal(t, trace.SpanKindServer, request.SpanKind)
+		replace, ok := spans["records.Service.Replace"]
+		assert.True(t, ok)
+		AssertChildOf(t, request, replace)
+		assert.Contains(t, replace.Attributes, attribute.String(records.TENANT_ATTRIBUTE, records.DEFAULT_TENANT))
+		assert.NotContains(t, spans, "records.Service.Update")
+
+		insert, ok := spans["records.Service.Insert"]
+		assert.True(t, ok)
+		AssertChildOf(t, spans["/v2/records/"], insert)
+		assert.NotEqual(t, request.SpanContext.TraceID(), insert.SpanContext.TraceID())
+	}))
+	t.Run("CacheSpans", RunWithRecreateDB(func(t *testing.T) {
+		r, tracingService, exporter := SetupTracingRouter(CreateLoadedCache(t))
+
+		w := DoAuthRequest(r, http.MethodPost, "/v2/records/", "{\"data\": \"exponent\"}", nil)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		w = DoAuthRequest(r, http.MethodGet, "/records/", "", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		spans := ExportedSpans(t, tracingService, exporter)
+		create := spans["/v2/records/"]
+		AssertChildOf(t, create, spans["gin.BindJSON"])
+		AssertChildOf(t, create, spans["cache.Service.Put"])
+		assert.Contains(t, spans["cache.Service.Put"].Attributes, attribute.String(records.TENANT_ATTRIBUTE, records.DEFAULT_TENANT))
+		// the write dropped the snapshot, so the read builds it
+		refresh := spans["cache.Service.refreshSnapshot"]
+		AssertChildOf(t, spans["/records/"], refresh)
+		AssertChildOf(t, refresh, spans["cache.Service.view"])
+	}))
+	t.Run("ContinuesCallerTrace", RunWithRecreateDB(func(t *testing.T) {
+		r, tracingService, exporter := SetupTracingRouter(cacheService)
+
+		headers := map[string]string{"traceparent": "00-" + TEST_TRACE_ID + "-00f067aa0ba902b7-01"}
+		w := DoAuthRequest(r, http.MethodPost, "/v2/records/", "{\"data\": \"exponent\"}", headers)
+		assert.Equal(t, http.StatusCreated, w.Code)
+
+		spans := ExportedSpans(t, tracingService, exporter)
+		request := spans["/v2/records/"]
+		assert.Equal(t, TEST_TRACE_ID, request.SpanContext.TraceID().String())
+		assert.Equal(t, "00f067aa0ba902b7", request.Parent.SpanID().String())
+		AssertChildOf(t, request, spans["records.Service.Insert"])
+	}))
+	t.Run("AtomicBatchSpans", RunWithRecreateDB(func(t *testing.T) {
+		SkipWithoutTransactions(t)
+		r, tracingService, exporter := SetupTracingRouter(cacheService)
+		created, err := ToRecord(testHttpClient.CreateRecordV2("exponent").Body.String())
+		assert.Nil(t, err)
+
+		body := CreateBatchBody(true, "{\"op\": \"replace\", \"id\": \""+created.Id.Hex()+"\", \"data\": \"e\"}")
+		w := DoAuthRequest(r, http.MethodPost, "/v2/records/batch", body, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		// the operations in the transaction are traced under the batch
+		spans := ExportedSpans(t, tracingService, exporter)
+		batch := spans["records.Service.Batch"]
+		AssertChildOf(t, spans["/v2/records/batch"], batch)
+		AssertChildOf(t, batch, spans["records.Service.Replace"])
+		assert.Equal(t, records.BATCH_STATUS_REPLACED, ToBatchResult(t, w.Body.String()).Results[0].Status)
+	}))
+	t.Run("Disabled", func(t *testing.T) {
+		tracingService, err := tracing.CreateService(logging.Default("tracing"), tracing.Config{Exporter: tracing.EXPORTER_NONE, SamplePercent: 100})
+		assert.Nil(t, err)
+		assert.False(t, tracingService.Enabled())
+		assert.Nil(t, tracingService.Flush())
+	})
+	t.Run("InvalidConfig", func(t *testing.T) {
+		_, err := tracing.CreateService(logging.Default("tracing"), tracing.Config{Exporter: "zipkin", SamplePercent: 100})
+		assert.NotNil(t, err)
+		_, err = tracing.CreateService(logging.Default("tracing"), tracing.Config{Exporter: tracing.EXPORTER_STDOUT, SamplePercent: 101})
+		assert.NotNil(t, err)
+	})
+}
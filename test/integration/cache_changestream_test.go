@@ -0,0 +1,127 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ArtemVoronov/artforintrovert-test/internal/logging"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/cache"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/db"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/records"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	CHANGE_STREAM_WAIT_TIMEOUT = 5 * time.Second
+	CHANGE_STREAM_WAIT_TICK    = 10 * time.Millisecond
+	CHANGE_STREAM_INSTANCE_ID  = "test"
+)
+
+func FindCachedData(c *cache.Service, data string) []records.Record {
+	page, err := c.Find(context.Background(), records.DEFAULT_TENANT, records.Query{Limit: records.MAX_PAGE_LIMIT, SortBy: records.SORT_BY_ID, Data: &data})
+	if err != nil {
+		return nil
+	}
+	return page.Records
+}
+
+// WatchRecorder is the records service sending the resume tokens of the opened change streams
+type WatchRecorder struct {
+	records.RecordsService
+	tokens chan bson.Raw
+}
+
+func (s *WatchRecorder) Watch(ctx context.Context, resumeToken bson.Raw) (db.ChangeStream, error) {
+	s.tokens <- resumeToken
+	return s.RecordsService.Watch(ctx, resumeToken)
+}
+
+func CreateChangeStreamCache(recordsService records.RecordsService) *cache.Service {
+	return cache.CreateService(recordsService, compressionService, logging.Default("cache"), cache.Config{
+		SyncMode:     cache.SYNC_MODE_CHANGE_STREAM,
+		MinDelay:     time.Second,
+		MaxDelay:     time.Minute,
+		FactorDelay:  2,
+		MaxStaleness: time.Minute,
+		InstanceId:   CHANGE_STREAM_INSTANCE_ID,
+		// the token is stored on shut down only, after the initial one
+		ResumeTokenSaveInterval: time.Hour,
+	})
+}
+
+func TestCacheChangeStream(t *testing.T) {
+	t.Run("AppliesChangesOfOtherWriters", RunWithRecreateDB(func(t *testing.T) {
+		changeStreamCache := CreateChangeStreamCache(recordsService)
+		changeStreamCache.Start()
+		defer changeStreamCache.ShutDown()
+
+		record, err := recordsService.Insert(context.Background(), bson.M{"data": "exponent"})
+		assert.Nil(t, err)
+		assert.Eventually(t, func() bool {
+			return len(FindCachedData(changeStreamCache, "exponent")) == 1
+		}, CHANGE_STREAM_WAIT_TIMEOUT, CHANGE_STREAM_WAIT_TICK)
+
+		_, err = recordsService.Update(context.Background(), record.Id, bson.M{"data": "pi"}, nil)
+		assert.Nil(t, err)
+		assert.Eventually(t, func() bool {
+			return len(FindCachedData(changeStreamCache, "pi")) == 1 && len(FindCachedData(changeStreamCache, "exponent")) == 0
+		}, CHANGE_STREAM_WAIT_TIMEOUT, CHANGE_STREAM_WAIT_TICK)
+
+		_, err = recordsService.Delete(context.Background(), record.Id, nil)
+		assert.Nil(t, err)
+		assert.Eventually(t, func() bool {
+			return len(FindCachedData(changeStreamCache, "pi")) == 0
+		}, CHANGE_STREAM_WAIT_TIMEOUT, CHANGE_STREAM_WAIT_TICK)
+	}))
+	t.Run("ResumesAfterRestart", RunWithRecreateDB(func(t *testing.T) {
+		recorder := &WatchRecorder{recordsService, make(chan bson.Raw, 10)}
+		changeStreamCache := CreateChangeStreamCache(recorder)
+		changeStreamCache.Start()
+		assert.Nil(t, <-recorder.tokens)
+
+		record, err := recordsService.Insert(context.Background(), bson.M{"data": "exponent"})
+		assert.Nil(t, err)
+		assert.Eventually(t, func() bool {
+			return len(FindCachedData(changeStreamCache, "exponent")) == 1
+		}, CHANGE_STREAM_WAIT_TIMEOUT, CHANGE_STREAM_WAIT_TICK)
+		initial, err := recordsService.ResumeToken(context.Background(), CHANGE_STREAM_INSTANCE_ID)
+		assert.Nil(t, err)
+		assert.NotNil(t, initial)
+		changeStreamCache.ShutDown()
+		assert.False(t, changeStreamCache.Stats().Live)
+		stored, err := recordsService.ResumeToken(context.Background(), CHANGE_STREAM_INSTANCE_ID)
+		assert.Nil(t, err)
+		assert.NotNil(t, stored)
+		assert.NotEqual(t, initial, stored)
+		other, err := recordsService.ResumeToken(context.Background(), "other")
+		assert.Nil(t, err)
+		assert.Nil(t, other)
+
+		_, err = recordsService.Update(context.Background(), record.Id, bson.M{"data": "pi"}, nil)
+		assert.Nil(t, err)
+
+		recorder = &WatchRecorder{recordsService, make(chan bson.Raw, 10)}
+		changeStreamCache = CreateChangeStreamCache(recorder)
+		changeStreamCache.Start()
+		assert.Equal(t, stored, <-recorder.tokens)
+		assert.Eventually(t, func() bool {
+			return len(FindCachedData(changeStreamCache, "pi")) == 1
+		}, CHANGE_STREAM_WAIT_TIMEOUT, CHANGE_STREAM_WAIT_TICK)
+
+		_, err = recordsService.Delete(context.Background(), record.Id, nil)
+		assert.Nil(t, err)
+		assert.Eventually(t, func() bool {
+			return len(FindCachedData(changeStreamCache, "pi")) == 0
+		}, CHANGE_STREAM_WAIT_TIMEOUT, CHANGE_STREAM_WAIT_TICK)
+		changeStreamCache.ShutDown()
+		current, err := recordsService.ResumeToken(context.Background(), CHANGE_STREAM_INSTANCE_ID)
+		assert.Nil(t, err)
+		assert.False(t, bytes.Equal(stored, current))
+	}))
+}
@@ -0,0 +1,72 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ArtemVoronov/artforintrovert-test/internal/logging"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/cache"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestCacheIncremental(t *testing.T) {
+	t.Run("AppliesChangesOfOtherWriters", RunWithRecreateDB(func(t *testing.T) {
+		incrementalCache := cache.CreateService(recordsService, compressionService, logging.Default("cache"), cache.Config{
+			SyncMode:           cache.SYNC_MODE_INCREMENTAL,
+			MinDelay:           50 * time.Millisecond,
+			MaxDelay:           time.Minute,
+			FactorDelay:        2,
+			MaxStaleness:       time.Minute,
+			FullReloadInterval: time.Hour,
+		})
+		incrementalCache.Start()
+		defer incrementalCache.ShutDown()
+
+		record, err := recordsService.Insert(context.Background(), bson.M{"data": "exponent"})
+		assert.Nil(t, err)
+		assert.Eventually(t, func() bool {
+			return len(FindCachedData(incrementalCache, "exponent")) == 1
+		}, CHANGE_STREAM_WAIT_TIMEOUT, CHANGE_STREAM_WAIT_TICK)
+
+		_, err = recordsService.Update(context.Background(), record.Id, bson.M{"data": "pi"}, nil)
+		assert.Nil(t, err)
+		assert.Eventually(t, func() bool {
+			return len(FindCachedData(incrementalCache, "pi")) == 1 && len(FindCachedData(incrementalCache, "exponent")) == 0
+		}, CHANGE_STREAM_WAIT_TIMEOUT, CHANGE_STREAM_WAIT_TICK)
+
+		_, err = recordsService.Delete(context.Background(), record.Id, nil)
+		assert.Nil(t, err)
+		assert.Eventually(t, func() bool {
+			return len(FindCachedData(incrementalCache, "pi")) == 0
+		}, CHANGE_STREAM_WAIT_TIMEOUT, CHANGE_STREAM_WAIT_TICK)
+	}))
+
+	t.Run("RecreatedRecordIsNotDeleted", RunWithRecreateDB(func(t *testing.T) {
+		record, err := recordsService.Insert(context.Background(), bson.M{"data": "phoenix"})
+		assert.Nil(t, err)
+		_, err = recordsService.Delete(context.Background(), record.Id, nil)
+		assert.Nil(t, err)
+		time.Sleep(10 * time.Millisecond)
+		_, _, err = recordsService.Upsert(context.Background(), record.Id, bson.M{"data": "phoenix"})
+		assert.Nil(t, err)
+
+		changes, err := recordsService.GetChanges(context.Background(), time.Time{})
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(changes.Updated))
+		assert.Equal(t, 0, len(changes.Deleted))
+		assert.Equal(t, record.Id, changes.Updated[0].Id)
+
+		_, err = recordsService.Delete(context.Background(), record.Id, nil)
+		assert.Nil(t, err)
+
+		changes, err = recordsService.GetChanges(context.Background(), changes.Until)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(changes.Updated))
+		assert.Equal(t, 1, len(changes.Deleted))
+	}))
+}
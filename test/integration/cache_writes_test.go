@@ -0,0 +1,75 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ArtemVoronov/artforintrovert-test/internal/logging"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/cache"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/records"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func CreateLoadedCache(t *testing.T) *cache.Service {
+	result := cache.CreateService(recordsService, compressionService, logging.Default("cache"), cache.Config{
+		SyncMode:     cache.SYNC_MODE_POLL,
+		MinDelay:     time.Hour,
+		MaxDelay:     time.Hour,
+		FactorDelay:  2,
+		MaxStaleness: time.Hour,
+	})
+	assert.Nil(t, result.Refresh(context.Background()))
+	return result
+}
+
+func CachedRecord(version int64, data string, id primitive.ObjectID) records.Record {
+	return records.Record{Id: id, Data: data, Version: version, Tenant: records.DEFAULT_TENANT}
+}
+
+func TestCacheWrites(t *testing.T) {
+	t.Run("OlderPutIsSkipped", RunWithRecreateDB(func(t *testing.T) {
+		c := CreateLoadedCache(t)
+		id := primitive.NewObjectID()
+
+		c.Put(context.Background(), CachedRecord(2, "pi", id))
+		c.Put(context.Background(), CachedRecord(1, "exponent", id))
+
+		assert.Len(t, FindCachedData(c, "pi"), 1)
+		assert.Empty(t, FindCachedData(c, "exponent"))
+	}))
+	t.Run("PutAfterRemoveOfLaterVersion", RunWithRecreateDB(func(t *testing.T) {
+		c := CreateLoadedCache(t)
+		id := primitive.NewObjectID()
+		c.Put(context.Background(), CachedRecord(1, "exponent", id))
+
+		c.Remove(context.Background(), records.DEFAULT_TENANT, id, 3)
+		c.Put(context.Background(), CachedRecord(2, "pi", id))
+
+		assert.Empty(t, FindCachedData(c, "exponent"))
+		assert.Empty(t, FindCachedData(c, "pi"))
+	}))
+	t.Run("RemoveAfterPutOfLaterVersion", RunWithRecreateDB(func(t *testing.T) {
+		c := CreateLoadedCache(t)
+		id := primitive.NewObjectID()
+
+		c.Put(context.Background(), CachedRecord(4, "restored", id))
+		c.Remove(context.Background(), records.DEFAULT_TENANT, id, 3)
+
+		assert.Len(t, FindCachedData(c, "restored"), 1)
+	}))
+	t.Run("PurgeDropsTombstone", RunWithRecreateDB(func(t *testing.T) {
+		c := CreateLoadedCache(t)
+		id := primitive.NewObjectID()
+		c.Remove(context.Background(), records.DEFAULT_TENANT, id, 3)
+
+		c.Remove(context.Background(), "", id, 0)
+		c.Put(context.Background(), CachedRecord(1, "recreated", id))
+
+		assert.Len(t, FindCachedData(c, "recreated"), 1)
+	}))
+}
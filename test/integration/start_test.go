@@ -6,13 +6,18 @@ package integration
 import (
 	"context"
 	"fmt"
+	"log"
 	"os"
 	"path"
 	"runtime"
 	"testing"
+	"time"
 
 	recordsApi "github.com/ArtemVoronov/artforintrovert-test/internal/api/rest/v1/records"
+	recordsApiV2 "github.com/ArtemVoronov/artforintrovert-test/internal/api/rest/v2/records"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/logging"
 	"github.com/ArtemVoronov/artforintrovert-test/internal/services/cache"
+	"github.com/ArtemVoronov/artforintrovert-test/internal/services/compression"
 	"github.com/ArtemVoronov/artforintrovert-test/internal/services/db"
 	"github.com/ArtemVoronov/artforintrovert-test/internal/services/records"
 	"github.com/gin-gonic/gin"
@@ -22,6 +27,13 @@ import (
 
 var TestRouter *gin.Engine
 
+var (
+	dbService          db.MongoService
+	recordsService     *records.Service
+	cacheService       *cache.Service
+	compressionService *compression.Service
+)
+
 func TestMain(m *testing.M) {
 	Setup()
 	TestRouter = SetupRouter()
@@ -32,10 +44,29 @@ func TestMain(m *testing.M) {
 
 func SetupRouter() *gin.Engine {
 	r := gin.Default()
-
-	r.GET("/records/", recordsApi.GetRecords)
-	r.PUT("/records/", recordsApi.UpdateRecord)
-	r.DELETE("/records/", recordsApi.DeleteRecord)
+	r.Use(compressionService.Middleware())
+
+	recordsHandler := recordsApi.CreateHandler(recordsService, cacheService)
+
+	r.GET("/records/", recordsHandler.GetRecords)
+	r.GET("/records/:id", recordsHandler.GetRecord)
+	r.PUT("/records/", recordsHandler.UpdateRecord)
+	r.DELETE("/records/", recordsHandler.DeleteRecord)
+
+	recordsHandlerV2 := recordsApiV2.CreateHandler(recordsService, cacheService)
+
+	r.GET("/v2/records/", recordsHandlerV2.GetRecords)
+	r.POST("/v2/records/", recordsHandlerV2.CreateRecord)
+	r.POST("/v2/records/bulk", recordsHandlerV2.BulkRecords)
+	r.POST("/v2/records/batch", recordsHandlerV2.BatchRecords)
+	r.GET("/v2/records/trash", recordsHandlerV2.GetTrash)
+	r.POST("/v2/records/trash/:id/restore", recordsHandlerV2.RestoreRecord)
+	r.GET("/v2/records/:id/history", recordsHandlerV2.GetHistory)
+	r.POST("/v2/records/:id/revert", recordsHandlerV2.RevertRecord)
+	r.GET("/v2/records/:id", recordsHandlerV2.GetRecord)
+	r.PUT("/v2/records/:id", recordsHandlerV2.ReplaceRecord)
+	r.PATCH("/v2/records/:id", recordsHandlerV2.PatchRecord)
+	r.DELETE("/v2/records/:id", recordsHandlerV2.DeleteRecord)
 
 	return r
 }
@@ -55,10 +86,18 @@ func InitTestEnv() {
 type TestFunc func(t *testing.T)
 
 func RunWithRecreateDB(f TestFunc) func(t *testing.T) {
-	collection := db.Instance().GetCollection("testdb", "records")
-
 	return func(t *testing.T) {
-		err := collection.Drop(context.TODO())
+		err := dbService.Drop(context.Background(), "testdb", "records")
+		assert.Nil(t, err)
+		err = dbService.Drop(context.Background(), "testdb", "records_tombstones")
+		assert.Nil(t, err)
+		err = dbService.Drop(context.Background(), "testdb", "records_history")
+		assert.Nil(t, err)
+		err = dbService.Drop(context.Background(), "testdb", "records_sync")
+		assert.Nil(t, err)
+		err = recordsService.Setup(context.Background())
+		assert.Nil(t, err)
+		err = cacheService.Refresh(context.Background())
 		assert.Nil(t, err)
 		f(t)
 	}
@@ -66,17 +105,33 @@ func RunWithRecreateDB(f TestFunc) func(t *testing.T) {
 
 func Setup() {
 	InitTestEnv()
-	db.Instance()
-	cache.Instance()
-	records.Instance()
+
+	var err error
+	dbService, err = db.CreateService(logging.Default("db"), db.LoadConfig())
+	if err != nil {
+		log.Fatalf("unable to setup db service: %v", err)
+	}
+	recordsService = records.CreateService(dbService, logging.Default("records"), records.Config{DBName: db.DBName(), TextSearch: true, TombstoneTTL: time.Hour, BulkMaxSize: BULK_RECORDS_COUNT})
+	err = recordsService.Setup(context.Background())
+	if err != nil {
+		log.Fatalf("unable to setup records service: %v", err)
+	}
+	compressionService, err = compression.CreateService(compression.LoadConfig())
+	if err != nil {
+		log.Fatalf("unable to setup compression service: %v", err)
+	}
+	cacheService = cache.CreateService(recordsService, compressionService, logging.Default("cache"), cache.LoadConfig())
+	cacheService.Start()
 }
 
 func Shutdown() {
-	cache.Instance().ShutDown()
-	records.Instance().ShutDown()
+	cacheService.ShutDown()
+	recordsService.ShutDown()
 
-	collection := db.Instance().GetCollection("testdb", "records")
-	collection.Drop(context.TODO())
+	dbService.Drop(context.Background(), "testdb", "records")
+	dbService.Drop(context.Background(), "testdb", "records_tombstones")
+	dbService.Drop(context.Background(), "testdb", "records_history")
+	dbService.Drop(context.Background(), "testdb", "records_sync")
 
-	db.Instance().ShutDown()
+	dbService.ShutDown()
 }
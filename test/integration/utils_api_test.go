@@ -53,6 +53,34 @@ func (p *TestHttpClient) GetAllRecords() (int, string, error) {
 	return w.Code, w.Body.String(), nil
 }
 
+func (p *TestHttpClient) GetRecord(id string) (int, string, error) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/records/"+id, nil)
+	req.Header.Set("Content-Type", "application/json")
+	TestRouter.ServeHTTP(w, req)
+	return w.Code, w.Body.String(), nil
+}
+
+func (p *TestHttpClient) Do(method string, url string, body string) *httptest.ResponseRecorder {
+	return p.DoWithHeaders(method, url, body, nil)
+}
+
+func (p *TestHttpClient) DoWithHeaders(method string, url string, body string, headers map[string]string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, url, bytes.NewBuffer([]byte(body)))
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	TestRouter.ServeHTTP(w, req)
+	return w
+}
+
+func (p *TestHttpClient) CreateRecordV2(data any) *httptest.ResponseRecorder {
+	body, _ := CreateRecordBody(nil, data)
+	return p.Do(http.MethodPost, "/v2/records/", body)
+}
+
 func ParseForJsonBody(paramName string, paramValue any) (string, error) {
 	result := ""
 	switch paramType := paramValue.(type) {
@@ -98,6 +126,12 @@ func ToRecords(body string) ([]records.Record, error) {
 	return records, err
 }
 
+func ToRecord(body string) (records.Record, error) {
+	record := records.Record{}
+	err := json.Unmarshal([]byte(body), &record)
+	return record, err
+}
+
 func ToId(body string) string {
 	return body[1 : len(body)-1]
 }